@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/amirrezaask/pkg/logging"
 	"github.com/google/uuid"
 	"github.com/rabbitmq/amqp091-go"
 )
@@ -45,7 +46,9 @@ func (rp *RabbitConnection) PublishContext(ctx context.Context, exchange string,
 
 	err = ch.PublishWithContext(ctx, exchange, key, false, false, amqp091.Publishing{
 		Timestamp: time.Now(),
-		Body:      msg,
+		// consumers made by MakeConsumerWithWorkers restore it as request id of the handler context.
+		CorrelationId: logging.RequestID(ctx),
+		Body:          msg,
 	})
 	if err != nil {
 		return err
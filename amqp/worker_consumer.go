@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"strings"
 
+	"github.com/amirrezaask/pkg/logging"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rabbitmq/amqp091-go"
@@ -97,11 +98,15 @@ func MakeConsumerWithWorkers(
 					}
 					timer := prometheus.NewTimer(durationHist.WithLabelValues(exchangeName, queueName))
 
-					err := deliveryHandler(ctx, dv)
+					dvCtx := ctx
+					if dv.CorrelationId != "" {
+						dvCtx = logging.ContextWithRequestID(ctx, dv.CorrelationId)
+					}
+					err := deliveryHandler(dvCtx, dv)
 
 					timer.ObserveDuration()
 					if err != nil {
-						slog.Error("cannot process delivery",
+						slog.ErrorContext(dvCtx, "cannot process delivery",
 							"queueName", queueName,
 							"err", err,
 						)
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
 var (
@@ -15,3 +17,8 @@ type Cacher interface {
 	Remember(ctx context.Context, key string, value any, ttl time.Duration) error
 	Get(ctx context.Context, key string) (any, error)
 }
+
+// IsMiss reports whether err returned by Get means key has no value, rather than a failure of the cache itself.
+func IsMiss(err error) bool {
+	return errors.Is(err, ErrNoEntry) || errors.Is(err, ErrEntryExpired) || errors.Is(err, redis.Nil)
+}
@@ -2,10 +2,12 @@ package cache
 
 import (
 	"context"
+	"sync"
 	"time"
 )
 
 type memoryCacher struct {
+	mu   sync.Mutex
 	data map[string]cacheValue
 }
 
@@ -22,6 +24,8 @@ func NewMemoryCacher() Cacher {
 }
 
 func (m *memoryCacher) Remember(ctx context.Context, key string, value any, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.data[key] = cacheValue{
 		v:                 value,
 		registeredTime:    time.Now(),
@@ -31,6 +35,8 @@ func (m *memoryCacher) Remember(ctx context.Context, key string, value any, ttl
 	return nil
 }
 func (m *memoryCacher) Get(ctx context.Context, key string) (any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	value, ok := m.data[key]
 	if !ok {
 		return nil, ErrNoEntry
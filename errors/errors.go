@@ -59,3 +59,54 @@ func Wrap(err error, msg string, args ...any) error {
 
 	return fmt.Errorf(msg, args...)
 }
+
+// HTTPError is an error that should be reported to http clients with a specific status,
+// Code is a machine readable identifier, Detail is a human readable message that is safe to show to
+// clients and Extra holds additional members of the response. Err is the cause and is never shown to clients.
+type HTTPError struct {
+	Status int
+	Code   string
+	Detail string
+	Extra  map[string]any
+	Err    error
+}
+
+func NewHTTPError(status int, code string, detail string) *HTTPError {
+	return &HTTPError{Status: status, Code: code, Detail: detail}
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("http error status=%d code='%s' detail='%s'", e.Status, e.Code, e.Detail)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// With adds an extra member to the error response.
+func (e *HTTPError) With(key string, value any) *HTTPError {
+	if e.Extra == nil {
+		e.Extra = map[string]any{}
+	}
+	e.Extra[key] = value
+	return e
+}
+
+// Wrap sets the cause of e.
+func (e *HTTPError) Wrap(err error) *HTTPError {
+	e.Err = err
+	return e
+}
+
+// AsHTTPError finds the first HTTPError in err's chain.
+func AsHTTPError(err error) (*HTTPError, bool) {
+	var httpErr *HTTPError
+	if stdErr.As(err, &httpErr) {
+		return httpErr, true
+	}
+	return nil, false
+}
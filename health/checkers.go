@@ -0,0 +1,80 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/amirrezaask/pkg/amqp"
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/amirrezaask/pkg/vault"
+	"github.com/redis/go-redis/v9"
+)
+
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// DB checks a database connection such as *sequel.DB or *sql.DB.
+func DB(db pinger) CheckFunc {
+	return db.PingContext
+}
+
+type redisPinger interface {
+	Ping(ctx context.Context) *redis.StatusCmd
+}
+
+// Redis checks a redis client, *lock.DistributedLock can be passed directly.
+func Redis(client redisPinger) CheckFunc {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}
+}
+
+// Cacher checks a cache, redis cachers created by cache.NewRedisCacher are pinged and other cachers
+// are checked by storing and reading a key.
+func Cacher(c cache.Cacher) CheckFunc {
+	if client, isRedis := c.(redisPinger); isRedis {
+		return Redis(client)
+	}
+	return func(ctx context.Context) error {
+		// a fixed key is overwritten by every probe, so probes never pile up entries in the cache.
+		key := "health:probe"
+		if err := c.Remember(ctx, key, "ok", time.Second); err != nil {
+			return err
+		}
+		_, err := c.Get(ctx, key)
+		return err
+	}
+}
+
+// Rabbit checks that connection is open and can still open channels.
+func Rabbit(conn *amqp.RabbitConnection) CheckFunc {
+	return func(ctx context.Context) error {
+		if conn.Conn == nil || conn.Conn.IsClosed() {
+			return fmt.Errorf("rabbit connection is closed")
+		}
+		ch, err := conn.Conn.Channel()
+		if err != nil {
+			return err
+		}
+		return ch.Close()
+	}
+}
+
+// Vault checks that vault is reachable, initialized and unsealed.
+func Vault(s *vault.Service) CheckFunc {
+	return func(ctx context.Context) error {
+		resp, err := s.Client.Sys().HealthWithContext(ctx)
+		if err != nil {
+			return err
+		}
+		if !resp.Initialized {
+			return fmt.Errorf("vault is not initialized")
+		}
+		if resp.Sealed {
+			return fmt.Errorf("vault is sealed")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,195 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+const (
+	DefaultTimeout  = 5 * time.Second
+	DefaultCacheTTL = 5 * time.Second
+)
+
+// CheckFunc returns an error when the component it checks is not healthy.
+type CheckFunc func(ctx context.Context) error
+
+type Check struct {
+	Name  string
+	Check CheckFunc
+	// Timeout of a single run, DefaultTimeout when zero.
+	Timeout time.Duration
+	// Critical failures make the service down, other failures only degrade it.
+	Critical bool
+	// CacheTTL overrides Registry.CacheTTL for this check, negative values disable caching.
+	CacheTTL time.Duration
+}
+
+type Result struct {
+	Name      string    `json:"name"`
+	Status    Status    `json:"status"`
+	Critical  bool      `json:"critical"`
+	LatencyMS float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+type entry struct {
+	Check
+	mu     sync.Mutex
+	result Result
+}
+
+// Registry runs registered checks concurrently and caches their results, so frequent probes don't hammer dependencies.
+type Registry struct {
+	// CacheTTL is how long a result is reused before the check runs again.
+	CacheTTL time.Duration
+
+	mu      sync.RWMutex
+	entries []*entry
+	gauge   *prometheus.GaugeVec
+}
+
+// NewRegistry creates a registry that exports status of every check as `<namespace>_health_check_status` gauge,
+// 1 means up and 0 means down. Registries with the same namespace share their gauge.
+func NewRegistry(namespace string) *Registry {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "health",
+		Name:      "check_status",
+		Help:      "Status of health checks, 1 is up and 0 is down.",
+	}, []string{"check", "critical"})
+	if err := prometheus.Register(gauge); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &registered) {
+			panic(err)
+		}
+		gauge = registered.ExistingCollector.(*prometheus.GaugeVec)
+	}
+	return &Registry{CacheTTL: DefaultCacheTTL, gauge: gauge}
+}
+
+// Register adds check to registry, registering a name again replaces the previous check.
+func (r *Registry) Register(check Check) {
+	if check.Timeout == 0 {
+		check.Timeout = DefaultTimeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range r.entries {
+		if e.Name == check.Name {
+			r.entries[i] = &entry{Check: check}
+			return
+		}
+	}
+	r.entries = append(r.entries, &entry{Check: check})
+}
+
+// Run returns status of every check, results younger than cache ttl are reused.
+// Service is down when a critical check fails and degraded when any other check fails.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	entries := make([]*entry, len(r.entries))
+	copy(entries, r.entries)
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusUp, Checks: make([]Result, len(entries))}
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = r.run(ctx, e)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run executes a single check unless its cached result is still valid, concurrent callers wait for the same run.
+func (r *Registry) run(ctx context.Context, e *entry) Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ttl := e.CacheTTL
+	if ttl == 0 {
+		ttl = r.CacheTTL
+	}
+	if !e.result.CheckedAt.IsZero() && ttl > 0 && time.Since(e.result.CheckedAt) < ttl {
+		return e.result
+	}
+
+	// result is shared with other callers, so it must not fail because this caller went away.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := runCheck(ctx, e.Check.Check)
+	result := Result{
+		Name:      e.Name,
+		Status:    StatusUp,
+		Critical:  e.Critical,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: start,
+	}
+	gaugeValue := 1.0
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+		gaugeValue = 0
+	}
+	if r.gauge != nil {
+		critical := "false"
+		if e.Critical {
+			critical = "true"
+		}
+		r.gauge.WithLabelValues(e.Name, critical).Set(gaugeValue)
+	}
+	e.result = result
+	return result
+}
+
+// runCheck stops waiting for check when ctx is done, even if check itself ignores ctx.
+func runCheck(ctx context.Context, check CheckFunc) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("health check panicked: %v", r)
+			}
+		}()
+		done <- check(ctx)
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("health check did not finish in time: %w", ctx.Err())
+	}
+}
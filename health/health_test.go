@@ -0,0 +1,93 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/matryer/is"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRegistryCache(t *testing.T) {
+	is := is.New(t)
+	r := NewRegistry("health_cache_test")
+	r.CacheTTL = 50 * time.Millisecond
+	var runs atomic.Int32
+	r.Register(Check{Name: "db", Critical: true, Check: func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}})
+	r.Register(Check{Name: "uncached", CacheTTL: -1, Check: func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}})
+
+	first := r.Run(context.Background())
+	is.Equal(first.Status, StatusUp)
+	is.Equal(len(first.Checks), 2)
+	is.Equal(runs.Load(), int32(2))
+
+	second := r.Run(context.Background())
+	is.Equal(runs.Load(), int32(3))                                 // only the check without caching ran again
+	is.Equal(second.Checks[0].CheckedAt, first.Checks[0].CheckedAt) // cached result is reused
+
+	time.Sleep(60 * time.Millisecond)
+	third := r.Run(context.Background())
+	is.Equal(runs.Load(), int32(5)) // both run once cached result expired
+	is.True(third.Checks[0].CheckedAt.After(first.Checks[0].CheckedAt))
+}
+
+func TestRegistryFailures(t *testing.T) {
+	is := is.New(t)
+	r := NewRegistry("health_failures_test")
+	r.Register(Check{Name: "cache", Check: func(ctx context.Context) error { return errors.New("connection refused") }})
+	r.Register(Check{Name: "db", Critical: true, Check: func(ctx context.Context) error { return nil }})
+
+	report := r.Run(context.Background())
+	is.Equal(report.Status, StatusDegraded) // non critical failures only degrade the service
+	is.Equal(report.Checks[0].Status, StatusDown)
+	is.Equal(report.Checks[0].Error, "connection refused")
+	is.Equal(report.Checks[1].Status, StatusUp)
+
+	r.Register(Check{Name: "db", Critical: true, Check: func(ctx context.Context) error { panic("boom") }})
+	r.Register(Check{Name: "queue", Critical: true, Timeout: 10 * time.Millisecond, Check: func(ctx context.Context) error {
+		time.Sleep(time.Second) // ignores ctx
+		return nil
+	}})
+	report = r.Run(context.Background())
+	is.Equal(report.Status, StatusDown) // critical failures make the service down
+	is.Equal(len(report.Checks), 3)     // registering a name again replaces the check
+	is.Equal(report.Checks[1].Error, "health check panicked: boom")
+	is.Equal(report.Checks[2].Status, StatusDown)
+	is.Equal(report.Checks[2].Error, "health check did not finish in time: context deadline exceeded")
+}
+
+func TestRegistryGauge(t *testing.T) {
+	is := is.New(t)
+	first := NewRegistry("health_gauge_test")
+	second := NewRegistry("health_gauge_test") // registering the gauge again must not panic
+	is.Equal(first.gauge, second.gauge)
+
+	first.Register(Check{Name: "db", Critical: true, Check: func(ctx context.Context) error { return nil }})
+	second.Register(Check{Name: "cache", Check: func(ctx context.Context) error { return errors.New("down") }})
+	first.Run(context.Background())
+	second.Run(context.Background())
+	is.Equal(testutil.ToFloat64(first.gauge.WithLabelValues("db", "true")), 1.0)
+	is.Equal(testutil.ToFloat64(first.gauge.WithLabelValues("cache", "false")), 0.0)
+}
+
+func TestCacher(t *testing.T) {
+	is := is.New(t)
+	c := cache.NewMemoryCacher()
+	check := Cacher(c)
+	for i := 0; i < 3; i++ {
+		is.NoErr(check(context.Background()))
+	}
+	value, err := c.Get(context.Background(), "health:probe")
+	is.NoErr(err)
+	is.True(value != nil) // probes overwrite the same key
+}
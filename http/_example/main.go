@@ -4,8 +4,13 @@ import (
 	"log/slog"
 	"os"
 
+	"github.com/amirrezaask/pkg/health"
 	"github.com/amirrezaask/pkg/http"
+	"github.com/amirrezaask/pkg/http/openapi"
 	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 func main() {
@@ -16,10 +21,19 @@ func main() {
 	mux := http.NewServeMux()
 	slog.SetLogLoggerLevel(slog.LevelDebug)
 
+	exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+	if err != nil {
+		panic(err)
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter)))
+
 	mux.UseMiddlewares(
+		http.RequestIDMiddleware,
+		http.TracingMiddleware(nil),
 		http.PrometheusExporterMiddleware("App"),
 		http.JWTBearerAuthenticationMiddleware[claims]([]byte("")),
 		http.RequestLoggerMiddleware(os.Stdout),
+		http.CompressionMiddleware(http.CompressionConfig{}),
 		http.RecoverMiddleware,
 	)
 	type createUserRequest struct {
@@ -54,6 +68,23 @@ func main() {
 		return output, nil
 	})
 
-	mux.MapPrometheusEndpoint("/metrics")
-	http.ListenAndServe("localhost:8080", mux)
+	mux.MapOpenAPIEndpoint("/openapi.json", openapi.Info{Title: "example", Version: "0.1.0"})
+
+	srv := http.NewManagedServer("localhost:8080", mux)
+	admin := http.NewServeMux()
+	// ADMIN_CREDENTIALS holds whitespace separated `username:bcrypt hash` entries.
+	adminCredentials, err := http.CredentialsFromEnv("ADMIN_CREDENTIALS")
+	if err != nil {
+		slog.Error("cannot load admin credentials", "err", err)
+		os.Exit(1)
+	}
+	admin.MapPrometheusEndpoint("/metrics", http.BasicAuth(http.BasicAuthConfig{Credentials: adminCredentials, Realm: "admin"}))
+	registry := health.NewRegistry("App")
+	registry.Register(health.Check{Name: "server", Check: srv.CheckReady, Critical: true, CacheTTL: -1})
+	admin.MapHealthEndpoints("/health", registry)
+	srv.Listen("localhost:9090", admin)
+	if err := srv.ListenAndServe(); err != nil {
+		slog.Error("server stopped", "err", err)
+		os.Exit(1)
+	}
 }
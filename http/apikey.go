@@ -0,0 +1,289 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/amirrezaask/pkg/sequel"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+	// APIKeyAuthScheme can be used with Policy.WithScheme and ServeMux.AddSecurityScheme to document api key routes.
+	APIKeyAuthScheme = "apiKey"
+
+	DefaultAPIKeyCacheTTL         = time.Minute
+	DefaultAPIKeyLastUsedInterval = time.Minute
+)
+
+var ErrAPIKeyNotFound = stderrors.New("api key not found")
+
+// APIKey is a stored api key, only sha256 hash of the key is kept so a leaked store does not leak usable keys.
+type APIKey struct {
+	Hash      string    `json:"hash"`
+	Principal string    `json:"principal"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"` // zero never expires.
+	// LastUsedAt is updated at most once every APIKeyConfig.LastUsedInterval.
+	LastUsedAt time.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// APIKeyStore finds api keys by their hash.
+type APIKeyStore interface {
+	// FindAPIKey returns ErrAPIKeyNotFound for unknown hashes.
+	FindAPIKey(ctx context.Context, hash string) (APIKey, error)
+	TouchAPIKey(ctx context.Context, hash string, usedAt time.Time) error
+}
+
+// HashAPIKey returns the hash keys are stored and looked up by, keys are random so a fast hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateAPIKey returns a new random key with prefix, eg: "partner_...", and its record to be stored.
+// Key itself should be shown once to its owner and never stored.
+func GenerateAPIKey(prefix string, principal string, scopes ...string) (string, APIKey) {
+	key := randomToken(32)
+	if prefix != "" {
+		key = prefix + "_" + key
+	}
+	return key, APIKey{Hash: HashAPIKey(key), Principal: principal, Scopes: scopes, CreatedAt: time.Now()}
+}
+
+// APIKeyClaims are claims of requests authenticated by an api key, subject is principal of the key
+// and scopes are checked by RequireScopes.
+type APIKeyClaims struct {
+	jwt.RegisteredClaims
+	Scopes []string `json:"scopes"`
+}
+
+func (c *APIKeyClaims) GetScopes() []string { return c.Scopes }
+
+type APIKeyConfig struct {
+	Store APIKeyStore
+	// Header key is read from, APIKeyHeader when empty.
+	Header string
+	// QueryParam key is read from when header is not set, keys in urls end up in logs so it's disabled when empty.
+	QueryParam string
+	// Cache keeps looked up keys for CacheTTL, so revoked keys keep working until their cache entry expires.
+	Cache    cache.Cacher
+	CacheTTL time.Duration
+	// LastUsedInterval limits how often last used time of a key is written to store.
+	LastUsedInterval time.Duration
+	// Strict rejects requests with missing or invalid keys with 401, otherwise they continue unauthenticated.
+	Strict bool
+}
+
+// APIKeyAuthMiddleware authenticates requests by api keys of cfg.Store, *APIKeyClaims of the key are stored as ClaimsKey.
+func APIKeyAuthMiddleware(cfg APIKeyConfig) MiddlewareFunc {
+	if cfg.Store == nil {
+		panic("api key middleware needs a store")
+	}
+	if cfg.Header == "" {
+		cfg.Header = APIKeyHeader
+	}
+	if cfg.CacheTTL == 0 {
+		cfg.CacheTTL = DefaultAPIKeyCacheTTL
+	}
+	if cfg.LastUsedInterval == 0 {
+		cfg.LastUsedInterval = DefaultAPIKeyLastUsedInterval
+	}
+	touches := &apiKeyTouches{at: map[string]time.Time{}}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(cfg.Header)
+			if key == "" && cfg.QueryParam != "" {
+				key = r.URL.Query().Get(cfg.QueryParam)
+			}
+			if key == "" {
+				if cfg.Strict {
+					writeError(w, r, errors.NewHTTPError(http.StatusUnauthorized, "unauthenticated", "api key is required"))
+					return
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+			apiKey, err := lookupAPIKey(r.Context(), cfg, HashAPIKey(key))
+			if err != nil {
+				if !stderrors.Is(err, ErrAPIKeyNotFound) {
+					writeError(w, r, err)
+					return
+				}
+				slog.InfoContext(r.Context(), "invalid api key")
+				if cfg.Strict {
+					writeError(w, r, errors.NewHTTPError(http.StatusUnauthorized, "invalid_api_key", "api key is invalid or expired"))
+					return
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+			if now := time.Now(); touches.due(apiKey, now, cfg.LastUsedInterval) {
+				// usage tracking is best effort, it should not fail requests.
+				if err := cfg.Store.TouchAPIKey(r.Context(), apiKey.Hash, now); err != nil {
+					slog.WarnContext(r.Context(), "cannot update last used time of api key", "err", err, "principal", apiKey.Principal)
+				}
+			}
+			claims := &APIKeyClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: apiKey.Principal}, Scopes: apiKey.Scopes}
+			if !apiKey.ExpiresAt.IsZero() {
+				claims.ExpiresAt = jwt.NewNumericDate(apiKey.ExpiresAt)
+			}
+			r = r.WithContext(context.WithValue(r.Context(), ClaimsKey, jwt.Claims(claims)))
+			r = r.WithContext(context.WithValue(r.Context(), IsAuthenticatedKey, true))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiKeyTouches remembers when keys were touched, LastUsedAt of cached keys is as old as their cache entry.
+type apiKeyTouches struct {
+	mu sync.Mutex
+	at map[string]time.Time
+}
+
+// due reports whether key should be touched at now and records the touch if so.
+func (t *apiKeyTouches) due(key APIKey, now time.Time, interval time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last := key.LastUsedAt
+	if touched := t.at[key.Hash]; touched.After(last) {
+		last = touched
+	}
+	if now.Sub(last) < interval {
+		return false
+	}
+	t.at[key.Hash] = now
+	return true
+}
+
+// lookupAPIKey finds key of hash through cache, unknown keys are cached too so they don't hit store on every request.
+func lookupAPIKey(ctx context.Context, cfg APIKeyConfig, hash string) (APIKey, error) {
+	cacheKey := "apikey:" + hash
+	var apiKey APIKey
+	cached := false
+	if cfg.Cache != nil {
+		if v, err := cfg.Cache.Get(ctx, cacheKey); err == nil {
+			cached = decodeCached(v, &apiKey) == nil
+		}
+	}
+	if !cached {
+		var err error
+		apiKey, err = cfg.Store.FindAPIKey(ctx, hash)
+		if err != nil && !stderrors.Is(err, ErrAPIKeyNotFound) {
+			return APIKey{}, errors.Wrap(err, "cannot find api key")
+		}
+		if cfg.Cache != nil {
+			if bs, err := json.Marshal(apiKey); err == nil {
+				if err := cfg.Cache.Remember(ctx, cacheKey, string(bs), cfg.CacheTTL); err != nil {
+					slog.WarnContext(ctx, "cannot cache api key", "err", err)
+				}
+			}
+		}
+	}
+	// hashes are compared again so a store matching case insensitively cannot be abused.
+	if apiKey.Hash == "" || subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hash)) != 1 {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if !apiKey.ExpiresAt.IsZero() && time.Now().After(apiKey.ExpiresAt) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return apiKey, nil
+}
+
+// SQLAPIKeyStore stores api keys in `api_keys` table, mysql connections should be opened with parseTime.
+type SQLAPIKeyStore struct {
+	db sequel.QueryExecerContext
+}
+
+// NewSQLAPIKeyStore creates `api_keys` table if it does not exist, mysql and sqlite3 are supported.
+func NewSQLAPIKeyStore(ctx context.Context, db sequel.QueryExecerContext) (*SQLAPIKeyStore, error) {
+	driver := fmt.Sprintf("%T", db.Driver()) // to not import sql drivers here as well.
+
+	var createTable string
+	switch driver {
+	case "*mysql.MysqlDriver":
+		createTable = "CREATE TABLE IF NOT EXISTS api_keys (" +
+			"key_hash CHAR(64) PRIMARY KEY," +
+			"principal VARCHAR(255) NOT NULL," +
+			"scopes TEXT NOT NULL," +
+			"expires_at DATETIME NULL," +
+			"last_used_at DATETIME NULL," +
+			"created_at DATETIME NOT NULL," +
+			"INDEX idx_api_keys_principal (principal)" +
+			");"
+	case "*sqlite3.SQLiteDriver":
+		createTable = "CREATE TABLE IF NOT EXISTS api_keys (" +
+			"key_hash TEXT PRIMARY KEY," +
+			"principal TEXT NOT NULL," +
+			"scopes TEXT NOT NULL," +
+			"expires_at DATETIME," +
+			"last_used_at DATETIME," +
+			"created_at DATETIME NOT NULL" +
+			");"
+	default:
+		return nil, errors.Newf("error in creating api key store, unsupported database driver: %s", driver)
+	}
+
+	if _, err := db.ExecContext(ctx, createTable); err != nil {
+		return nil, errors.Wrap(err, "error in creating table api_keys")
+	}
+	return &SQLAPIKeyStore{db: db}, nil
+}
+
+// CreateAPIKey stores key, use GenerateAPIKey to make one.
+func (s *SQLAPIKeyStore) CreateAPIKey(ctx context.Context, key APIKey) error {
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx, "INSERT INTO api_keys (key_hash, principal, scopes, expires_at, last_used_at, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		key.Hash, key.Principal, strings.Join(key.Scopes, " "), nullTime(key.ExpiresAt), nullTime(key.LastUsedAt), key.CreatedAt.UTC())
+	return errors.Wrap(err, "error in inserting api key")
+}
+
+// RevokeAPIKey deletes key of hash, cached lookups of it are valid until they expire.
+func (s *SQLAPIKeyStore) RevokeAPIKey(ctx context.Context, hash string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM api_keys WHERE key_hash = ?", hash)
+	return errors.Wrap(err, "error in deleting api key")
+}
+
+func (s *SQLAPIKeyStore) FindAPIKey(ctx context.Context, hash string) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, "SELECT key_hash, principal, scopes, expires_at, last_used_at, created_at FROM api_keys WHERE key_hash = ?", hash).
+		Scan(&key.Hash, &key.Principal, &scopes, &expiresAt, &lastUsedAt, &key.CreatedAt)
+	if stderrors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, errors.Wrap(err, "error in querying api key")
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.ExpiresAt = expiresAt.Time
+	key.LastUsedAt = lastUsedAt.Time
+	return key, nil
+}
+
+func (s *SQLAPIKeyStore) TouchAPIKey(ctx context.Context, hash string, usedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE key_hash = ?", usedAt.UTC(), hash)
+	return errors.Wrap(err, "error in updating last used time of api key")
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
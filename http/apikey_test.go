@@ -0,0 +1,143 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/amirrezaask/pkg/sequel"
+	"github.com/matryer/is"
+)
+
+type countingAPIKeyStore struct {
+	APIKeyStore
+	finds   int
+	touches int
+}
+
+func (s *countingAPIKeyStore) FindAPIKey(ctx context.Context, hash string) (APIKey, error) {
+	s.finds++
+	return s.APIKeyStore.FindAPIKey(ctx, hash)
+}
+
+func (s *countingAPIKeyStore) TouchAPIKey(ctx context.Context, hash string, at time.Time) error {
+	s.touches++
+	return s.APIKeyStore.TouchAPIKey(ctx, hash, at)
+}
+
+func TestAPIKeyAuthMiddleware(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	var db *sequel.DB
+	sequel.NewMockDb(t, &db)
+	store, err := NewSQLAPIKeyStore(ctx, db)
+	is.NoErr(err)
+	_, err = NewSQLAPIKeyStore(ctx, db) // migration is idempotent
+	is.NoErr(err)
+
+	key, record := GenerateAPIKey("partner", "acme", "orders:read")
+	is.True(strings.HasPrefix(key, "partner_"))
+	is.NoErr(store.CreateAPIKey(ctx, record))
+	expired, expiredRecord := GenerateAPIKey("partner", "old")
+	expiredRecord.ExpiresAt = time.Now().Add(-time.Hour)
+	is.NoErr(store.CreateAPIKey(ctx, expiredRecord))
+
+	counting := &countingAPIKeyStore{APIKeyStore: store}
+	mux := NewServeMux()
+	mux.UseMiddlewares(APIKeyAuthMiddleware(APIKeyConfig{Store: counting, QueryParam: "api_key", Cache: cache.NewMemoryCacher()}))
+	mux.HandleFunc("GET /orders", func(r *Request) (Result, error) {
+		sub, err := r.GetClaims().GetSubject()
+		return Result{Body: sub}, err
+	}, Authorize(RequireScopes("orders:read").WithScheme(APIKeyAuthScheme)))
+	mux.HandleFunc("POST /orders", func(r *Request) (Result, error) {
+		return Result{}, nil
+	}, Authorize(RequireScopes("orders:write").WithScheme(APIKeyAuthScheme)))
+
+	call := func(method, target, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call(http.MethodGet, "/orders", key)
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(strings.TrimSpace(w.Body.String()), `"acme"`)
+	is.Equal(call(http.MethodGet, "/orders?api_key="+key, "").Code, http.StatusOK)
+	is.Equal(counting.finds, 1)   // lookups are cached
+	is.Equal(counting.touches, 1) // so are touches, though cached key has an old last used time
+
+	stored, err := store.FindAPIKey(ctx, HashAPIKey(key))
+	is.NoErr(err)
+	is.True(time.Since(stored.LastUsedAt) < time.Minute)
+	is.Equal(stored.Scopes, []string{"orders:read"})
+
+	is.Equal(call(http.MethodPost, "/orders", key).Code, http.StatusForbidden)
+	is.Equal(call(http.MethodGet, "/orders", expired).Code, http.StatusUnauthorized)
+	is.Equal(call(http.MethodGet, "/orders", "partner_unknown").Code, http.StatusUnauthorized)
+	is.Equal(call(http.MethodGet, "/orders", "partner_unknown").Code, http.StatusUnauthorized)
+	is.Equal(counting.finds, 3) // unknown keys are cached too
+
+	is.NoErr(store.RevokeAPIKey(ctx, HashAPIKey(key)))
+	_, err = store.FindAPIKey(ctx, HashAPIKey(key))
+	is.Equal(err, ErrAPIKeyNotFound)
+}
+
+func TestAPIKeyAuthMiddlewareStrict(t *testing.T) {
+	is := is.New(t)
+	var db *sequel.DB
+	sequel.NewMockDb(t, &db)
+	store, err := NewSQLAPIKeyStore(context.Background(), db)
+	is.NoErr(err)
+
+	mux := NewServeMux()
+	mux.UseMiddlewares(APIKeyAuthMiddleware(APIKeyConfig{Store: store, Strict: true}))
+	mux.HandleFunc("GET /", func(r *Request) (Result, error) { return Result{}, nil })
+	for _, key := range []string{"", "invalid"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		is.Equal(w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPIKeyResponseCache(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	var db *sequel.DB
+	sequel.NewMockDb(t, &db)
+	store, err := NewSQLAPIKeyStore(ctx, db)
+	is.NoErr(err)
+	key, record := GenerateAPIKey("partner", "acme", "orders:read")
+	is.NoErr(store.CreateAPIKey(ctx, record))
+
+	// response cache runs before authentication, so requests with keys must not be cached.
+	mux := NewServeMux()
+	mux.UseMiddlewares(NewResponseCache(ResponseCacheConfig{Cache: cache.NewMemoryCacher()}).Middleware(), APIKeyAuthMiddleware(APIKeyConfig{Store: store}))
+	mux.HandleFunc("GET /orders", func(r *Request) (Result, error) {
+		sub, err := r.GetClaims().GetSubject()
+		return Result{Body: sub}, err
+	}, Authorize(RequireScopes("orders:read").WithScheme(APIKeyAuthScheme)))
+
+	for _, key := range []string{key, ""} {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if key != "" {
+			is.Equal(w.Code, http.StatusOK)
+		} else {
+			is.Equal(w.Code, http.StatusUnauthorized)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package http
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/amirrezaask/pkg/http/openapi"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// BearerAuthScheme is the OpenAPI security scheme policies refer to unless they are bound to another one
+// with Policy.WithScheme, generated documents describe it as a bearer JWT scheme when it's not defined.
+const BearerAuthScheme = "bearerAuth"
+
+// ScopedClaims are claims that provide their own scopes, otherwise scopes are read from
+// `scope` claim as a space separated string or `scp` claim as a list.
+type ScopedClaims interface {
+	GetScopes() []string
+}
+
+// RoleClaims are claims that provide their own roles, otherwise roles are read from `roles` or `role` claims.
+type RoleClaims interface {
+	GetRoles() []string
+}
+
+// Policy decides whether an authenticated request is allowed, policies are composed with AllOf and AnyOf
+// and enforced by Authorize.
+type Policy struct {
+	allow func(r *Request) bool
+	// requirements are alternative OpenAPI security requirements, one of them has to be met.
+	requirements []openapi.SecurityRequirement
+}
+
+// RequireScopes allows requests whose claims have every one of scopes.
+func RequireScopes(scopes ...string) Policy {
+	return Policy{
+		allow: func(r *Request) bool {
+			granted := claimValues(r.GetClaims(), "scope", "scp")
+			if c, ok := r.GetClaims().(ScopedClaims); ok {
+				granted = c.GetScopes()
+			}
+			return containsAll(granted, scopes)
+		},
+		requirements: []openapi.SecurityRequirement{{BearerAuthScheme: slices.Clone(scopes)}},
+	}
+}
+
+// RequireRole allows requests whose claims have role.
+func RequireRole(role string) Policy {
+	return Policy{
+		allow: func(r *Request) bool {
+			granted := claimValues(r.GetClaims(), "roles", "role")
+			if c, ok := r.GetClaims().(RoleClaims); ok {
+				granted = c.GetRoles()
+			}
+			return slices.Contains(granted, role)
+		},
+		requirements: []openapi.SecurityRequirement{{BearerAuthScheme: {role}}},
+	}
+}
+
+// RequireClaims allows requests whose claims are of type CLAIMS and satisfy allow:
+//
+//	RequireClaims(func(c *Claims) bool { return c.TenantID != "" })
+func RequireClaims[C any, CLAIMS interface {
+	jwt.Claims
+	*C
+}](allow func(CLAIMS) bool) Policy {
+	return Policy{
+		allow: func(r *Request) bool {
+			claims, ok := r.GetClaims().(CLAIMS)
+			return ok && allow(claims)
+		},
+		requirements: []openapi.SecurityRequirement{{BearerAuthScheme: {}}},
+	}
+}
+
+// AllOf allows requests that every one of policies allows.
+func AllOf(policies ...Policy) Policy {
+	requirements := []openapi.SecurityRequirement{{}}
+	for _, p := range policies {
+		// every alternative of p is combined with every alternative so far.
+		var combined []openapi.SecurityRequirement
+		for _, req := range requirements {
+			for _, alt := range p.requirements {
+				merged := maps.Clone(req)
+				for scheme, scopes := range alt {
+					merged[scheme] = appendUnique(merged[scheme], scopes...)
+				}
+				combined = append(combined, merged)
+			}
+		}
+		requirements = combined
+	}
+	return Policy{
+		allow: func(r *Request) bool {
+			for _, p := range policies {
+				if !p.allow(r) {
+					return false
+				}
+			}
+			return true
+		},
+		requirements: requirements,
+	}
+}
+
+// AnyOf allows requests that at least one of policies allows.
+func AnyOf(policies ...Policy) Policy {
+	var requirements []openapi.SecurityRequirement
+	for _, p := range policies {
+		requirements = append(requirements, p.requirements...)
+	}
+	return Policy{
+		allow: func(r *Request) bool {
+			for _, p := range policies {
+				if p.allow(r) {
+					return true
+				}
+			}
+			return false
+		},
+		requirements: requirements,
+	}
+}
+
+// WithScheme binds requirements of p to security scheme, for example when scopes come from an api key.
+func (p Policy) WithScheme(scheme string) Policy {
+	requirements := make([]openapi.SecurityRequirement, 0, len(p.requirements))
+	for _, req := range p.requirements {
+		rebound := openapi.SecurityRequirement{}
+		for _, scopes := range req {
+			rebound[scheme] = appendUnique(rebound[scheme], scopes...)
+		}
+		requirements = append(requirements, rebound)
+	}
+	p.requirements = requirements
+	return p
+}
+
+// Authorize allows requests that every one of policies allows, unauthenticated requests are rejected with 401
+// and denied ones with 403. It should run after authentication middlewares, policies are added to security
+// requirements of routes it's registered for.
+func Authorize(policies ...Policy) MiddlewareFunc {
+	policy := AllOf(policies...)
+	if len(policies) == 0 {
+		policy.requirements = []openapi.SecurityRequirement{{BearerAuthScheme: {}}}
+	}
+	return func(h http.Handler) http.Handler {
+		return &authorizeHandler{next: h, policy: policy}
+	}
+}
+
+type authorizeHandler struct {
+	next   http.Handler
+	policy Policy
+}
+
+func (a *authorizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value(IsAuthenticatedKey) != true {
+		writeError(w, r, errors.NewHTTPError(http.StatusUnauthorized, "unauthenticated", "authentication is required"))
+		return
+	}
+	if !a.policy.allow(&Request{r}) {
+		writeError(w, r, errors.NewHTTPError(http.StatusForbidden, "forbidden", "you are not allowed to perform this operation"))
+		return
+	}
+	a.next.ServeHTTP(w, r)
+}
+
+// claimValues reads the first of names from claims as a list, strings are split by spaces.
+func claimValues(claims jwt.Claims, names ...string) []string {
+	if claims == nil {
+		return nil
+	}
+	bs, err := json.Marshal(claims)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil
+	}
+	for _, name := range names {
+		switch v := m[name].(type) {
+		case string:
+			return strings.Fields(v)
+		case []any:
+			values := make([]string, 0, len(v))
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					values = append(values, s)
+				}
+			}
+			return values
+		}
+	}
+	return nil
+}
+
+func containsAll(granted []string, required []string) bool {
+	for _, r := range required {
+		if !slices.Contains(granted, r) {
+			return false
+		}
+	}
+	return true
+}
+
+func appendUnique(values []string, more ...string) []string {
+	values = slices.Clone(values)
+	if values == nil {
+		values = []string{}
+	}
+	for _, v := range more {
+		if !slices.Contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
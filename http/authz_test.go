@@ -0,0 +1,85 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/amirrezaask/pkg/http/openapi"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/matryer/is"
+)
+
+type testAuthzClaims struct {
+	jwt.RegisteredClaims
+	Scope    string   `json:"scope"`
+	Roles    []string `json:"roles"`
+	TenantID string   `json:"tenant_id"`
+}
+
+func TestAuthorize(t *testing.T) {
+	is := is.New(t)
+	secret := []byte("secret")
+	mux := NewServeMux()
+	mux.UseMiddlewares(JWTBearerAuthenticationMiddleware[testAuthzClaims](secret))
+	ok := func(r *Request) (Result, error) { return Result{Status: http.StatusNoContent}, nil }
+
+	orders := mux.Group("/orders", Authorize(RequireClaims(func(c *testAuthzClaims) bool { return c.TenantID != "" })))
+	orders.HandleFunc("GET /{$}", ok, Authorize())
+	orders.HandleFunc("POST /{$}", ok, Authorize(RequireScopes("orders:write")))
+	orders.HandleFunc("DELETE /{id}", ok, Authorize(AnyOf(RequireRole("admin"), AllOf(RequireRole("support"), RequireScopes("orders:delete")))))
+
+	call := func(method, path string, claims testAuthzClaims) int {
+		req := httptest.NewRequest(method, path, nil)
+		if claims.Subject != "" {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+			is.NoErr(err)
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+	user := func(tenant, scope string, roles ...string) testAuthzClaims {
+		return testAuthzClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"}, TenantID: tenant, Scope: scope, Roles: roles}
+	}
+
+	is.Equal(call(http.MethodGet, "/orders/", testAuthzClaims{}), http.StatusUnauthorized)
+	is.Equal(call(http.MethodGet, "/orders/", user("", "")), http.StatusForbidden) // group policy
+	is.Equal(call(http.MethodGet, "/orders/", user("t1", "")), http.StatusNoContent)
+
+	is.Equal(call(http.MethodPost, "/orders/", user("t1", "orders:read")), http.StatusForbidden)
+	is.Equal(call(http.MethodPost, "/orders/", user("t1", "orders:read orders:write")), http.StatusNoContent)
+
+	is.Equal(call(http.MethodDelete, "/orders/1", user("t1", "orders:delete")), http.StatusForbidden)
+	is.Equal(call(http.MethodDelete, "/orders/1", user("t1", "", "support")), http.StatusForbidden)
+	is.Equal(call(http.MethodDelete, "/orders/1", user("t1", "orders:delete", "support")), http.StatusNoContent)
+	is.Equal(call(http.MethodDelete, "/orders/1", user("t1", "", "admin")), http.StatusNoContent)
+
+	mux.HandleFunc("GET /public", ok)
+	doc := mux.OpenAPI(openapi.Info{Title: "test", Version: "1.0.0"})
+	is.NoErr(doc.Validate())
+	is.Equal(doc.Components.SecuritySchemes[BearerAuthScheme].Scheme, "bearer")
+	is.Equal(doc.Paths.Items["/orders/"].Get.Security, []openapi.SecurityRequirement{{BearerAuthScheme: {}}})
+	is.Equal(doc.Paths.Items["/orders/"].Post.Security, []openapi.SecurityRequirement{{BearerAuthScheme: {"orders:write"}}})
+	is.Equal(doc.Paths.Items["/orders/{id}"].Delete.Security, []openapi.SecurityRequirement{
+		{BearerAuthScheme: {"admin"}},
+		{BearerAuthScheme: {"support", "orders:delete"}},
+	})
+	is.True(doc.Paths.Items["/orders/{id}"].Delete.Responses.Codes["403"].Description != "")
+	is.True(doc.Paths.Items["/public"].Get.Security == nil)
+}
+
+func TestPolicyWithScheme(t *testing.T) {
+	is := is.New(t)
+	mux := NewServeMux()
+	mux.AddSecurityScheme("apiKey", openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "X-API-Key"})
+	mux.HandleFunc("GET /reports", func(r *Request) (Result, error) { return Result{}, nil },
+		Authorize(AllOf(RequireScopes("reports:read"), RequireRole("analyst")).WithScheme("apiKey")))
+
+	doc := mux.OpenAPI(openapi.Info{Title: "test", Version: "1.0.0"})
+	is.NoErr(doc.Validate())
+	is.Equal(doc.Paths.Items["/reports"].Get.Security, []openapi.SecurityRequirement{{"apiKey": {"reports:read", "analyst"}}})
+	_, bearer := doc.Components.SecuritySchemes[BearerAuthScheme]
+	is.True(!bearer)
+}
@@ -0,0 +1,303 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirrezaask/pkg/env"
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	DefaultBasicAuthRealm       = "Restricted"
+	DefaultBasicAuthMaxFailures = 5
+	DefaultBasicAuthLockout     = 15 * time.Minute
+)
+
+// CredentialProvider verifies username and password of basic auth requests.
+type CredentialProvider interface {
+	Verify(ctx context.Context, username string, password string) (bool, error)
+}
+
+// HashedCredentials maps usernames to password hashes, hashes are either bcrypt ($2a$, $2b$, $2y$)
+// or argon2id in PHC format ($argon2id$v=19$m=65536,t=3,p=2$salt$hash). Use HashPassword to make one.
+type HashedCredentials map[string]string
+
+// dummyHash is verified for unknown users so response time does not reveal which usernames exist.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func (c HashedCredentials) Verify(_ context.Context, username string, password string) (bool, error) {
+	hash, exists := c[username]
+	if !exists {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return false, nil
+	}
+	return verifyPasswordHash(hash, password)
+}
+
+// HashPassword hashes password with bcrypt, so it can be used in HashedCredentials or htpasswd files.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func verifyPasswordHash(hash string, password string) (bool, error) {
+	if isBcrypt(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	actual := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.threads, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(actual, params.key) == 1, nil
+}
+
+// checkPasswordHash validates format of hash without the cost of verifying a password.
+func checkPasswordHash(hash string) error {
+	if isBcrypt(hash) {
+		_, err := bcrypt.Cost([]byte(hash))
+		return err
+	}
+	_, err := parseArgon2id(hash)
+	return err
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+type argon2idParams struct {
+	memory     uint32
+	iterations uint32
+	threads    uint8
+	salt       []byte
+	key        []byte
+}
+
+func parseArgon2id(hash string) (argon2idParams, error) {
+	var params argon2idParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, errors.New("unsupported password hash format")
+	}
+	if parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return params, errors.Newf("unsupported argon2id version '%s'", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.threads); err != nil {
+		return params, errors.Wrap(err, "invalid argon2id parameters")
+	}
+	// argon2 panics on these, they are rejected here so bad hashes fail at load instead of login.
+	if params.iterations < 1 || params.threads < 1 {
+		return params, errors.New("argon2id iterations and parallelism should be at least 1")
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, errors.Wrap(err, "invalid argon2id salt")
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return params, errors.New("invalid argon2id key")
+	}
+	return params, nil
+}
+
+// ParseHtpasswd reads `username:hash` lines, empty lines and lines starting with # are skipped.
+// Only bcrypt and argon2id hashes are accepted, so weak htpasswd formats like {SHA} or $apr1$ fail loudly.
+func ParseHtpasswd(r io.Reader) (HashedCredentials, error) {
+	creds := HashedCredentials{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := creds.add(line); err != nil {
+			return nil, errors.Wrap(err, "line %d", n)
+		}
+	}
+	return creds, scanner.Err()
+}
+
+// LoadHtpasswdFile reads credentials from an htpasswd file, see ParseHtpasswd.
+func LoadHtpasswdFile(path string) (HashedCredentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseHtpasswd(f)
+}
+
+// CredentialsFromEnv reads whitespace separated `username:hash` entries from env variable key.
+func CredentialsFromEnv(key string) (HashedCredentials, error) {
+	creds := HashedCredentials{}
+	for _, entry := range strings.Fields(env.Default(key, "")) {
+		if err := creds.add(entry); err != nil {
+			return nil, errors.Wrap(err, "invalid credentials in %s", key)
+		}
+	}
+	return creds, nil
+}
+
+func (c HashedCredentials) add(entry string) error {
+	username, hash, ok := strings.Cut(entry, ":")
+	if !ok || username == "" {
+		return errors.New("entry should be in username:hash format")
+	}
+	if err := checkPasswordHash(hash); err != nil {
+		return errors.Wrap(err, "invalid hash for user '%s'", username)
+	}
+	c[username] = hash
+	return nil
+}
+
+type BasicAuthConfig struct {
+	Credentials CredentialProvider
+	// Realm is sent in WWW-Authenticate challenges, DefaultBasicAuthRealm when empty.
+	Realm string
+	// MaxFailures of a username from an ip locks it out for Lockout, DefaultBasicAuthMaxFailures when zero.
+	MaxFailures int
+	Lockout     time.Duration
+}
+
+// BasicAuth authenticates requests with basic auth credentials of cfg.Credentials, requests without valid
+// credentials get 401 with a challenge for cfg.Realm. Failed attempts are counted per username and ip in memory,
+// locked out clients get 429 until their lockout ends. Username is stored as subject of ClaimsKey.
+func BasicAuth(cfg BasicAuthConfig) MiddlewareFunc {
+	if cfg.Credentials == nil {
+		panic("basic auth needs a credential provider")
+	}
+	if cfg.Realm == "" {
+		cfg.Realm = DefaultBasicAuthRealm
+	}
+	if cfg.MaxFailures == 0 {
+		cfg.MaxFailures = DefaultBasicAuthMaxFailures
+	}
+	if cfg.Lockout == 0 {
+		cfg.Lockout = DefaultBasicAuthLockout
+	}
+	failures := &loginFailures{attempts: map[string]*loginAttempts{}}
+	challenge := fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, cfg.Realm)
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+			if !ok {
+				w.Header().Set("WWW-Authenticate", challenge)
+				writeError(w, r, errors.NewHTTPError(http.StatusUnauthorized, "unauthenticated", "credentials are required"))
+				return
+			}
+			key := cfg.Realm + ":" + KeyByIP(&Request{r}) + ":" + username
+			if retryAfter := failures.lockedFor(key, time.Now()); retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+				writeError(w, r, errors.NewHTTPError(http.StatusTooManyRequests, "locked_out", "too many failed attempts"))
+				return
+			}
+			valid, err := cfg.Credentials.Verify(r.Context(), username, password)
+			if err != nil {
+				writeError(w, r, errors.Wrap(err, "cannot verify credentials"))
+				return
+			}
+			if !valid {
+				if failures.fail(key, time.Now(), cfg.MaxFailures, cfg.Lockout) {
+					slog.WarnContext(r.Context(), "basic auth user is locked out", "username", username, "realm", cfg.Realm, "ip", KeyByIP(&Request{r}))
+				}
+				w.Header().Set("WWW-Authenticate", challenge)
+				writeError(w, r, errors.NewHTTPError(http.StatusUnauthorized, "invalid_credentials", "username or password is invalid"))
+				return
+			}
+			failures.reset(key)
+			r = r.WithContext(context.WithValue(r.Context(), ClaimsKey, jwt.Claims(&jwt.RegisteredClaims{Subject: username})))
+			r = r.WithContext(context.WithValue(r.Context(), IsAuthenticatedKey, true))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+type loginAttempts struct {
+	failures    int
+	since       time.Time
+	lockedUntil time.Time
+}
+
+type loginFailures struct {
+	mu       sync.Mutex
+	attempts map[string]*loginAttempts
+	calls    int
+}
+
+func (l *loginFailures) lockedFor(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if a, ok := l.attempts[key]; ok && now.Before(a.lockedUntil) {
+		return a.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// fail records a failed attempt of key and reports whether key got locked out, failures older than lockout are forgotten.
+func (l *loginFailures) fail(key string, now time.Time, maxFailures int, lockout time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now, lockout)
+	a, ok := l.attempts[key]
+	if !ok || now.Sub(a.since) > lockout {
+		a = &loginAttempts{since: now}
+		l.attempts[key] = a
+	}
+	a.failures++
+	if a.failures >= maxFailures {
+		a.lockedUntil = now.Add(lockout)
+		a.failures = 0
+		a.since = now
+		return true
+	}
+	return false
+}
+
+func (l *loginFailures) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
+
+// sweep drops stale entries so clients with random usernames cannot grow the map forever, it runs every few thousand calls.
+func (l *loginFailures) sweep(now time.Time, lockout time.Duration) {
+	l.calls++
+	if l.calls%4096 != 0 {
+		return
+	}
+	for key, a := range l.attempts {
+		if now.After(a.lockedUntil) && now.Sub(a.since) > lockout {
+			delete(l.attempts, key)
+		}
+	}
+}
+
+// compareCredential returns 1 when a equals b and 0 otherwise in constant time, hashes hide length difference
+// of inputs too. Results are combined with & so every credential is compared.
+func compareCredential(a string, b string) int {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:])
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuth(t *testing.T) {
+	is := is.New(t)
+	adminHash, err := bcrypt.GenerateFromPassword([]byte("admin-pass"), bcrypt.MinCost)
+	is.NoErr(err)
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("metrics-pass"), salt, 1, 1024, 1, 32)
+	metricsHash := fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	creds, err := ParseHtpasswd(strings.NewReader(fmt.Sprintf("# admins\nadmin:%s\n\nmetrics:%s\n", adminHash, metricsHash)))
+	is.NoErr(err)
+	is.Equal(len(creds), 2)
+
+	mux := NewServeMux()
+	mux.HandleFunc("GET /admin", func(r *Request) (Result, error) {
+		sub, err := r.GetClaims().GetSubject()
+		return Result{Body: sub}, err
+	}, BasicAuth(BasicAuthConfig{Credentials: creds, Realm: "admin", MaxFailures: 3, Lockout: time.Minute}))
+
+	call := func(user, pass string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("admin", "admin-pass")
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(strings.TrimSpace(w.Body.String()), `"admin"`)
+	is.Equal(call("metrics", "metrics-pass").Code, http.StatusOK)
+
+	w = call("", "")
+	is.Equal(w.Code, http.StatusUnauthorized)
+	is.Equal(w.Header().Get("WWW-Authenticate"), `Basic realm="admin", charset="UTF-8"`)
+	is.Equal(call("nobody", "admin-pass").Code, http.StatusUnauthorized)
+
+	// failures lock username out, a success in between resets the count.
+	is.Equal(call("admin", "wrong").Code, http.StatusUnauthorized)
+	is.Equal(call("admin", "wrong").Code, http.StatusUnauthorized)
+	is.Equal(call("admin", "admin-pass").Code, http.StatusOK)
+	for range 3 {
+		is.Equal(call("admin", "wrong").Code, http.StatusUnauthorized)
+	}
+	w = call("admin", "admin-pass")
+	is.Equal(w.Code, http.StatusTooManyRequests)
+	is.Equal(w.Header().Get("Retry-After"), "60")
+	is.Equal(call("metrics", "metrics-pass").Code, http.StatusOK) // other users are not affected
+}
+
+func TestLoadCredentials(t *testing.T) {
+	is := is.New(t)
+	hash, err := HashPassword("secret")
+	is.NoErr(err)
+	ok, err := HashedCredentials{"user": hash}.Verify(context.Background(), "user", "secret")
+	is.NoErr(err)
+	is.True(ok)
+
+	t.Setenv("ADMIN_CREDENTIALS", "user:"+hash+"\nother:"+hash)
+	creds, err := CredentialsFromEnv("ADMIN_CREDENTIALS")
+	is.NoErr(err)
+	is.Equal(len(creds), 2)
+
+	for _, line := range []string{
+		"user:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "user:$apr1$salt$hash", "user:plain", "no-colon",
+		"user:$argon2id$v=19$m=1024,t=0,p=1$MDEyMzQ1Njc4OWFiY2RlZg$a2V5", "user:$argon2id$v=19$m=1024,t=1,p=0$MDEyMzQ1Njc4OWFiY2RlZg$a2V5",
+	} {
+		_, err := ParseHtpasswd(strings.NewReader(line))
+		is.True(err != nil) // line
+	}
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	is := is.New(t)
+	mux := NewServeMux()
+	mux.HandleFunc("GET /", func(r *Request) (Result, error) {
+		return Result{Body: r.Context().Value(IsAuthenticatedKey) == true}, nil
+	}, BasicAuthMiddleware("user", "pass"))
+	for creds, expected := range map[[2]string]string{{"user", "pass"}: "true", {"user", "pas"}: "false", {"use", "pass"}: "false"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(creds[0], creds[1])
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		is.Equal(strings.TrimSpace(w.Body.String()), expected)
+	}
+}
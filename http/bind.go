@@ -1,15 +1,276 @@
 package http
 
 import (
+	"encoding"
 	"errors"
+	"fmt"
+	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
+
+	pkgerrors "github.com/amirrezaask/pkg/errors"
+)
+
+// paramTags are struct tags that Bind reads from other places than request body, mapped to OpenAPI `in` values.
+var paramTags = []struct {
+	tag string
+	in  string
+}{
+	{"path", "path"},
+	{"query", "query"},
+	{"header", "header"},
+	{"cookie", "cookie"},
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
 )
 
+// Bind fills v from the request, fields tagged with `path`, `query`, `header` or `cookie` are read from
+// that part of the request and the rest is decoded from body using BindBody:
+//
+//	type input struct {
+//		ID      int           `path:"id"`
+//		Tags    []string      `query:"tag"`
+//		Since   time.Time     `query:"since" layout:"2006-01-02"`
+//		Timeout time.Duration `header:"X-Timeout" default:"5s"`
+//		Session string        `cookie:"session"`
+//		Paging                // embedded and nested structs are bound too.
+//	}
+//
+// Slices get every value of a repeated parameter, `default` is used when a field is not set by request,
+// defaults of slices are comma separated. time.Time fields are parsed with `layout` tag, RFC 3339 by default,
+// and `unix` layout reads seconds since epoch. Types implementing encoding.TextUnmarshaler are supported.
+// Parameters that cannot be converted are reported as a 400 *errors.HTTPError naming the field.
+func (r *Request) Bind(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("input should be a non nil pointer for Bind, got %T", v)
+	}
+	isStruct := rv.Elem().Kind() == reflect.Struct
+	if isStruct {
+		if err := applyDefaults(rv.Elem()); err != nil {
+			return err
+		}
+	}
+	// body is decoded first so it cannot override parameters.
+	if err := r.BindBody(v); err != nil {
+		return err
+	}
+	if !isStruct {
+		return nil
+	}
+
+	query := r.URL.Query()
+	return bindParams(rv.Elem(), func(in string, name string) []string {
+		switch in {
+		case "path":
+			if value := r.PathValue(name); value != "" {
+				return []string{value}
+			}
+		case "query":
+			return query[name]
+		case "header":
+			return r.Header.Values(name)
+		case "cookie":
+			var values []string
+			for _, cookie := range r.CookiesNamed(name) {
+				values = append(values, cookie.Value)
+			}
+			return values
+		}
+		return nil
+	})
+}
+
+func bindParams(rv reflect.Value, source func(in string, name string) []string) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		fv := rv.Field(i)
+		name, in := paramOf(field)
+		if in == "" {
+			if !isParamContainer(field) {
+				continue
+			}
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					if !fv.CanSet() {
+						continue
+					}
+					fv.Set(reflect.New(field.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := bindParams(fv, source); err != nil {
+				return err
+			}
+			continue
+		}
+
+		values := source(in, name)
+		if len(values) == 0 || !fv.CanSet() {
+			continue
+		}
+		if err := setField(fv, field, values); err != nil {
+			return pkgerrors.NewHTTPError(http.StatusBadRequest, "invalid_parameter", fmt.Sprintf("%s parameter '%s' cannot be parsed as %s", in, name, field.Type)).
+				With("field", name).
+				With("in", in).
+				Wrap(err)
+		}
+	}
+	return nil
+}
+
+// applyDefaults sets zero fields of rv that have a `default` tag.
+func applyDefaults(rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		fv := rv.Field(i)
+		if def, exists := field.Tag.Lookup("default"); exists {
+			if !fv.CanSet() || !fv.IsZero() {
+				continue
+			}
+			values := []string{def}
+			if indirectType(field.Type).Kind() == reflect.Slice || indirectType(field.Type).Kind() == reflect.Array {
+				values = strings.Split(def, ",")
+			}
+			if err := setField(fv, field, values); err != nil {
+				return fmt.Errorf("invalid default value '%s' for field %s: %w", def, field.Name, err)
+			}
+			continue
+		}
+		if fv.Kind() == reflect.Pointer {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && isPlainStruct(fv.Type()) {
+			if err := applyDefaults(fv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// paramOf returns name and location of field if it is bound from a request parameter.
+func paramOf(field reflect.StructField) (string, string) {
+	for _, pt := range paramTags {
+		if name := field.Tag.Get(pt.tag); name != "" {
+			return name, pt.in
+		}
+	}
+	return "", ""
+}
+
+// isParamContainer reports whether field is an embedded or nested struct that only groups parameter fields,
+// nested structs with a json tag are part of body.
+func isParamContainer(field reflect.StructField) bool {
+	if !field.Anonymous && (!field.IsExported() || field.Tag.Get("json") != "") {
+		return false
+	}
+	if _, in := paramOf(field); in != "" {
+		return false
+	}
+	return hasParamFields(indirectType(field.Type), map[reflect.Type]bool{})
+}
+
+func hasParamFields(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if t.Kind() != reflect.Struct || !isPlainStruct(t) || seen[t] {
+		return false
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, in := paramOf(field); in != "" {
+			return true
+		}
+		if (field.Anonymous || field.Tag.Get("json") == "") && hasParamFields(indirectType(field.Type), seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPlainStruct reports whether struct t is bound field by field instead of being parsed from text.
+func isPlainStruct(t reflect.Type) bool {
+	return t != timeType && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// setField converts values to type of fv, slices and arrays get every value and other types get the first one.
+func setField(fv reflect.Value, field reflect.StructField, values []string) error {
+	t := fv.Type()
+	switch {
+	case t.Kind() == reflect.Pointer:
+		ptr := reflect.New(t.Elem())
+		if err := setField(ptr.Elem(), field, values); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	case t == timeType:
+		layout := field.Tag.Get("layout")
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		if layout == "unix" {
+			sec, err := strconv.ParseInt(values[0], 10, 64)
+			if err != nil {
+				return err
+			}
+			fv.Set(reflect.ValueOf(time.Unix(sec, 0)))
+			return nil
+		}
+		tm, err := time.Parse(layout, values[0])
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(tm))
+		return nil
+	case t == durationType:
+		d, err := time.ParseDuration(values[0])
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	case reflect.PointerTo(t).Implements(textUnmarshalerType):
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0]))
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+		slice := reflect.MakeSlice(t, len(values), len(values))
+		for i, value := range values {
+			if err := setField(slice.Index(i), field, []string{value}); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	case t.Kind() == reflect.Array:
+		if len(values) > t.Len() {
+			return fmt.Errorf("expected at most %d values, got %d", t.Len(), len(values))
+		}
+		for i, value := range values {
+			if err := setField(fv.Index(i), field, []string{value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return setWithProperType(t.Kind(), values[0], fv)
+}
+
 func setWithProperType(valueKind reflect.Kind, val string, structField reflect.Value) error {
 	switch valueKind {
-	case reflect.Ptr:
-		return setWithProperType(structField.Elem().Kind(), val, structField.Elem())
 	case reflect.Int:
 		return setIntField(val, 0, structField)
 	case reflect.Int8:
@@ -39,7 +300,7 @@ func setWithProperType(valueKind reflect.Kind, val string, structField reflect.V
 	case reflect.String:
 		structField.SetString(val)
 	default:
-		return errors.New("unknown type")
+		return errors.New("unsupported type " + structField.Type().String())
 	}
 	return nil
 }
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestBind(t *testing.T) {
+	is := is.New(t)
+	type paging struct {
+		Page    int `query:"page" default:"1"`
+		PerPage int `query:"per_page" default:"20"`
+	}
+	type filters struct {
+		Tags []string `query:"tag"`
+	}
+	type input struct {
+		ID      uint64        `path:"id"`
+		IDs     [2]int        `query:"ids"`
+		Since   time.Time     `query:"since" layout:"2006-01-02"`
+		Until   time.Time     `query:"until" layout:"unix"`
+		Timeout time.Duration `header:"X-Timeout" default:"5s"`
+		Session *string       `cookie:"session"`
+		IP      net.IP        `header:"X-Client-IP"`
+		Levels  []int         `query:"level" default:"1,2"`
+		Name    string        `json:"name"`
+		paging
+		Filters *filters
+	}
+
+	mux := NewServeMux()
+	var got input
+	mux.HandleFunc("POST /items/{id}", func(r *Request, in *input) (input, error) {
+		got = *in
+		return *in, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/items/7?ids=1&ids=2&since=2024-02-03&until=60&tag=a&tag=b&page=3", strings.NewReader(`{"name": "n"}`))
+	is.NoErr(err)
+	req.Header.Set("X-Client-IP", "10.0.0.1")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s"})
+	resp, err := http.DefaultClient.Do(req)
+	is.NoErr(err)
+	resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusOK)
+
+	is.Equal(got.ID, uint64(7))
+	is.Equal(got.IDs, [2]int{1, 2})
+	is.Equal(got.Since, time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC))
+	is.Equal(got.Until.Unix(), int64(60))
+	is.Equal(got.Timeout, 5*time.Second)
+	is.Equal(*got.Session, "s")
+	is.Equal(got.IP.String(), "10.0.0.1")
+	is.Equal(got.Levels, []int{1, 2})
+	is.Equal(got.Name, "n")
+	is.Equal(got.Page, 3)
+	is.Equal(got.PerPage, 20)
+	is.Equal(got.Filters.Tags, []string{"a", "b"})
+
+	resp, err = http.Post(srv.URL+"/items/7?page=abc", "application/json", nil)
+	is.NoErr(err)
+	defer resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusBadRequest)
+	var problem map[string]any
+	is.NoErr(json.NewDecoder(resp.Body).Decode(&problem))
+	is.Equal(problem["field"], "page")
+	is.Equal(problem["in"], "query")
+
+	var notStruct []int
+	r := &Request{httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`[1, 2]`))}
+	is.NoErr(r.Bind(&notStruct))
+	is.Equal(notStruct, []int{1, 2})
+}
@@ -0,0 +1,38 @@
+package http
+
+import (
+	"encoding/json"
+
+	"github.com/amirrezaask/pkg/errors"
+)
+
+// decodeCached decodes a json string stored in a Cacher into v, it handles values as returned by different cachers:
+// memory cacher returns the stored string, redis cacher returns the ptr it scanned into and sql cacher returns
+// the json it encoded the string into.
+func decodeCached(cached any, v any) error {
+	var bs []byte
+	switch c := cached.(type) {
+	case string:
+		bs = []byte(c)
+	case *string:
+		bs = []byte(*c)
+	case []byte:
+		bs = c
+	case *[]byte:
+		bs = *c
+	default:
+		return errors.Newf("unexpected cached value of type %T", cached)
+	}
+	if len(bs) > 0 && bs[0] == '"' {
+		var s string
+		if err := json.Unmarshal(bs, &s); err != nil {
+			return err
+		}
+		bs = []byte(s)
+	}
+	if s, isString := v.(*string); isString {
+		*s = string(bs)
+		return nil
+	}
+	return json.Unmarshal(bs, v)
+}
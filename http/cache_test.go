@@ -0,0 +1,26 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestDecodeCached(t *testing.T) {
+	is := is.New(t)
+	raw := `{"fingerprint":"abc","status":201,"header":null,"body":"aGk="}`
+	quoted := `"{\"fingerprint\":\"abc\",\"status\":201,\"header\":null,\"body\":\"aGk=\"}"`
+	bs := []byte(raw)
+	for _, cached := range []any{raw, &raw, bs, &bs, quoted} {
+		var stored idempotentResponse
+		is.NoErr(decodeCached(cached, &stored))
+		is.Equal(stored.Status, 201)
+		is.Equal(string(stored.Body), "hi")
+	}
+	for _, cached := range []any{"version", `"version"`} {
+		var version string
+		is.NoErr(decodeCached(cached, &version))
+		is.Equal(version, "version")
+	}
+	is.True(decodeCached(42, &bs) != nil)
+}
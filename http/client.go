@@ -6,6 +6,7 @@ import (
 	"path"
 	"time"
 
+	"github.com/amirrezaask/pkg/logging"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -36,15 +37,21 @@ type transport struct {
 }
 
 func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, span := startClientSpan(req)
+	if id := logging.RequestID(req.Context()); id != "" && req.Header.Get(RequestIDHeader) == "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
 	startTime := time.Now()
 	resp, err := t.stdTransport.RoundTrip(req)
+	endClientSpan(span, resp, err)
 
 	if t.httpRequestDurationH != nil {
 		statusCode := -1
 		if resp != nil {
 			statusCode = resp.StatusCode
 		}
-		t.httpRequestDurationH.WithLabelValues(req.Method, req.URL.Host, path.Dir(req.URL.Path), fmt.Sprint(statusCode)).Observe(time.Since(startTime).Seconds())
+		observeWithTrace(req.Context(), t.httpRequestDurationH.WithLabelValues(req.Method, req.URL.Host, path.Dir(req.URL.Path), fmt.Sprint(statusCode)),
+			time.Since(startTime).Seconds())
 	}
 
 	return resp, err
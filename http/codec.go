@@ -0,0 +1,276 @@
+package http
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/amirrezaask/pkg/http/openapi"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// DecodeFunc decodes body of r into v.
+type DecodeFunc func(r *http.Request, v any) error
+
+// EncodeFunc encodes v into w.
+type EncodeFunc func(w io.Writer, v any) error
+
+// DefaultMediaType is used to decode requests without Content-Type and to encode responses when client accepts anything.
+const DefaultMediaType = "application/json"
+
+// maxMultipartMemory is the number of bytes of a multipart body that are kept in memory, rest is stored in temporary files.
+const maxMultipartMemory = 32 << 20
+
+var (
+	codecsMu sync.RWMutex
+	decoders = map[string]DecodeFunc{
+		"application/json":                  decodeJSON,
+		"application/xml":                   decodeXML,
+		"text/xml":                          decodeXML,
+		"application/x-www-form-urlencoded": decodeForm,
+		"multipart/form-data":               decodeMultipart,
+		"application/msgpack":               decodeMsgpack,
+		"application/x-msgpack":             decodeMsgpack,
+		"application/vnd.msgpack":           decodeMsgpack,
+	}
+	// xml is not encoded by default, browsers accept it before */* and encoding/xml cannot encode maps,
+	// register EncodeXML to serve it.
+	encoders = map[string]EncodeFunc{
+		"application/json":        encodeJSON,
+		"application/msgpack":     encodeMsgpack,
+		"application/x-msgpack":   encodeMsgpack,
+		"application/vnd.msgpack": encodeMsgpack,
+	}
+)
+
+// RegisterDecoder sets decoder of request bodies with given media type, registering an existing media type replaces it.
+func RegisterDecoder(mediaType string, fn DecodeFunc) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	decoders[strings.ToLower(mediaType)] = fn
+}
+
+// RegisterEncoder sets encoder of responses with given media type, registering an existing media type replaces it.
+func RegisterEncoder(mediaType string, fn EncodeFunc) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	encoders[strings.ToLower(mediaType)] = fn
+}
+
+func decoderFor(contentType string) (DecodeFunc, error) {
+	if contentType == "" {
+		contentType = DefaultMediaType
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errors.NewHTTPError(http.StatusUnsupportedMediaType, "unsupported_media_type", fmt.Sprintf("Content-Type '%s' is not valid", contentType)).Wrap(err)
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	decode, exists := decoders[mediaType]
+	if !exists {
+		return nil, errors.NewHTTPError(http.StatusUnsupportedMediaType, "unsupported_media_type", fmt.Sprintf("Content-Type '%s' is not supported", mediaType))
+	}
+	return decode, nil
+}
+
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// negotiate picks the encoder that best matches accept header, q values and specificity of media ranges are respected.
+func negotiate(accept string) (string, EncodeFunc, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if strings.TrimSpace(accept) == "" {
+		return DefaultMediaType, encoders[DefaultMediaType], true
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, subtype, _ := strings.Cut(mediaType, "/")
+		q := 1.0
+		if qv, exists := params["q"]; exists {
+			if q, err = strconv.ParseFloat(qv, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+	}
+	specificity := func(m mediaRange) int {
+		switch {
+		case m.typ == "*":
+			return 0
+		case m.subtype == "*":
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return specificity(ranges[i]) > specificity(ranges[j])
+	})
+
+	for _, m := range ranges {
+		if m.q <= 0 {
+			continue
+		}
+		switch {
+		case m.typ == "*":
+			return DefaultMediaType, encoders[DefaultMediaType], true
+		case m.subtype == "*":
+			if strings.HasPrefix(DefaultMediaType, m.typ+"/") {
+				return DefaultMediaType, encoders[DefaultMediaType], true
+			}
+			for _, mediaType := range registeredMediaTypes(encoders) {
+				if strings.HasPrefix(mediaType, m.typ+"/") {
+					return mediaType, encoders[mediaType], true
+				}
+			}
+		default:
+			mediaType := m.typ + "/" + m.subtype
+			if encode, exists := encoders[mediaType]; exists {
+				return mediaType, encode, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// registeredMediaTypes returns sorted keys of a codec registry, caller should hold codecsMu.
+func registeredMediaTypes[T any](registry map[string]T) []string {
+	mediaTypes := make([]string, 0, len(registry))
+	for mediaType := range registry {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	slices.Sort(mediaTypes)
+	return mediaTypes
+}
+
+// openAPIContent describes schema with every media type of registry.
+func openAPIContent[T any](registry map[string]T, schema *openapi.Schema) map[string]openapi.MediaType {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	content := map[string]openapi.MediaType{}
+	for _, mediaType := range registeredMediaTypes(registry) {
+		content[mediaType] = openapi.MediaType{Schema: schema}
+	}
+	return content
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+func encodeJSON(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func decodeXML(r *http.Request, v any) error {
+	return xml.NewDecoder(r.Body).Decode(v)
+}
+
+// EncodeXML encodes v with encoding/xml, eg: RegisterEncoder("application/xml", EncodeXML).
+func EncodeXML(w io.Writer, v any) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func decodeMsgpack(r *http.Request, v any) error {
+	dec := msgpack.NewDecoder(r.Body)
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func encodeMsgpack(w io.Writer, v any) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(v)
+}
+
+func decodeForm(r *http.Request, v any) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	return bindForm(r.PostForm, nil, v)
+}
+
+func decodeMultipart(r *http.Request, v any) error {
+	if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+		return err
+	}
+	return bindForm(r.MultipartForm.Value, r.MultipartForm.File, v)
+}
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+// bindForm fills v from form values, fields are matched by their `form` tag or json name.
+// *multipart.FileHeader and []*multipart.FileHeader fields are filled from files.
+func bindForm(values url.Values, files map[string][]*multipart.FileHeader, v any) error {
+	if vs, isValues := v.(*url.Values); isValues {
+		*vs = values
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("form can only be decoded into a struct pointer, got %T", v)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if _, in := paramOf(field); in != "" || !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("form")
+		if name == "" {
+			var skip bool
+			name, _, skip = openapi.JSONFieldName(field)
+			if skip {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+		}
+		switch field.Type {
+		case fileHeaderType:
+			if fhs := files[name]; len(fhs) > 0 {
+				rv.Field(i).Set(reflect.ValueOf(fhs[0]))
+			}
+			continue
+		case fileHeadersType:
+			rv.Field(i).Set(reflect.ValueOf(files[name]))
+			continue
+		}
+		vs, exists := values[name]
+		if !exists {
+			continue
+		}
+		if err := setField(rv.Field(i), field, vs); err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	return nil
+}
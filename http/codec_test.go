@@ -0,0 +1,134 @@
+package http
+
+import (
+	"bytes"
+	"encoding/xml"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// registerTestEncoder registers fn for mediaType until t ends.
+func registerTestEncoder(t *testing.T, mediaType string, fn EncodeFunc) {
+	RegisterEncoder(mediaType, fn)
+	t.Cleanup(func() {
+		codecsMu.Lock()
+		defer codecsMu.Unlock()
+		delete(encoders, mediaType)
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	is := is.New(t)
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	mediaType, _, ok := negotiate(browser)
+	is.True(ok)
+	is.Equal(mediaType, "application/json") // xml is not encoded unless registered
+
+	registerTestEncoder(t, "application/xml", EncodeXML)
+	registerTestEncoder(t, "text/xml", EncodeXML)
+	for accept, expected := range map[string]string{
+		"":                                     "application/json",
+		"*/*":                                  "application/json",
+		"application/xml":                      "application/xml",
+		"text/html, application/xml;q=0.9":     "application/xml",
+		"application/json;q=0.5, text/xml":     "text/xml",
+		"application/*;q=0.1, text/xml;q=0":    "application/json",
+		"application/msgpack;q=1, */*;q=0.2":   "application/msgpack",
+		"application/x-msgpack":                "application/x-msgpack",
+		"application/vnd.msgpack":              "application/vnd.msgpack",
+		"text/html, application/json;q=0, */*": "application/json",
+	} {
+		mediaType, _, ok := negotiate(accept)
+		is.True(ok)
+		is.Equal(mediaType, expected)
+	}
+	_, _, ok = negotiate("text/html, application/json;q=0")
+	is.True(!ok)
+}
+
+func TestServerCodecs(t *testing.T) {
+	is := is.New(t)
+	registerTestEncoder(t, "application/xml", EncodeXML)
+	type input struct {
+		XMLName xml.Name `json:"-" xml:"input"`
+		Name    string   `json:"name" xml:"name"`
+		Tags    []string `json:"tags" xml:"tag"`
+		File    *multipart.FileHeader
+	}
+	type output struct {
+		XMLName  xml.Name `json:"-" xml:"output"`
+		Name     string   `json:"name" xml:"name"`
+		Tags     []string `json:"tags" xml:"tag"`
+		FileName string   `json:"file_name" xml:"file_name"`
+	}
+	mux := NewServeMux()
+	mux.HandleFunc("POST /echo", func(r *Request, in *input) (output, error) {
+		out := output{Name: in.Name, Tags: in.Tags}
+		if in.File != nil {
+			out.FileName = in.File.Filename
+		}
+		return out, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	do := func(contentType string, accept string, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/echo", strings.NewReader(body))
+		is.NoErr(err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		is.NoErr(err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	decode := func(resp *http.Response, unmarshal func([]byte, any) error) output {
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		var out output
+		is.NoErr(unmarshal(buf.Bytes(), &out))
+		return out
+	}
+
+	resp := do("application/json; charset=utf-8", "application/xml", `{"name": "n", "tags": ["a", "b"]}`)
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.Equal(resp.Header.Get("Content-Type"), "application/xml")
+	is.Equal(resp.Header.Get("Vary"), "Accept")
+	is.Equal(decode(resp, xml.Unmarshal), output{XMLName: xml.Name{Local: "output"}, Name: "n", Tags: []string{"a", "b"}})
+
+	resp = do("application/xml", "application/msgpack", `<input><name>x</name><tag>c</tag></input>`)
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.Equal(decode(resp, func(bs []byte, v any) error {
+		dec := msgpack.NewDecoder(bytes.NewReader(bs))
+		dec.SetCustomStructTag("json")
+		return dec.Decode(v)
+	}).Name, "x")
+
+	resp = do("application/x-www-form-urlencoded", "", "name=f&tags=a&tags=b")
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.Equal(resp.Header.Get("Content-Type"), "application/json")
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "m")
+	fw, _ := mw.CreateFormFile("File", "avatar.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+	resp = do(mw.FormDataContentType(), "application/xml", body.String())
+	is.Equal(resp.StatusCode, http.StatusOK)
+	out := decode(resp, xml.Unmarshal)
+	is.Equal(out.Name, "m")
+	is.Equal(out.FileName, "avatar.png")
+
+	resp = do("text/csv", "", "a,b")
+	is.Equal(resp.StatusCode, http.StatusUnsupportedMediaType)
+
+	resp = do("application/json", "text/html", `{"name": "n"}`)
+	is.Equal(resp.StatusCode, http.StatusNotAcceptable)
+}
@@ -0,0 +1,292 @@
+package http
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingZstd    = "zstd"
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+const (
+	// DefaultCompressionMinSize is the smallest body worth compressing, smaller bodies are sent as is.
+	DefaultCompressionMinSize = 1024
+	// DefaultMaxDecompressedSize limits request bodies after decompression.
+	DefaultMaxDecompressedSize = 10 << 20
+)
+
+// DefaultUncompressedTypes are prefixes of content types that are already compressed.
+var DefaultUncompressedTypes = []string{
+	"image/", "video/", "audio/", "font/woff",
+	"application/zip", "application/gzip", "application/zstd", "application/x-7z-compressed", "application/x-rar-compressed",
+	"application/octet-stream", "application/pdf", "application/wasm",
+}
+
+type CompressionConfig struct {
+	// Encodings in order of server preference, used to break ties between equally preferred encodings of client.
+	// Defaults to zstd, gzip and deflate.
+	Encodings []string
+	// MinSize is the smallest body that gets compressed, DefaultCompressionMinSize when zero.
+	MinSize int
+	// UncompressedTypes are content type prefixes that are never compressed, DefaultUncompressedTypes when nil.
+	UncompressedTypes []string
+	// DecompressRequests decodes request bodies sent with `Content-Encoding: gzip`.
+	DecompressRequests bool
+	// MaxDecompressedSize limits decompressed request bodies, DefaultMaxDecompressedSize when zero.
+	MaxDecompressedSize int64
+}
+
+// compressor is implemented by writers of every supported encoding.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var compressors = map[string]*sync.Pool{
+	EncodingGzip: {New: func() any { return gzip.NewWriter(nil) }},
+	EncodingDeflate: {New: func() any {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}},
+	EncodingZstd: {New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return w
+	}},
+}
+
+// CompressionMiddleware compresses responses with the encoding negotiated from Accept-Encoding.
+// Bodies are buffered until MinSize, so small responses, responses that already have a Content-Encoding
+// and already compressed content types are sent as is. Flushing before MinSize, like event streams do,
+// starts compression right away and every flush also flushes the compressor.
+func CompressionMiddleware(cfg CompressionConfig) MiddlewareFunc {
+	if len(cfg.Encodings) == 0 {
+		cfg.Encodings = []string{EncodingZstd, EncodingGzip, EncodingDeflate}
+	}
+	if cfg.MinSize == 0 {
+		cfg.MinSize = DefaultCompressionMinSize
+	}
+	if cfg.UncompressedTypes == nil {
+		cfg.UncompressedTypes = DefaultUncompressedTypes
+	}
+	if cfg.MaxDecompressedSize == 0 {
+		cfg.MaxDecompressedSize = DefaultMaxDecompressedSize
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.DecompressRequests && strings.EqualFold(r.Header.Get("Content-Encoding"), EncodingGzip) {
+				gz, err := gzip.NewReader(r.Body)
+				if err != nil {
+					writeError(w, r, errors.NewHTTPError(http.StatusBadRequest, "invalid_body", "request body is not valid gzip").Wrap(err))
+					return
+				}
+				defer gz.Close()
+				r.Body = http.MaxBytesReader(w, gz, cfg.MaxDecompressedSize)
+				r.ContentLength = -1
+				r.Header.Del("Content-Encoding")
+				r.Header.Del("Content-Length")
+			}
+
+			// upgraded connections are not http responses anymore.
+			if r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), cfg.Encodings)
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, cfg: &cfg}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks the encoding client prefers the most, ties are broken by order of supported.
+// It returns empty string when response should not be encoded.
+func negotiateEncoding(acceptEncoding string, supported []string) string {
+	best, bestQ := "", 0.0
+	quality := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		quality[name] = q
+	}
+	for _, encoding := range supported {
+		q, listed := quality[encoding]
+		if !listed {
+			q = max(wildcard, 0)
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the body until it knows whether it's worth compressing, status is held back
+// until then so headers can still be changed.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	cfg      *CompressionConfig
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     compressor
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if status < 200 {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if c.status != 0 {
+		return
+	}
+	c.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		c.decide(false)
+	}
+}
+
+func (c *compressWriter) Write(bs []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if !c.decided {
+		if length, err := strconv.Atoi(c.Header().Get("Content-Length")); err == nil && length < c.cfg.MinSize {
+			c.decide(false)
+		} else if len(c.buf)+len(bs) < c.cfg.MinSize {
+			c.buf = append(c.buf, bs...)
+			return len(bs), nil
+		} else {
+			c.buf = append(c.buf, bs...)
+			if err := c.decide(true); err != nil {
+				return 0, err
+			}
+			return len(bs), nil
+		}
+	}
+	if c.enc != nil {
+		return c.enc.Write(bs)
+	}
+	return c.ResponseWriter.Write(bs)
+}
+
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		c.decide(true)
+	}
+	if c.enc != nil {
+		c.enc.Flush()
+	}
+	http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(c.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach features of the underlying writer.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// decide writes the held back status and buffered body, compressing them when compress is true and response is eligible.
+func (c *compressWriter) decide(compress bool) error {
+	c.decided = true
+	header := c.Header()
+	// net/http would sniff compressed bytes otherwise.
+	if compress && header.Get("Content-Type") == "" {
+		if len(c.buf) == 0 {
+			compress = false
+		} else {
+			header.Set("Content-Type", http.DetectContentType(c.buf))
+		}
+	}
+	if compress && c.eligible() {
+		c.enc = compressors[c.encoding].Get().(compressor)
+		c.enc.Reset(c.ResponseWriter)
+		header.Set("Content-Encoding", c.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		// compressed representation is not byte for byte equal to the uncompressed one.
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+	}
+	if c.status != 0 {
+		c.ResponseWriter.WriteHeader(c.status)
+	}
+	if len(c.buf) == 0 {
+		return nil
+	}
+	var err error
+	if c.enc != nil {
+		_, err = c.enc.Write(c.buf)
+	} else {
+		_, err = c.ResponseWriter.Write(c.buf)
+	}
+	c.buf = nil
+	return err
+}
+
+func (c *compressWriter) eligible() bool {
+	header := c.Header()
+	if header.Get("Content-Encoding") != "" || strings.Contains(header.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	return !slices.ContainsFunc(c.cfg.UncompressedTypes, func(prefix string) bool {
+		return strings.HasPrefix(contentType, prefix)
+	})
+}
+
+func (c *compressWriter) close() {
+	if !c.decided {
+		c.decide(false)
+	}
+	if c.enc != nil {
+		c.enc.Close()
+		compressors[c.encoding].Put(c.enc)
+		c.enc = nil
+	}
+}
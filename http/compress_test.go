@@ -0,0 +1,173 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/matryer/is"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	is := is.New(t)
+	supported := []string{EncodingZstd, EncodingGzip, EncodingDeflate}
+	for accept, expected := range map[string]string{
+		"":                             "",
+		"identity":                     "",
+		"gzip":                         "gzip",
+		"gzip, deflate, br, zstd":      "zstd",
+		"gzip;q=1, zstd;q=0.5":         "gzip",
+		"*":                            "zstd",
+		"*, zstd;q=0":                  "gzip",
+		"deflate;q=0.1, GZIP;q=0.2":    "gzip",
+		"gzip;q=0, deflate;q=0, *;q=0": "",
+	} {
+		is.Equal(negotiateEncoding(accept, supported), expected) // accept
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	is := is.New(t)
+	type item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	var items []item
+	for i := range 200 {
+		items = append(items, item{ID: i, Name: "item"})
+	}
+
+	mux := NewServeMux()
+	mux.UseMiddlewares(PrometheusExporterMiddleware("compress_test"), CompressionMiddleware(CompressionConfig{DecompressRequests: true, MaxDecompressedSize: 64}))
+	mux.HandleFunc("GET /items", func(r *Request) (Result, error) {
+		return Result{Body: items}, nil
+	})
+	mux.HandleFunc("GET /small", func(r *Request) (Result, error) {
+		return Result{Body: "small"}, nil
+	})
+	mux.HandleFunc("GET /image", func(r *Request) (Result, error) {
+		return Result{Header: http.Header{"Content-Type": {"image/png"}}, Body: bytes.NewReader(make([]byte, 4096))}, nil
+	})
+	mux.HandleFunc("GET /reader", func(r *Request) (Result, error) {
+		return Result{Status: http.StatusCreated, Body: strings.NewReader(strings.Repeat("streamed ", 1000))}, nil
+	})
+	mux.HandleFunc("GET /events", func(r *Request) (Result, error) {
+		return Result{Body: NewEventStream(func(yield func(Event) bool) {
+			yield(Event{Data: "first"})
+			<-r.Context().Done()
+		})}, nil
+	})
+	mux.HandleFunc("POST /echo", func(r *Request) (Result, error) {
+		var in map[string]string
+		if err := r.BindBody(&in); err != nil {
+			return Result{}, err
+		}
+		return Result{Body: in}, nil
+	})
+
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		return do(req)
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		is := is.New(t)
+		w := get("/items", "gzip")
+		is.Equal(w.Code, http.StatusOK)
+		is.Equal(w.Header().Get("Content-Encoding"), "gzip")
+		is.Equal(w.Header().Get("Content-Type"), "application/json")
+		is.True(slices.Contains(w.Header().Values("Vary"), "Accept-Encoding"))
+		gz, err := gzip.NewReader(w.Body)
+		is.NoErr(err)
+		bs, err := io.ReadAll(gz)
+		is.NoErr(err)
+		is.True(strings.HasPrefix(string(bs), `[{"id":0,"name":"item"}`))
+	})
+
+	t.Run("zstd reader body keeps status", func(t *testing.T) {
+		is := is.New(t)
+		w := get("/reader", "gzip, zstd")
+		is.Equal(w.Code, http.StatusCreated)
+		is.Equal(w.Header().Get("Content-Encoding"), "zstd")
+		dec, err := zstd.NewReader(w.Body)
+		is.NoErr(err)
+		defer dec.Close()
+		bs, err := io.ReadAll(dec)
+		is.NoErr(err)
+		is.Equal(len(bs), len("streamed ")*1000)
+	})
+
+	t.Run("skipped", func(t *testing.T) {
+		is := is.New(t)
+		w := get("/small", "gzip")
+		is.Equal(w.Header().Get("Content-Encoding"), "")
+		is.Equal(strings.TrimSpace(w.Body.String()), `"small"`)
+		is.True(slices.Contains(w.Header().Values("Vary"), "Accept-Encoding"))
+
+		w = get("/image", "gzip")
+		is.Equal(w.Header().Get("Content-Encoding"), "")
+		is.Equal(w.Body.Len(), 4096)
+
+		w = get("/items", "identity")
+		is.Equal(w.Header().Get("Content-Encoding"), "")
+	})
+
+	t.Run("event stream is flushed", func(t *testing.T) {
+		is := is.New(t)
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/events", nil)
+		is.NoErr(err)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := (&http.Client{Transport: &http.Transport{DisableCompression: true}, Timeout: 5 * time.Second}).Do(req)
+		is.NoErr(err)
+		defer resp.Body.Close()
+		is.Equal(resp.Header.Get("Content-Encoding"), "gzip")
+		is.Equal(resp.Header.Get("Content-Type"), "text/event-stream")
+		gz, err := gzip.NewReader(resp.Body)
+		is.NoErr(err)
+		line, err := bufio.NewReader(gz).ReadString('\n')
+		is.NoErr(err)
+		is.Equal(line, "data: first\n")
+	})
+
+	t.Run("gzip request body", func(t *testing.T) {
+		is := is.New(t)
+		compressed := func(body string) io.Reader {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write([]byte(body))
+			gz.Close()
+			return &buf
+		}
+		req := httptest.NewRequest(http.MethodPost, "/echo", compressed(`{"name":"gopher"}`))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := do(req)
+		is.Equal(w.Code, http.StatusOK)
+		is.Equal(strings.TrimSpace(w.Body.String()), `{"name":"gopher"}`)
+
+		req = httptest.NewRequest(http.MethodPost, "/echo", compressed(`{"name":"`+strings.Repeat("a", 100)+`"}`))
+		req.Header.Set("Content-Encoding", "gzip")
+		w = do(req)
+		is.Equal(w.Code, http.StatusRequestEntityTooLarge)
+
+		req = httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("not gzip"))
+		req.Header.Set("Content-Encoding", "gzip")
+		w = do(req)
+		is.Equal(w.Code, http.StatusBadRequest)
+	})
+}
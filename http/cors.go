@@ -0,0 +1,210 @@
+package http
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type CORSConfig struct {
+	// AllowedOrigins contains exact origins like "https://example.com", wildcard subdomain patterns like
+	// "https://*.example.com" or "*" to allow every origin.
+	AllowedOrigins []string
+	// AllowedMethods limits methods of cross origin requests, by default every method that is registered
+	// for the path is allowed when used with ServeMux.UseCORS and common methods otherwise.
+	AllowedMethods []string
+	// AllowedHeaders are request headers clients can send, requested headers are allowed when empty.
+	AllowedHeaders []string
+	// ExposedHeaders are response headers that browser scripts can read.
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and authorization, allowed origin is echoed instead of "*".
+	// It cannot be used with "*" origin, since any site could make authenticated requests.
+	AllowCredentials bool
+	// MaxAge is how long browsers can cache a preflight response.
+	MaxAge time.Duration
+}
+
+type cors struct {
+	CORSConfig
+	allowAll bool
+}
+
+func newCORS(cfg CORSConfig) *cors {
+	c := &cors{CORSConfig: cfg}
+	c.AllowedOrigins = slices.Clone(cfg.AllowedOrigins)
+	c.AllowedMethods = slices.Clone(cfg.AllowedMethods)
+	for i, origin := range cfg.AllowedOrigins {
+		c.AllowedOrigins[i] = strings.ToLower(origin)
+		c.allowAll = c.allowAll || origin == "*"
+	}
+	for i, method := range cfg.AllowedMethods {
+		c.AllowedMethods[i] = strings.ToUpper(method)
+	}
+	if c.allowAll && c.AllowCredentials {
+		panic("cors cannot allow credentials for every origin, list allowed origins instead of \"*\"")
+	}
+	return c
+}
+
+// CORSMiddleware handles CORS for handlers it wraps, preflights only reach it if handler matches OPTIONS requests,
+// so for ServeMux routes prefer ServeMux.UseCORS.
+func CORSMiddleware(cfg CORSConfig) MiddlewareFunc {
+	c := newCORS(cfg)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPreflight(r) {
+				c.preflight(w, r, c.methods(nil))
+				return
+			}
+			c.setHeaders(w, r)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UseCORS handles CORS for every request before routing. Preflight requests are answered by the mux
+// with methods of patterns that match the path, eg: "POST /users" and "GET /users" allow POST and GET on /users.
+func (s *ServeMux) UseCORS(cfg CORSConfig) {
+	s.cors = newCORS(cfg)
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// serveCORS applies CORS to r, it returns true when r was a preflight and is already answered.
+func (s *ServeMux) serveCORS(w http.ResponseWriter, r *http.Request) bool {
+	if !isPreflight(r) {
+		s.cors.setHeaders(w, r)
+		return false
+	}
+	// requested method is probed too, so methods that are allowed but not among the defaults are found.
+	candidates := s.cors.methods(nil)
+	if requested := r.Header.Get("Access-Control-Request-Method"); !slices.Contains(candidates, requested) {
+		candidates = append(slices.Clone(candidates), requested)
+	}
+	var registered []string
+	for _, method := range candidates {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := s.ServeMux.Handler(probe); pattern != "" {
+			registered = append(registered, method)
+		}
+	}
+	// unknown paths are left to the mux, so they still get a 404.
+	if len(registered) == 0 {
+		return false
+	}
+	s.cors.preflight(w, r, s.cors.methods(registered))
+	return true
+}
+
+// methods returns allowed methods out of registered ones, nil registered means every method.
+func (c *cors) methods(registered []string) []string {
+	allowed := c.AllowedMethods
+	if len(allowed) == 0 {
+		allowed = defaultCORSMethods
+	}
+	if registered == nil {
+		return allowed
+	}
+	var methods []string
+	for _, method := range registered {
+		if slices.Contains(allowed, method) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+func (c *cors) originAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	if c.allowAll && origin != "null" {
+		return true
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			continue
+		}
+		if allowed == origin {
+			return true
+		}
+		prefix, suffix, isPattern := strings.Cut(allowed, "*")
+		if !isPattern || len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+			continue
+		}
+		// wildcard only stands for subdomain labels.
+		if sub := origin[len(prefix) : len(origin)-len(suffix)]; !strings.ContainsAny(sub, "/:@?#") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cors) allowOrigin(w http.ResponseWriter, origin string) {
+	header := w.Header()
+	if c.allowAll {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) setHeaders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	if !c.originAllowed(origin) {
+		return
+	}
+	c.allowOrigin(w, origin)
+	if len(c.ExposedHeaders) > 0 {
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+	}
+}
+
+// preflight answers r with 204, CORS headers are left out when origin, method or headers are not allowed.
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request, methods []string) {
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	defer w.WriteHeader(http.StatusNoContent)
+
+	origin := r.Header.Get("Origin")
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !c.originAllowed(origin) || !slices.Contains(methods, method) {
+		return
+	}
+	var requested []string
+	for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			requested = append(requested, h)
+		}
+	}
+	if len(c.AllowedHeaders) > 0 {
+		for _, h := range requested {
+			if !slices.ContainsFunc(c.AllowedHeaders, func(allowed string) bool { return strings.EqualFold(allowed, h) }) {
+				return
+			}
+		}
+	}
+
+	c.allowOrigin(w, origin)
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(requested) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if c.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+	}
+}
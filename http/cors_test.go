@@ -0,0 +1,156 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestCORS(t *testing.T) {
+	is := is.New(t)
+	mux := NewServeMux()
+	mux.UseCORS(CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Total"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	mux.HandleFunc("GET /users", func(r *Request) (Result, error) {
+		return Result{Body: "users"}, nil
+	})
+	mux.HandleFunc("POST /users", func(r *Request) (Result, error) {
+		return Result{Body: "created"}, nil
+	})
+	mux.HandleFunc("DELETE /users/{id}", func(r *Request) (Result, error) {
+		return Result{}, nil
+	})
+
+	do := func(method, path, origin string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		is := is.New(t)
+		w := do(http.MethodOptions, "/users", "https://app.example.com", map[string]string{
+			"Access-Control-Request-Method":  "POST",
+			"Access-Control-Request-Headers": "content-type",
+		})
+		is.Equal(w.Code, http.StatusNoContent)
+		is.Equal(w.Header().Get("Access-Control-Allow-Origin"), "https://app.example.com")
+		is.Equal(w.Header().Get("Access-Control-Allow-Credentials"), "true")
+		is.Equal(w.Header().Get("Access-Control-Allow-Methods"), "GET, HEAD, POST")
+		is.Equal(w.Header().Get("Access-Control-Allow-Headers"), "content-type")
+		is.Equal(w.Header().Get("Access-Control-Max-Age"), "600")
+
+		w = do(http.MethodOptions, "/users/1", "https://api.example.org", map[string]string{"Access-Control-Request-Method": "DELETE"})
+		is.Equal(w.Code, http.StatusNoContent)
+		is.Equal(w.Header().Get("Access-Control-Allow-Origin"), "https://api.example.org")
+		is.Equal(w.Header().Get("Access-Control-Allow-Methods"), "DELETE")
+	})
+
+	t.Run("rejected preflight", func(t *testing.T) {
+		is := is.New(t)
+		for _, tc := range []struct {
+			name, path, origin string
+			header             map[string]string
+		}{
+			{"unknown origin", "/users", "https://evil.com", map[string]string{"Access-Control-Request-Method": "GET"}},
+			{"pattern needs subdomain", "/users", "https://example.org", map[string]string{"Access-Control-Request-Method": "GET"}},
+			{"pattern suffix", "/users", "https://example.org.evil.com", map[string]string{"Access-Control-Request-Method": "GET"}},
+			{"method not registered", "/users", "https://app.example.com", map[string]string{"Access-Control-Request-Method": "DELETE"}},
+			{"header not allowed", "/users", "https://app.example.com", map[string]string{"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Custom"}},
+		} {
+			w := do(http.MethodOptions, tc.path, tc.origin, tc.header)
+			is.Equal(w.Code, http.StatusNoContent)                       // tc.name
+			is.Equal(w.Header().Get("Access-Control-Allow-Origin"), "")  // tc.name
+			is.Equal(w.Header().Get("Access-Control-Allow-Methods"), "") // tc.name
+		}
+
+		w := do(http.MethodOptions, "/unknown", "https://app.example.com", map[string]string{"Access-Control-Request-Method": "GET"})
+		is.Equal(w.Code, http.StatusNotFound)
+	})
+
+	t.Run("actual request", func(t *testing.T) {
+		is := is.New(t)
+		w := do(http.MethodGet, "/users", "https://app.example.com", nil)
+		is.Equal(w.Code, http.StatusOK)
+		is.Equal(w.Header().Get("Access-Control-Allow-Origin"), "https://app.example.com")
+		is.Equal(w.Header().Get("Access-Control-Expose-Headers"), "X-Total")
+		is.Equal(w.Header().Get("Vary"), "Origin")
+
+		w = do(http.MethodGet, "/users", "https://evil.com", nil)
+		is.Equal(w.Code, http.StatusOK)
+		is.Equal(w.Header().Get("Access-Control-Allow-Origin"), "")
+	})
+}
+
+func TestCORSAllowedMethods(t *testing.T) {
+	is := is.New(t)
+	mux := NewServeMux()
+	mux.UseCORS(CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowedMethods: []string{http.MethodGet, "PURGE"}})
+	mux.HandleFunc("PURGE /cache", func(r *Request) (Result, error) { return Result{}, nil })
+
+	// methods that are allowed but not among the defaults are answered too.
+	req := httptest.NewRequest(http.MethodOptions, "/cache", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PURGE")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	is.Equal(w.Code, http.StatusNoContent)
+	is.Equal(w.Header().Get("Access-Control-Allow-Methods"), "PURGE")
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	is := is.New(t)
+	handler := CORSMiddleware(CORSConfig{AllowedOrigins: []string{"*"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://any.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	is.Equal(w.Code, http.StatusNoContent)
+	is.Equal(w.Header().Get("Access-Control-Allow-Origin"), "*")
+	is.Equal(w.Header().Get("Access-Control-Allow-Methods"), "GET, HEAD, POST, PUT, PATCH, DELETE")
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "null")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	is.Equal(w.Code, http.StatusTeapot)
+	is.Equal(w.Header().Get("Access-Control-Allow-Origin"), "")
+
+	defer func() {
+		is.True(recover() != nil) // credentials cannot be allowed for every origin
+	}()
+	CORSMiddleware(CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	is := is.New(t)
+	handler := SecurityHeadersMiddleware(DefaultSecurityHeadersConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	is.Equal(w.Header().Get("Strict-Transport-Security"), "max-age=31536000; includeSubDomains")
+	is.Equal(w.Header().Get("Content-Security-Policy"), "default-src 'none'; frame-ancestors 'none'")
+	is.Equal(w.Header().Get("Referrer-Policy"), "strict-origin-when-cross-origin")
+	is.Equal(w.Header().Get("X-Content-Type-Options"), "nosniff")
+	is.Equal(w.Header().Get("X-Frame-Options"), "SAMEORIGIN") // handlers can override
+}
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Group registers routes on a ServeMux under a shared path prefix and set of middlewares.
+type Group struct {
+	mux         *ServeMux
+	prefix      string
+	middlewares []MiddlewareFunc
+}
+
+// Group returns a sub router, patterns registered on it are prefixed with prefix and handled by middlewares
+// after global middlewares of the mux and before middlewares of the route itself:
+//
+//	api := mux.Group("/api/v1", JWTBearerAuthenticationMiddleware[Claims](secret))
+//	api.HandleFunc("GET /users/{id}", getUser) // registered as "GET /api/v1/users/{id}"
+func (s *ServeMux) Group(prefix string, middlewares ...MiddlewareFunc) *Group {
+	return &Group{mux: s, prefix: groupPrefix(prefix), middlewares: slices.Clone(middlewares)}
+}
+
+// Mount registers every route of sub under prefix, see Group.Mount.
+func (s *ServeMux) Mount(prefix string, sub *ServeMux, middlewares ...MiddlewareFunc) {
+	s.Group("").Mount(prefix, sub, middlewares...)
+}
+
+// Group returns a nested group, its prefix and middlewares are appended to those of g.
+func (g *Group) Group(prefix string, middlewares ...MiddlewareFunc) *Group {
+	return &Group{
+		mux:         g.mux,
+		prefix:      g.prefix + groupPrefix(prefix),
+		middlewares: append(slices.Clone(g.middlewares), middlewares...),
+	}
+}
+
+// UseMiddlewares adds middlewares to routes registered on g after this call.
+func (g *Group) UseMiddlewares(middlewares ...MiddlewareFunc) {
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+func (g *Group) Handle(pattern string, handler http.Handler, middlewares ...MiddlewareFunc) *Route {
+	return g.mux.Handle(g.pattern(pattern), handler, g.routeMiddlewares(middlewares)...)
+}
+
+// HandleFunc accepts every handler form that ServeMux.HandleFunc does. Middlewares are never applied to
+// `func(http.ResponseWriter, *Request)` handlers, so registering one when there are middlewares panics instead of
+// silently skipping them, wrap it in http.HandlerFunc and use Handle instead.
+func (g *Group) HandleFunc(pattern string, handler any, middlewares ...MiddlewareFunc) *Route {
+	middlewares = g.routeMiddlewares(middlewares)
+	if _, raw := handler.(func(http.ResponseWriter, *Request)); raw {
+		checkRawMiddlewares(pattern, middlewares)
+	}
+	return g.mux.HandleFunc(g.pattern(pattern), handler, middlewares...)
+}
+
+// Mount registers every route of sub under prefix of g joined with prefix. Routes keep their metadata and run
+// middlewares of g, then middlewares, then global middlewares of sub and finally their own middlewares.
+// Endpoints mapped on sub, eg: MapPrometheusEndpoint, are mounted too and like `func(http.ResponseWriter, *Request)`
+// handlers they run without middlewares, so mounting them with middlewares of g or middlewares panics.
+// Only routes registered on sub before this call are mounted.
+func (g *Group) Mount(prefix string, sub *ServeMux, middlewares ...MiddlewareFunc) {
+	group := g.Group(prefix, middlewares...)
+	sub.routesMu.RLock()
+	routes := make([]Route, len(sub.routes))
+	for i, route := range sub.routes {
+		routes[i] = *route
+		routes[i].Tags = slices.Clone(route.Tags)
+	}
+	endpoints := slices.Clone(sub.endpoints)
+	sub.routesMu.RUnlock()
+
+	for _, route := range routes {
+		mounted := route
+		composed := newRoute(group.pattern(route.Pattern))
+		mounted.Pattern, mounted.Method, mounted.Host, mounted.Path = composed.Pattern, composed.Method, composed.Host, composed.Path
+		if route.raw {
+			checkRawMiddlewares(route.Pattern, group.middlewares)
+		}
+		mws := append(slices.Clone(sub.middlewares), route.middlewares...)
+		g.mux.handle(&mounted, route.handler, group.routeMiddlewares(mws)...)
+	}
+	for _, e := range endpoints {
+		checkRawMiddlewares(e.pattern, group.middlewares)
+		g.mux.handleEndpoint(group.pattern(e.pattern), e.handler)
+	}
+}
+
+// checkRawMiddlewares panics when middlewares would be skipped by a handler that cannot run them.
+func checkRawMiddlewares(pattern string, middlewares []MiddlewareFunc) {
+	if len(middlewares) > 0 {
+		panic(fmt.Sprintf("middlewares cannot be applied to %s, it's a func(http.ResponseWriter, *Request) handler or an endpoint mapped on the mux", pattern))
+	}
+}
+
+func (g *Group) routeMiddlewares(middlewares []MiddlewareFunc) []MiddlewareFunc {
+	return append(slices.Clone(g.middlewares), middlewares...)
+}
+
+// pattern joins prefix of g with path of pattern, method and host of pattern are kept.
+func (g *Group) pattern(pattern string) string {
+	route := newRoute(pattern)
+	composed := g.prefix + route.Path
+	if route.Host != "" {
+		composed = route.Host + composed
+	}
+	if route.Method != "" {
+		composed = route.Method + " " + composed
+	}
+	return composed
+}
+
+// groupPrefix makes sure prefix starts with a slash and doesn't end with one.
+func groupPrefix(prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
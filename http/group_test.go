@@ -0,0 +1,129 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amirrezaask/pkg/health"
+	"github.com/matryer/is"
+)
+
+func TestGroup(t *testing.T) {
+	is := is.New(t)
+	var trace []string
+	record := func(name string) MiddlewareFunc {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, name+":"+r.Context().Value("registered_uri").(string))
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	type input struct {
+		ID int `path:"id"`
+	}
+
+	mux := NewServeMux()
+	mux.UseMiddlewares(record("global"))
+	api := mux.Group("/api", record("api"))
+	v1 := api.Group("v1/", record("v1"))
+	v1.HandleFunc("GET /simple", func(r *Request) (Result, error) {
+		return Result{Body: "simple"}, nil
+	}, record("route"))
+	mux.Group("/api/v1").HandleFunc("GET /std", func(w http.ResponseWriter, r *Request) {
+		w.Write([]byte("std"))
+	})
+	v1.HandleFunc("GET /users/{id}", func(r *Request, in *input) (int, error) {
+		return in.ID, nil
+	})
+
+	admin := NewServeMux()
+	admin.UseMiddlewares(record("admin"))
+	admin.HandleFunc("GET /stats", func(r *Request) (Result, error) {
+		return Result{Body: "stats"}, nil
+	}).WithSummary("stats")
+	api.Mount("/admin", admin, record("mount"))
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	get := func(path string) string {
+		trace = nil
+		resp, err := http.Get(srv.URL + path)
+		is.NoErr(err)
+		defer resp.Body.Close()
+		is.Equal(resp.StatusCode, http.StatusOK)
+		bs, err := io.ReadAll(resp.Body)
+		is.NoErr(err)
+		return strings.TrimSpace(string(bs))
+	}
+
+	is.Equal(get("/api/v1/simple"), `"simple"`)
+	is.Equal(trace, []string{"global:GET /api/v1/simple", "api:GET /api/v1/simple", "v1:GET /api/v1/simple", "route:GET /api/v1/simple"})
+	is.Equal(get("/api/v1/std"), "std")
+	is.Equal(len(trace), 0) // raw handlers run without middlewares
+	is.Equal(get("/api/v1/users/12"), "12")
+	is.Equal(trace[2], "v1:GET /api/v1/users/{id}")
+	is.Equal(get("/api/admin/stats"), `"stats"`)
+	is.Equal(trace, []string{"global:GET /api/admin/stats", "api:GET /api/admin/stats", "mount:GET /api/admin/stats", "admin:GET /api/admin/stats"})
+
+	var mounted *Route
+	for _, route := range mux.Routes() {
+		if route.Path == "/api/admin/stats" {
+			mounted = route
+		}
+	}
+	is.True(mounted != nil)
+	is.Equal(mounted.Summary, "stats")
+}
+
+func TestGroupRawHandlers(t *testing.T) {
+	is := is.New(t)
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	}
+	raw := func(w http.ResponseWriter, r *Request) {}
+	panics := func(register func()) (panicked bool) {
+		defer func() { panicked = recover() != nil }()
+		register()
+		return false
+	}
+
+	// middlewares are never applied to raw handlers, so groups reject them instead of skipping auth silently.
+	mux := NewServeMux()
+	is.True(panics(func() { mux.Group("/admin", auth).HandleFunc("GET /raw", raw) }))
+	is.True(panics(func() { mux.Group("/admin").HandleFunc("GET /raw", raw, auth) }))
+	is.True(!panics(func() { mux.Group("/admin").HandleFunc("GET /raw", raw) }))
+
+	sub := NewServeMux()
+	sub.HandleFunc("GET /raw", raw)
+	is.True(panics(func() { NewServeMux().Mount("/sub", sub, auth) }))
+	endpoints := NewServeMux()
+	endpoints.MapHealthEndpoints("/health", health.NewRegistry("group_test"))
+	is.True(panics(func() { NewServeMux().Group("/api", auth).Mount("/sub", endpoints) }))
+}
+
+func TestMountEndpoints(t *testing.T) {
+	is := is.New(t)
+	sub := NewServeMux()
+	sub.MapHealthEndpoints("/health", health.NewRegistry("mount_test"))
+	sub.HandleFunc("GET /items", func(r *Request) (Result, error) {
+		return Result{Body: "items"}, nil
+	}).WithTags("items")
+	mux := NewServeMux()
+	mux.Mount("/sub", sub)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sub/health/live", nil))
+	is.Equal(w.Code, http.StatusOK)
+
+	// mounted routes don't share metadata with routes of sub.
+	for _, route := range mux.Routes() {
+		route.WithTags("mounted")
+	}
+	is.Equal(sub.Routes()[0].Tags, []string{"items"})
+}
@@ -0,0 +1,35 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/amirrezaask/pkg/health"
+)
+
+// MapHealthEndpoints serves checks of registry under prefix:
+//   - GET prefix/live always responds 200 while process can serve requests.
+//   - GET prefix/ready responds 503 when a critical check fails.
+//   - GET prefix responds with the full report, 503 when a critical check fails.
+func (s *ServeMux) MapHealthEndpoints(prefix string, registry *health.Registry) {
+	prefix = groupPrefix(prefix)
+	report := func(w http.ResponseWriter, r *http.Request) {
+		rep := registry.Run(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if rep.Status == health.StatusDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(rep)
+	}
+	s.handleEndpoint("GET "+prefix+"/live", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(health.Report{Status: health.StatusUp, Checks: []health.Result{}})
+	}))
+	s.handleEndpoint("GET "+prefix+"/ready", http.HandlerFunc(report))
+	s.handleEndpoint("GET "+prefix+"/{$}", http.HandlerFunc(report))
+	if prefix != "" {
+		s.handleEndpoint("GET "+prefix, http.HandlerFunc(report))
+	}
+}
@@ -0,0 +1,69 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/amirrezaask/pkg/health"
+	"github.com/matryer/is"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	is := is.New(t)
+	var dbCalls atomic.Int32
+	var dbDown atomic.Bool
+	registry := health.NewRegistry("health_test")
+	health.NewRegistry("health_test") // registries of a namespace share their gauge
+	registry.CacheTTL = time.Hour
+	registry.Register(health.Check{Name: "db", Critical: true, CacheTTL: -1, Check: func(ctx context.Context) error {
+		dbCalls.Add(1)
+		if dbDown.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}})
+	registry.Register(health.Check{Name: "search", Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, Timeout: 10 * time.Millisecond})
+	registry.Register(health.Check{Name: "cache", Check: health.Cacher(cache.NewMemoryCacher())})
+
+	mux := NewServeMux()
+	mux.MapHealthEndpoints("/health/", registry)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	get := func(path string) (int, health.Report) {
+		resp, err := http.Get(srv.URL + path)
+		is.NoErr(err)
+		defer resp.Body.Close()
+		var report health.Report
+		is.NoErr(json.NewDecoder(resp.Body).Decode(&report))
+		return resp.StatusCode, report
+	}
+
+	status, report := get("/health")
+	is.Equal(status, http.StatusOK)
+	is.Equal(report.Status, health.StatusDegraded)
+	is.Equal(len(report.Checks), 3)
+	is.Equal(report.Checks[0].Status, health.StatusUp)
+	is.Equal(report.Checks[1].Status, health.StatusDown)
+	is.True(report.Checks[1].Error != "")
+	is.Equal(report.Checks[2].Status, health.StatusUp)
+
+	dbDown.Store(true)
+	status, report = get("/health/ready")
+	is.Equal(status, http.StatusServiceUnavailable)
+	is.Equal(report.Status, health.StatusDown)
+	is.Equal(dbCalls.Load(), int32(2))
+
+	status, _ = get("/health/live")
+	is.Equal(status, http.StatusOK)
+}
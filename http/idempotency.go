@@ -0,0 +1,220 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/amirrezaask/pkg/lock"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses that are replayed from cache.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+const (
+	DefaultIdempotencyTTL         = 24 * time.Hour
+	DefaultIdempotencyMaxBodySize = 1 << 20
+	maxIdempotencyKeyLen          = 255
+)
+
+type IdempotencyConfig struct {
+	// Cache stores responses, they are stored as json strings so every Cacher works,
+	// redis cachers should be created with a *string or *[]byte ptr provider.
+	Cache cache.Cacher
+	// Locker guards keys while their first request is in flight, Lock should fail with an error wrapping
+	// lock.ErrLocked instead of waiting when key is held, other errors are reported as server errors.
+	Locker lock.Locker
+	// TTL is how long responses are replayed, DefaultIdempotencyTTL when zero.
+	TTL time.Duration
+	// Methods that honor the header, POST and PATCH when empty.
+	Methods []string
+	// MaxBodySize of requests with a key, their bodies are read into memory to be fingerprinted and larger
+	// ones get 413. DefaultIdempotencyMaxBodySize when zero.
+	MaxBodySize int64
+	// Required rejects requests without a key.
+	Required bool
+	// Scope separates keys of different clients, by default keys are scoped by subject of claims, or a hash of
+	// Authorization and X-API-Key headers when middleware runs before authentication, or ip of anonymous clients.
+	Scope func(*Request) string
+}
+
+type idempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// IdempotencyMiddleware makes retries of unsafe requests with the same `Idempotency-Key` header safe.
+// First response of a key is stored and replayed for later requests with that key, while it's in flight
+// duplicates get 409 and a key reused with a different body gets 422. Server errors are not stored so they can be retried.
+func IdempotencyMiddleware(cfg IdempotencyConfig) MiddlewareFunc {
+	if cfg.Cache == nil || cfg.Locker == nil {
+		panic("idempotency middleware needs both cache and locker")
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultIdempotencyTTL
+	}
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = DefaultIdempotencyMaxBodySize
+	}
+	if len(cfg.Methods) == 0 {
+		cfg.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if cfg.Scope == nil {
+		cfg.Scope = idempotencyScope
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(cfg.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				if cfg.Required {
+					writeError(w, r, errors.NewHTTPError(http.StatusBadRequest, "idempotency_key_required", IdempotencyKeyHeader+" header is required"))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLen {
+				writeError(w, r, errors.NewHTTPError(http.StatusBadRequest, "invalid_idempotency_key", IdempotencyKeyHeader+" is too long"))
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodySize))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, r, errors.NewHTTPError(http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit)).Wrap(err))
+				return
+			}
+			if err != nil {
+				writeError(w, r, errors.NewHTTPError(http.StatusBadRequest, "invalid_body", "request body cannot be read").Wrap(err))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+			fingerprint := hex.EncodeToString(sum[:])
+			cacheKey := "idempotency:" + cfg.Scope(&Request{r}) + ":" + r.Method + " " + r.URL.Path + ":" + key
+
+			if replayIdempotent(w, r, cfg.Cache, cacheKey, fingerprint) {
+				return
+			}
+			if err := cfg.Locker.Lock(r.Context(), cacheKey+":lock"); errors.Is(err, lock.ErrLocked) {
+				writeError(w, r, errors.NewHTTPError(http.StatusConflict, "idempotency_request_in_flight", "a request with this idempotency key is still being processed").Wrap(err))
+				return
+			} else if err != nil {
+				writeError(w, r, errors.Wrap(err, "cannot lock idempotency key"))
+				return
+			}
+			// releasing the key must not depend on the client staying around.
+			defer cfg.Locker.Unlock(context.WithoutCancel(r.Context()), cacheKey+":lock")
+			// first request may have finished between lookup and lock.
+			if replayIdempotent(w, r, cfg.Cache, cacheKey, fingerprint) {
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+				return
+			}
+			bs, err := json.Marshal(idempotentResponse{
+				Fingerprint: fingerprint,
+				Status:      recorder.status,
+				Header:      recorder.header,
+				Body:        recorder.body.Bytes(),
+			})
+			if err == nil {
+				err = cfg.Cache.Remember(context.WithoutCancel(r.Context()), cacheKey, string(bs), cfg.TTL)
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "cannot store idempotent response", "err", err)
+			}
+		})
+	}
+}
+
+// replayIdempotent writes response stored for key and returns true if there is one.
+func replayIdempotent(w http.ResponseWriter, r *http.Request, cacher cache.Cacher, key string, fingerprint string) bool {
+	cached, err := cacher.Get(r.Context(), key)
+	if err != nil {
+		return false
+	}
+	var stored idempotentResponse
+	if err := decodeCached(cached, &stored); err != nil {
+		slog.ErrorContext(r.Context(), "cannot decode stored idempotent response", "err", err)
+		return false
+	}
+	if stored.Fingerprint != fingerprint {
+		writeError(w, r, errors.NewHTTPError(http.StatusUnprocessableEntity, "idempotency_key_reused", "idempotency key was already used with a different request body"))
+		return true
+	}
+	for k, vs := range stored.Header {
+		w.Header()[k] = vs
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.Header().Set("Content-Length", strconv.Itoa(len(stored.Body)))
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+	return true
+}
+
+func idempotencyScope(r *Request) string {
+	if claims := r.GetClaims(); claims != nil {
+		if sub, err := claims.GetSubject(); err == nil && sub != "" {
+			return "sub:" + sub
+		}
+	}
+	if auth, apiKey := r.Header.Get("Authorization"), r.Header.Get(APIKeyHeader); auth != "" || apiKey != "" {
+		sum := sha256.Sum256([]byte(auth + "\x00" + apiKey))
+		return "auth:" + hex.EncodeToString(sum[:])
+	}
+	return "ip:" + KeyByIP(r)
+}
+
+// responseRecorder passes response to client and keeps a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 && status >= 200 {
+		rr.status = status
+		rr.header = rr.Header().Clone()
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(bs []byte) (int, error) {
+	if rr.status == 0 {
+		rr.WriteHeader(http.StatusOK)
+	}
+	rr.body.Write(bs)
+	return rr.ResponseWriter.Write(bs)
+}
+
+// Unwrap lets http.ResponseController reach features of the underlying writer.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
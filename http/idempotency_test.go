@@ -0,0 +1,115 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/amirrezaask/pkg/lock"
+	"github.com/matryer/is"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	is := is.New(t)
+	var charges atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	mux := NewServeMux()
+	mux.UseMiddlewares(IdempotencyMiddleware(IdempotencyConfig{Cache: cache.NewMemoryCacher(), Locker: lock.NewInMemoryLock(), MaxBodySize: 64}))
+	mux.HandleFunc("POST /charges", func(r *Request) (Result, error) {
+		var in struct {
+			Amount int `json:"amount"`
+		}
+		if err := r.BindBody(&in); err != nil {
+			return Result{}, err
+		}
+		if r.Header.Get("X-Slow") != "" {
+			close(started)
+			<-release
+		}
+		n := charges.Add(1)
+		return Result{Status: http.StatusCreated, Header: http.Header{"X-Charge": {string(rune('0' + n))}}, Body: in}, nil
+	})
+	mux.HandleFunc("POST /fail", func(r *Request) (Result, error) {
+		charges.Add(1)
+		return Result{Status: http.StatusServiceUnavailable, Body: "try again"}, nil
+	})
+
+	post := func(path, key, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	first := post("/charges", "key-1", `{"amount":10}`)
+	is.Equal(first.Code, http.StatusCreated)
+	is.Equal(first.Header().Get(IdempotentReplayedHeader), "")
+
+	replayed := post("/charges", "key-1", `{"amount":10}`)
+	is.Equal(replayed.Code, http.StatusCreated)
+	is.Equal(replayed.Header().Get(IdempotentReplayedHeader), "true")
+	is.Equal(replayed.Header().Get("X-Charge"), "1")
+	is.Equal(replayed.Body.String(), first.Body.String())
+	is.Equal(charges.Load(), int32(1))
+
+	reused := post("/charges", "key-1", `{"amount":99}`)
+	is.Equal(reused.Code, http.StatusUnprocessableEntity)
+	is.True(strings.Contains(reused.Body.String(), "idempotency_key_reused"))
+
+	is.Equal(post("/charges", "", `{"amount":10}`).Code, http.StatusCreated) // no key, no idempotency
+	is.Equal(charges.Load(), int32(2))
+
+	is.Equal(post("/charges", "key-big", `{"amount":1}`+strings.Repeat(" ", 64)).Code, http.StatusRequestEntityTooLarge)
+
+	// keys of different clients do not collide.
+	other := post("/charges", "key-1", `{"amount":10}`, "Authorization", "Basic b3RoZXI6cGFzcw==")
+	is.Equal(other.Code, http.StatusCreated)
+	is.Equal(other.Header().Get(IdempotentReplayedHeader), "")
+	is.Equal(charges.Load(), int32(3))
+
+	// server errors are not stored.
+	is.Equal(post("/fail", "key-2", "").Code, http.StatusServiceUnavailable)
+	is.Equal(post("/fail", "key-2", "").Code, http.StatusServiceUnavailable)
+	is.Equal(charges.Load(), int32(5))
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post("/charges", "key-3", `{"amount":5}`, "X-Slow", "1") }()
+	<-started
+	inFlight := post("/charges", "key-3", `{"amount":5}`)
+	is.Equal(inFlight.Code, http.StatusConflict)
+	close(release)
+	is.Equal((<-done).Code, http.StatusCreated)
+	is.Equal(post("/charges", "key-3", `{"amount":5}`).Header().Get(IdempotentReplayedHeader), "true")
+}
+
+type failingLocker struct{}
+
+func (failingLocker) Lock(context.Context, string) error   { return errors.New("connection refused") }
+func (failingLocker) Unlock(context.Context, string) error { return nil }
+
+func TestIdempotencyLockerFailure(t *testing.T) {
+	is := is.New(t)
+	mux := NewServeMux()
+	mux.UseMiddlewares(IdempotencyMiddleware(IdempotencyConfig{Cache: cache.NewMemoryCacher(), Locker: failingLocker{}}))
+	mux.HandleFunc("POST /charges", func(r *Request) (Result, error) {
+		return Result{Status: http.StatusCreated}, nil
+	})
+	req := httptest.NewRequest(http.MethodPost, "/charges", strings.NewReader("{}"))
+	req.Header.Set(IdempotencyKeyHeader, "key")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	is.Equal(w.Code, http.StatusInternalServerError) // only a held key is a conflict
+}
@@ -0,0 +1,370 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	DefaultJWKSRefreshInterval = time.Hour
+	// DefaultJWKSMinRefreshInterval limits refetches caused by tokens with unknown kids.
+	DefaultJWKSMinRefreshInterval = time.Minute
+)
+
+var ErrUnknownJWTKey = stderrors.New("no key found for jwt kid")
+
+// JWTKeySet resolves the key that verifies tokens with kid.
+type JWTKeySet interface {
+	Key(ctx context.Context, kid string) (any, error)
+}
+
+// StaticKeys is a fixed key set, key of empty kid is used for tokens without kid or with an unknown one.
+type StaticKeys map[string]any
+
+func (s StaticKeys) Key(_ context.Context, kid string) (any, error) {
+	if key, ok := s[kid]; ok {
+		return key, nil
+	}
+	if key, ok := s[""]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownJWTKey
+}
+
+// ParsePEMPublicKey parses a PKIX or PKCS1 public key or the public key of a certificate.
+func ParsePEMPublicKey(bs []byte) (any, error) {
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, errors.New("no pem block found")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, errors.Newf("unsupported pem block type '%s'", block.Type)
+	}
+}
+
+// JWKS is a key set fetched from a JSON Web Key Set url. Keys are refetched every RefreshInterval and
+// when a token has an unknown kid, so rotated keys are picked up without a restart. Fetches are never attempted
+// more often than MinRefreshInterval, even when they fail.
+type JWKS struct {
+	URL                string
+	Client             *http.Client
+	RefreshInterval    time.Duration
+	MinRefreshInterval time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]any
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	inflight    *jwksFetch
+}
+
+// jwksFetch is a fetch in progress, concurrent lookups of unknown kids wait for the same fetch.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func NewJWKS(url string) *JWKS {
+	return &JWKS{
+		URL:                url,
+		Client:             &http.Client{Timeout: 10 * time.Second},
+		RefreshInterval:    DefaultJWKSRefreshInterval,
+		MinRefreshInterval: DefaultJWKSMinRefreshInterval,
+	}
+}
+
+func (j *JWKS) Key(ctx context.Context, kid string) (any, error) {
+	j.mu.Lock()
+	key, known := j.keys[kid]
+	backoff := time.Since(j.attemptedAt) < j.MinRefreshInterval
+	if known {
+		// stale keys are served while they are refreshed in background, so a slow or down provider
+		// doesn't delay requests.
+		if time.Since(j.fetchedAt) >= j.RefreshInterval && !backoff {
+			j.refresh(context.WithoutCancel(ctx))
+		}
+		j.mu.Unlock()
+		return key, nil
+	}
+	if backoff && j.inflight == nil {
+		j.mu.Unlock()
+		return nil, ErrUnknownJWTKey
+	}
+	f := j.refresh(context.WithoutCancel(ctx))
+	j.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if key, known = j.keys[kid]; !known {
+		return nil, ErrUnknownJWTKey
+	}
+	return key, nil
+}
+
+// refresh starts fetching keys unless a fetch is in progress, j.mu must be held.
+func (j *JWKS) refresh(ctx context.Context) *jwksFetch {
+	if j.inflight != nil {
+		return j.inflight
+	}
+	f := &jwksFetch{done: make(chan struct{})}
+	j.inflight = f
+	j.attemptedAt = time.Now()
+	go func() {
+		keys, err := j.fetch(ctx)
+		j.mu.Lock()
+		if err == nil {
+			j.keys = keys
+			j.fetchedAt = time.Now()
+		} else if len(j.keys) > 0 {
+			slog.WarnContext(ctx, "cannot refresh jwks, using cached keys", "err", err, "url", j.URL)
+		}
+		j.inflight = nil
+		f.err = err
+		j.mu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+func (j *JWKS) fetch(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch jwks")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Newf("cannot fetch jwks, status: %d", resp.StatusCode)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, errors.Wrap(err, "cannot decode jwks")
+	}
+	keys := map[string]any{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			slog.WarnContext(ctx, "skipping unsupported jwk", "kid", k.Kid, "err", err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Newf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("ec point is not on curve")
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errors.Newf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errors.Newf("unsupported key type '%s'", k.Kty)
+	}
+}
+
+type JWTVerifierConfig struct {
+	Keys JWTKeySet
+	// Algorithms tokens can be signed with, eg: RS256, ES256 or EdDSA. Tokens with other algs are rejected
+	// so a public key can never be used as an HMAC secret.
+	Algorithms []string
+	// Issuer and Audience are checked when set.
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew when checking exp, nbf and iat.
+	Leeway            time.Duration
+	RequireExpiration bool
+	// Strict rejects requests with missing or invalid tokens with 401, otherwise they continue unauthenticated.
+	Strict bool
+	// Realm of WWW-Authenticate challenges.
+	Realm string
+}
+
+type JWTVerifier struct {
+	cfg    JWTVerifierConfig
+	parser *jwt.Parser
+}
+
+func NewJWTVerifier(cfg JWTVerifierConfig) *JWTVerifier {
+	if cfg.Keys == nil || len(cfg.Algorithms) == 0 {
+		panic("jwt verifier needs keys and allowed algorithms")
+	}
+	opts := []jwt.ParserOption{jwt.WithValidMethods(cfg.Algorithms), jwt.WithLeeway(cfg.Leeway), jwt.WithIssuedAt()}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	if cfg.RequireExpiration {
+		opts = append(opts, jwt.WithExpirationRequired())
+	}
+	return &JWTVerifier{cfg: cfg, parser: jwt.NewParser(opts...)}
+}
+
+// VerifyJWT parses token into claims after checking its signature and registered claims.
+func VerifyJWT[C any, CLAIMS interface {
+	jwt.Claims
+	*C
+}](ctx context.Context, v *JWTVerifier, token string) (CLAIMS, error) {
+	claims := CLAIMS(new(C))
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		// parser checks alg too, this keeps keys from being resolved for tokens that are going to be rejected anyway.
+		if !slices.Contains(v.cfg.Algorithms, t.Method.Alg()) {
+			return nil, errors.Newf("jwt alg '%s' is not allowed", t.Method.Alg())
+		}
+		kid, _ := t.Header["kid"].(string)
+		return v.cfg.Keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// JWTVerifierMiddleware authenticates requests with a bearer token verified by v, claims are stored as ClaimsKey.
+func JWTVerifierMiddleware[C any, CLAIMS interface {
+	jwt.Claims
+	*C
+}](v *JWTVerifier) MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				if v.cfg.Strict {
+					v.challenge(w, r, "", "bearer token is required")
+					return
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+			claims, err := VerifyJWT[C, CLAIMS](r.Context(), v, token)
+			if err != nil {
+				slog.InfoContext(r.Context(), "invalid jwt", "err", err)
+				if v.cfg.Strict {
+					v.challenge(w, r, "invalid_token", "token is invalid")
+					return
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), ClaimsKey, jwt.Claims(claims)))
+			r = r.WithContext(context.WithValue(r.Context(), IsAuthenticatedKey, true))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// challenge rejects r with 401 and a WWW-Authenticate header as described in RFC 6750.
+func (v *JWTVerifier) challenge(w http.ResponseWriter, r *http.Request, code string, detail string) {
+	challenge := fmt.Sprintf(`Bearer realm=%q`, v.cfg.Realm)
+	if code != "" {
+		challenge += fmt.Sprintf(`, error=%q, error_description=%q`, code, detail)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	if code == "" {
+		code = "unauthenticated"
+	}
+	writeError(w, r, errors.NewHTTPError(http.StatusUnauthorized, code, detail))
+}
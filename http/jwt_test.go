@@ -0,0 +1,290 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/matryer/is"
+)
+
+type testJWKSServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []map[string]string
+	fetches int
+}
+
+func newTestJWKSServer() *testJWKSServer {
+	s := &testJWKSServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.fetches++
+		json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+	}))
+	return s
+}
+
+func (s *testJWKSServer) setKeys(keys map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = nil
+	b64 := func(bs []byte) string { return base64.RawURLEncoding.EncodeToString(bs) }
+	for kid, key := range keys {
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			s.keys = append(s.keys, map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())})
+		case *ecdsa.PublicKey:
+			s.keys = append(s.keys, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32)))})
+		case ed25519.PublicKey:
+			s.keys = append(s.keys, map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": b64(k)})
+		}
+	}
+}
+
+func TestJWTVerifier(t *testing.T) {
+	is := is.New(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	is.NoErr(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	is.NoErr(err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	is.NoErr(err)
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	is.NoErr(err)
+
+	jwks := newTestJWKSServer()
+	defer jwks.Close()
+	jwks.setKeys(map[string]any{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey, "ed": edPub})
+
+	verifier := NewJWTVerifier(JWTVerifierConfig{
+		Keys:              NewJWKS(jwks.URL),
+		Algorithms:        []string{"RS256", "ES256", "EdDSA"},
+		Issuer:            "https://issuer.example.com",
+		Audience:          "orders",
+		Leeway:            5 * time.Second,
+		RequireExpiration: true,
+		Strict:            true,
+		Realm:             "orders",
+	})
+	mux := NewServeMux()
+	mux.UseMiddlewares(JWTVerifierMiddleware[jwt.RegisteredClaims](verifier))
+	mux.HandleFunc("GET /me", func(r *Request) (Result, error) {
+		sub, err := r.GetClaims().GetSubject()
+		return Result{Body: sub}, err
+	})
+
+	claims := func(mutate ...func(*jwt.RegisteredClaims)) jwt.RegisteredClaims {
+		c := jwt.RegisteredClaims{
+			Subject:   "user-1",
+			Issuer:    "https://issuer.example.com",
+			Audience:  jwt.ClaimStrings{"orders"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}
+		for _, m := range mutate {
+			m(&c)
+		}
+		return c
+	}
+	sign := func(method jwt.SigningMethod, kid string, key any, c jwt.RegisteredClaims) string {
+		tok := jwt.NewWithClaims(method, c)
+		tok.Header["kid"] = kid
+		s, err := tok.SignedString(key)
+		is.NoErr(err)
+		return s
+	}
+	call := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, token := range []string{
+		sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims()),
+		sign(jwt.SigningMethodES256, "ec", ecKey, claims()),
+		sign(jwt.SigningMethodEdDSA, "ed", edKey, claims()),
+		sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-2 * time.Second)) // within leeway
+		})),
+	} {
+		w := call(token)
+		is.Equal(w.Code, http.StatusOK)
+		is.Equal(strings.TrimSpace(w.Body.String()), `"user-1"`)
+	}
+	is.Equal(jwks.fetches, 1) // keys are cached
+
+	w := call("")
+	is.Equal(w.Code, http.StatusUnauthorized)
+	is.Equal(w.Header().Get("WWW-Authenticate"), `Bearer realm="orders"`)
+
+	publicPEM, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	is.NoErr(err)
+	for name, token := range map[string]string{
+		"wrong issuer":   sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c *jwt.RegisteredClaims) { c.Issuer = "https://evil.com" })),
+		"wrong audience": sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"billing"} })),
+		"expired":        sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) })),
+		"no expiration":  sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c *jwt.RegisteredClaims) { c.ExpiresAt = nil })),
+		"wrong key":      sign(jwt.SigningMethodRS256, "rsa", rotated, claims()),
+		"alg confusion":  sign(jwt.SigningMethodHS256, "rsa", publicPEM, claims()),
+		"garbage":        "not.a.jwt",
+	} {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+			w := call(token)
+			is.Equal(w.Code, http.StatusUnauthorized)
+			is.True(strings.HasPrefix(w.Header().Get("WWW-Authenticate"), `Bearer realm="orders", error="invalid_token"`))
+		})
+	}
+
+	// rotated keys are fetched when an unknown kid shows up, but not more often than MinRefreshInterval.
+	jwks.setKeys(map[string]any{"rotated": &rotated.PublicKey})
+	verifier.cfg.Keys.(*JWKS).attemptedAt = time.Now().Add(-2 * DefaultJWKSMinRefreshInterval)
+	fetches := jwks.fetches
+	is.Equal(call(sign(jwt.SigningMethodRS256, "rotated", rotated, claims())).Code, http.StatusOK)
+	is.Equal(call(sign(jwt.SigningMethodRS256, "unknown", rotated, claims())).Code, http.StatusUnauthorized)
+	is.Equal(jwks.fetches, fetches+1)
+}
+
+func TestJWTVerifierStaticKeys(t *testing.T) {
+	is := is.New(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	is.NoErr(err)
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	is.NoErr(err)
+	public, err := ParsePEMPublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	is.NoErr(err)
+
+	// verifier is not strict, so invalid tokens continue unauthenticated.
+	mux := NewServeMux()
+	mux.UseMiddlewares(JWTVerifierMiddleware[jwt.RegisteredClaims](NewJWTVerifier(JWTVerifierConfig{
+		Keys:       StaticKeys{"": public},
+		Algorithms: []string{"RS256"},
+	})))
+	mux.HandleFunc("GET /", func(r *Request) (Result, error) {
+		return Result{Body: r.Context().Value(IsAuthenticatedKey) == true}, nil
+	})
+	call := func(token string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		is.Equal(w.Code, http.StatusOK)
+		return strings.TrimSpace(w.Body.String())
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{Subject: "user-1"}).SignedString(rsaKey)
+	is.NoErr(err)
+	is.Equal(call(token), "true")
+	is.Equal(call("invalid"), "false")
+}
+
+func TestJWTBearerAuthenticationMiddleware(t *testing.T) {
+	is := is.New(t)
+	secret := []byte("secret")
+	mux := NewServeMux()
+	mux.UseMiddlewares(JWTBearerAuthenticationMiddleware[jwt.RegisteredClaims](secret))
+	mux.HandleFunc("GET /", func(r *Request) (Result, error) {
+		return Result{Body: r.Context().Value(IsAuthenticatedKey) == true}, nil
+	})
+	call := func(token string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return strings.TrimSpace(w.Body.String())
+	}
+	hmac, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "user-1"}).SignedString(secret)
+	is.NoErr(err)
+	is.Equal(call(hmac), "true")
+
+	// tokens of other algs are rejected, so a public key can't be used as the HMAC secret.
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	is.NoErr(err)
+	rs, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{Subject: "user-1"}).SignedString(rsaKey)
+	is.NoErr(err)
+	is.Equal(call(rs), "false")
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	is.NoErr(err)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	confused, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "user-1"}).SignedString(publicPEM)
+	is.NoErr(err)
+	is.Equal(call(confused), "false")
+
+	// public keys are never used as HMAC secrets, even when verifier allows both algs.
+	public, err := ParsePEMPublicKey(publicPEM)
+	is.NoErr(err)
+	mux = NewServeMux()
+	mux.UseMiddlewares(JWTVerifierMiddleware[jwt.RegisteredClaims](NewJWTVerifier(JWTVerifierConfig{
+		Keys:       StaticKeys{"": public},
+		Algorithms: []string{"RS256", "HS256"},
+	})))
+	mux.HandleFunc("GET /", func(r *Request) (Result, error) {
+		return Result{Body: r.Context().Value(IsAuthenticatedKey) == true}, nil
+	})
+	is.Equal(call(rs), "true")
+	is.Equal(call(confused), "false")
+}
+
+func TestJWKSOutage(t *testing.T) {
+	is := is.New(t)
+	var mu sync.Mutex
+	fetches := 0
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	jwks := NewJWKS(srv.URL)
+	jwks.keys = map[string]any{"known": "key"}
+
+	// stale known keys are served without waiting for refresh.
+	key, err := jwks.Key(context.Background(), "known")
+	is.NoErr(err)
+	is.Equal(key, "key")
+
+	// lookups of unknown kids wait for the fetch in progress instead of starting their own.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = jwks.Key(ctx, "unknown")
+	is.Equal(err, context.DeadlineExceeded)
+	jwks.mu.Lock()
+	f := jwks.inflight
+	jwks.mu.Unlock()
+	release <- struct{}{}
+	<-f.done
+
+	// failed fetches back off too.
+	_, err = jwks.Key(context.Background(), "unknown")
+	is.Equal(err, ErrUnknownJWTKey)
+	key, err = jwks.Key(context.Background(), "known")
+	is.NoErr(err)
+	is.Equal(key, "key")
+	mu.Lock()
+	defer mu.Unlock()
+	is.Equal(fetches, 1)
+}
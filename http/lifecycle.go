@@ -0,0 +1,201 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/amirrezaask/pkg/errors"
+)
+
+// ManagedServer runs handlers on one or more addresses and shuts down gracefully on SIGINT and SIGTERM.
+// On a signal readiness starts failing, after DrainDelay shutdown hooks run and then in flight requests
+// have ShutdownTimeout to finish.
+type ManagedServer struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout is the deadline of shutdown hooks and in flight requests.
+	ShutdownTimeout time.Duration
+	// DrainDelay is time between failing readiness and starting shutdown, so load balancers stop sending new requests.
+	DrainDelay time.Duration
+
+	listeners  []listener
+	onStart    []func(context.Context) error
+	onShutdown []func(context.Context) error
+	ready      atomic.Bool
+
+	mu    sync.Mutex
+	addrs []net.Addr
+}
+
+type listener struct {
+	addr    string
+	handler http.Handler
+}
+
+// NewManagedServer creates a server listening on addr with sane default timeouts.
+func NewManagedServer(addr string, handler http.Handler) *ManagedServer {
+	s := &ManagedServer{
+		ReadTimeout:       30 * time.Second,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ShutdownTimeout:   30 * time.Second,
+		DrainDelay:        5 * time.Second,
+	}
+	s.Listen(addr, handler)
+	return s
+}
+
+// Listen adds another address to serve handler on, eg: an admin port for metrics.
+func (s *ManagedServer) Listen(addr string, handler http.Handler) {
+	s.listeners = append(s.listeners, listener{addr: addr, handler: handler})
+}
+
+// OnStart registers a hook that runs before server starts listening, an error aborts the start. Shutdown hooks
+// don't run on an aborted start, so hooks that already succeeded are not undone, their ctx is canceled when
+// Run returns and can be used to release what they started.
+func (s *ManagedServer) OnStart(hook func(ctx context.Context) error) {
+	s.onStart = append(s.onStart, hook)
+}
+
+// OnShutdown registers a hook that runs before http shutdown begins, eg: to stop consumers.
+// Hooks run in reverse order of registration.
+func (s *ManagedServer) OnShutdown(hook func(ctx context.Context) error) {
+	s.onShutdown = append(s.onShutdown, hook)
+}
+
+// Ready reports whether server is serving and is not shutting down.
+func (s *ManagedServer) Ready() bool {
+	return s.ready.Load()
+}
+
+// ReadinessHandler responds 200 while server is Ready and 503 otherwise.
+func (s *ManagedServer) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.Ready() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
+
+// CheckReady fails while server is not Ready, it can be registered as an uncached health check.
+func (s *ManagedServer) CheckReady(ctx context.Context) error {
+	if !s.Ready() {
+		return errors.New("server is not ready")
+	}
+	return nil
+}
+
+// Addrs returns addresses server is listening on, in the order they were added.
+func (s *ManagedServer) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addrs
+}
+
+// ListenAndServe runs server until it receives a shutdown signal.
+func (s *ManagedServer) ListenAndServe() error {
+	return s.Run(context.Background())
+}
+
+// Run serves until ctx is done, a shutdown signal is received or one of listeners fails, then shuts down gracefully.
+func (s *ManagedServer) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, hook := range s.onStart {
+		if err := hook(ctx); err != nil {
+			return errors.Wrap(err, "start hook failed")
+		}
+	}
+
+	// every address is bound before serving so a busy port fails the start instead of a half running server.
+	var lns []net.Listener
+	for _, l := range s.listeners {
+		ln, err := net.Listen("tcp", l.addr)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return errors.Wrap(err, "cannot listen on %s", l.addr)
+		}
+		lns = append(lns, ln)
+	}
+	s.mu.Lock()
+	s.addrs = nil
+	for _, ln := range lns {
+		s.addrs = append(s.addrs, ln.Addr())
+	}
+	s.mu.Unlock()
+
+	servers := make([]*http.Server, len(lns))
+	serveErrs := make(chan error, len(lns))
+	for i, ln := range lns {
+		servers[i] = &http.Server{
+			Handler:           s.listeners[i].handler,
+			ReadTimeout:       s.ReadTimeout,
+			ReadHeaderTimeout: s.ReadHeaderTimeout,
+			WriteTimeout:      s.WriteTimeout,
+			IdleTimeout:       s.IdleTimeout,
+		}
+		go func(srv *http.Server, ln net.Listener) {
+			if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				serveErrs <- errors.Wrap(err, "serving on %s failed", ln.Addr())
+			}
+		}(servers[i], ln)
+		slog.Info("http server is listening", "addr", ln.Addr().String())
+	}
+	s.ready.Store(true)
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-serveErrs:
+	}
+	// default handling of signals is restored, so a second signal exits without waiting for graceful shutdown.
+	stop()
+	s.ready.Store(false)
+	slog.Info("http server is shutting down", "drain_delay", s.DrainDelay, "timeout", s.ShutdownTimeout)
+	if serveErr == nil && s.DrainDelay > 0 {
+		time.Sleep(s.DrainDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+	errs := []error{serveErr}
+	for i := len(s.onShutdown) - 1; i >= 0; i-- {
+		if err := s.onShutdown[i](shutdownCtx); err != nil {
+			errs = append(errs, errors.Wrap(err, "shutdown hook failed"))
+		}
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				// requests that did not finish in time are cut.
+				srv.Close()
+				mu.Lock()
+				errs = append(errs, errors.Wrap(err, "graceful shutdown failed"))
+				mu.Unlock()
+			}
+		}(srv)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestServerLifecycle(t *testing.T) {
+	is := is.New(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := NewServeMux()
+	mux.HandleFunc("GET /slow", func(r *Request) (Result, error) {
+		close(started)
+		<-release
+		return Result{Body: "done"}, nil
+	})
+
+	srv := NewManagedServer("127.0.0.1:0", mux)
+	srv.DrainDelay = 50 * time.Millisecond
+	srv.ShutdownTimeout = 5 * time.Second
+	admin := NewServeMux()
+	admin.Handle("GET /ready", srv.ReadinessHandler())
+	srv.Listen("127.0.0.1:0", admin)
+
+	var hooks []string
+	readyOnShutdown := true
+	srv.OnStart(func(ctx context.Context) error {
+		hooks = append(hooks, "start")
+		return nil
+	})
+	srv.OnShutdown(func(ctx context.Context) error {
+		hooks = append(hooks, "stop consumers")
+		readyOnShutdown = srv.Ready()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- srv.Run(ctx) }()
+	for !srv.Ready() {
+		time.Sleep(time.Millisecond)
+	}
+	addrs := srv.Addrs()
+	is.Equal(len(addrs), 2)
+
+	resp, err := http.Get("http://" + addrs[1].String() + "/ready")
+	is.NoErr(err)
+	resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusOK)
+
+	slow := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + addrs[0].String() + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		bs, _ := io.ReadAll(resp.Body)
+		slow <- string(bs)
+	}()
+	<-started
+
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	is.True(!srv.Ready())
+	resp, err = http.Get("http://" + addrs[1].String() + "/ready")
+	is.NoErr(err)
+	resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusServiceUnavailable)
+
+	// in flight request finishes before Run returns.
+	close(release)
+	is.Equal(<-slow, "\"done\"\n")
+	is.NoErr(<-done)
+	is.Equal(hooks, []string{"start", "stop consumers"})
+	is.True(!readyOnShutdown)
+}
@@ -0,0 +1,408 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// OIDCReturnToParam is the query parameter of login endpoint that names the local path to go to after login.
+	OIDCReturnToParam = "return_to"
+
+	oidcFlowSessionKey   = "oidc_flow"
+	oidcClaimsSessionKey = "oidc_claims"
+	oidcTokenSessionKey  = "oidc_id_token"
+)
+
+type OIDCConfig struct {
+	// Issuer is the identity provider url, metadata is discovered from `<Issuer>/.well-known/openid-configuration`.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute url of callback endpoint, eg: https://app.example.com/auth/callback.
+	RedirectURL string
+	// Scopes requested besides openid, profile and email when empty.
+	Scopes []string
+	// Sessions keeps state of login flows and claims of logged in users, its Middleware should run before OIDC ones.
+	Sessions *SessionManager
+	// Client calls identity provider, a client with 10s timeout when nil.
+	Client *http.Client
+	// AfterLogout is where users are redirected after logout when provider has no end session endpoint, "/" when empty.
+	AfterLogout string
+	// Leeway tolerates clock skew when checking ID tokens.
+	Leeway time.Duration
+}
+
+// OIDC logs users in with an OpenID Connect provider using authorization code flow with PKCE.
+// ID token claims of type C are kept in session and restored by Middleware as ClaimsKey.
+type OIDC[C any, CLAIMS interface {
+	jwt.Claims
+	*C
+}] struct {
+	cfg OIDCConfig
+
+	// mu guards discovered metadata and verifier, it's never held during requests to provider.
+	mu        sync.Mutex
+	metadata  *oidcMetadata
+	verifier  *JWTVerifier
+	loginPath atomic.Pointer[string]
+}
+
+type oidcMetadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	EndSessionEndpoint    string   `json:"end_session_endpoint"`
+	SigningAlgs           []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// oidcFlow is kept in session between redirecting to provider and its callback.
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"return_to"`
+}
+
+func NewOIDC[C any, CLAIMS interface {
+	jwt.Claims
+	*C
+}](cfg OIDCConfig) *OIDC[C, CLAIMS] {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" || cfg.Sessions == nil {
+		panic("oidc needs issuer, client id, redirect url and sessions")
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"profile", "email"}
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.AfterLogout == "" {
+		cfg.AfterLogout = "/"
+	}
+	return &OIDC[C, CLAIMS]{cfg: cfg}
+}
+
+// MapEndpoints registers login flow under prefix:
+//   - GET prefix/login redirects to provider, `return_to` query parameter is where user lands after login.
+//   - GET prefix/callback handles response of provider, its url should be RedirectURL.
+//   - POST prefix/logout ends session and logs out of provider when it supports that.
+func (o *OIDC[C, CLAIMS]) MapEndpoints(mux *ServeMux, prefix string, middlewares ...MiddlewareFunc) {
+	prefix = groupPrefix(prefix)
+	login := prefix + "/login"
+	o.loginPath.Store(&login)
+	// endpoints need session middleware, so they are registered as handlers which run middlewares of mux.
+	mux.Handle("GET "+prefix+"/login", oidcHandler(o.login), middlewares...).WithSummary("Log in with identity provider")
+	mux.Handle("GET "+prefix+"/callback", oidcHandler(o.callback), middlewares...).WithSummary("Identity provider callback")
+	mux.Handle("POST "+prefix+"/logout", oidcHandler(o.logout), middlewares...).WithSummary("Log out")
+}
+
+func oidcHandler(fn func(http.ResponseWriter, *Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer _recover()
+		fn(w, &Request{r})
+	})
+}
+
+// Middleware authenticates requests of logged in users, it should run after session middleware.
+func (o *OIDC[C, CLAIMS]) Middleware() MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := (&Request{r}).Session()
+			claims := CLAIMS(new(C))
+			if session == nil || !session.Get(oidcClaimsSessionKey, claims) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), ClaimsKey, jwt.Claims(claims)))
+			r = r.WithContext(context.WithValue(r.Context(), IsAuthenticatedKey, true))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireLogin redirects unauthenticated GET requests to login endpoint and rejects others with 401,
+// it should run after Middleware and MapEndpoints should be called before requests are served.
+func (o *OIDC[C, CLAIMS]) RequireLogin() MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Context().Value(IsAuthenticatedKey) == true {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if r.Method != http.MethodGet {
+				writeError(w, r, errors.NewHTTPError(http.StatusUnauthorized, "unauthenticated", "login is required"))
+				return
+			}
+			var login string
+			if path := o.loginPath.Load(); path != nil {
+				login = *path
+			}
+			http.Redirect(w, r, login+"?"+url.Values{OIDCReturnToParam: {r.URL.RequestURI()}}.Encode(), http.StatusFound)
+		})
+	}
+}
+
+func (o *OIDC[C, CLAIMS]) login(w http.ResponseWriter, r *Request) {
+	session := r.Session()
+	if session == nil {
+		writeError(w, r.Request, errors.New("oidc needs session middleware"))
+		return
+	}
+	metadata, _, err := o.discover(r.Context())
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	flow := oidcFlow{State: randomToken(32), Nonce: randomToken(32), Verifier: randomToken(32), ReturnTo: safeReturnTo(r.URL.Query().Get(OIDCReturnToParam))}
+	if err := session.Set(oidcFlowSessionKey, flow); err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	challenge := sha256.Sum256([]byte(flow.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.cfg.ClientID},
+		"redirect_uri":          {o.cfg.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, o.cfg.Scopes...), " ")},
+		"state":                 {flow.State},
+		"nonce":                 {flow.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r.Request, appendQuery(metadata.AuthorizationEndpoint, query), http.StatusFound)
+}
+
+func (o *OIDC[C, CLAIMS]) callback(w http.ResponseWriter, r *Request) {
+	session := r.Session()
+	if session == nil {
+		writeError(w, r.Request, errors.New("oidc needs session middleware"))
+		return
+	}
+	var flow oidcFlow
+	// flows are single use, so a callback cannot be replayed.
+	if !session.Get(oidcFlowSessionKey, &flow) {
+		writeError(w, r.Request, errors.NewHTTPError(http.StatusBadRequest, "invalid_state", "no login is in progress"))
+		return
+	}
+	session.Delete(oidcFlowSessionKey)
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(flow.State)) != 1 {
+		writeError(w, r.Request, errors.NewHTTPError(http.StatusBadRequest, "invalid_state", "state does not match login"))
+		return
+	}
+	if code := query.Get("error"); code != "" {
+		writeError(w, r.Request, errors.NewHTTPError(http.StatusUnauthorized, "login_failed", "identity provider returned "+code+": "+query.Get("error_description")))
+		return
+	}
+
+	idToken, err := o.exchange(r.Context(), query.Get("code"), flow.Verifier)
+	if err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	claims, err := o.verifyIDToken(r.Context(), idToken, flow.Nonce)
+	if err != nil {
+		slog.InfoContext(r.Context(), "invalid oidc id token", "err", err)
+		writeError(w, r.Request, errors.NewHTTPError(http.StatusUnauthorized, "login_failed", "id token is invalid").Wrap(err))
+		return
+	}
+
+	session.Renew()
+	if err := session.Set(oidcClaimsSessionKey, claims); err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	if err := session.Set(oidcTokenSessionKey, idToken); err != nil {
+		writeError(w, r.Request, err)
+		return
+	}
+	http.Redirect(w, r.Request, flow.ReturnTo, http.StatusFound)
+}
+
+func (o *OIDC[C, CLAIMS]) logout(w http.ResponseWriter, r *Request) {
+	session := r.Session()
+	if session == nil {
+		writeError(w, r.Request, errors.New("oidc needs session middleware"))
+		return
+	}
+	var idToken string
+	session.Get(oidcTokenSessionKey, &idToken)
+	session.Destroy()
+	target := o.cfg.AfterLogout
+	if metadata, _, err := o.discover(r.Context()); err == nil && metadata.EndSessionEndpoint != "" && idToken != "" {
+		target = appendQuery(metadata.EndSessionEndpoint, url.Values{"id_token_hint": {idToken}, "client_id": {o.cfg.ClientID}})
+	}
+	http.Redirect(w, r.Request, target, http.StatusSeeOther)
+}
+
+// discover fetches provider metadata once, failures are retried on next calls.
+func (o *OIDC[C, CLAIMS]) discover(ctx context.Context) (*oidcMetadata, *JWTVerifier, error) {
+	o.mu.Lock()
+	metadata, verifier := o.metadata, o.verifier
+	o.mu.Unlock()
+	if metadata != nil {
+		return metadata, verifier, nil
+	}
+	metadata, verifier, err := o.fetchMetadata(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// concurrent discoveries may race, the first one is kept.
+	if o.metadata == nil {
+		o.metadata, o.verifier = metadata, verifier
+	}
+	return o.metadata, o.verifier, nil
+}
+
+func (o *OIDC[C, CLAIMS]) fetchMetadata(ctx context.Context) (*oidcMetadata, *JWTVerifier, error) {
+	var metadata oidcMetadata
+	if err := o.getJSON(ctx, o.cfg.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, nil, errors.NewHTTPError(http.StatusBadGateway, "idp_unavailable", "cannot discover identity provider").Wrap(err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != o.cfg.Issuer {
+		return nil, nil, errors.Newf("discovered issuer '%s' does not match '%s'", metadata.Issuer, o.cfg.Issuer)
+	}
+	// symmetric algs would verify with client secret and none is never acceptable.
+	algs := slices.DeleteFunc(slices.Clone(metadata.SigningAlgs), func(alg string) bool {
+		return alg == "none" || strings.HasPrefix(alg, "HS")
+	})
+	if len(algs) == 0 {
+		algs = []string{"RS256"}
+	}
+	jwks := NewJWKS(metadata.JWKSURI)
+	jwks.Client = o.cfg.Client
+	verifier := NewJWTVerifier(JWTVerifierConfig{
+		Keys:              jwks,
+		Algorithms:        algs,
+		Issuer:            metadata.Issuer,
+		Audience:          o.cfg.ClientID,
+		Leeway:            o.cfg.Leeway,
+		RequireExpiration: true,
+	})
+	return &metadata, verifier, nil
+}
+
+// exchange trades code for tokens at token endpoint and returns the ID token.
+func (o *OIDC[C, CLAIMS]) exchange(ctx context.Context, code string, verifier string) (string, error) {
+	metadata, _, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.cfg.RedirectURL},
+		"client_id":     {o.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(o.cfg.ClientSecret))
+	}
+	resp, err := o.cfg.Client.Do(req)
+	if err != nil {
+		return "", errors.NewHTTPError(http.StatusBadGateway, "idp_unavailable", "cannot exchange authorization code").Wrap(err)
+	}
+	defer resp.Body.Close()
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokens); err != nil {
+		return "", errors.NewHTTPError(http.StatusBadGateway, "idp_unavailable", "cannot decode token response").Wrap(err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		return "", errors.NewHTTPError(http.StatusUnauthorized, "login_failed", "authorization code was rejected: "+tokens.Error+" "+tokens.ErrorDescription)
+	}
+	return tokens.IDToken, nil
+}
+
+func (o *OIDC[C, CLAIMS]) verifyIDToken(ctx context.Context, idToken string, nonce string) (CLAIMS, error) {
+	_, verifier, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := VerifyJWT[C, CLAIMS](ctx, verifier, idToken)
+	if err != nil {
+		return nil, err
+	}
+	// nonce is not part of CLAIMS necessarily, token is already verified so reading it unverified is safe.
+	var extra struct {
+		jwt.RegisteredClaims
+		Nonce string `json:"nonce"`
+	}
+	if _, _, err := jwt.NewParser().ParseUnverified(idToken, &extra); err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(extra.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("id token nonce does not match login")
+	}
+	return claims, nil
+}
+
+func (o *OIDC[C, CLAIMS]) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Newf("unexpected status %d from %s", resp.StatusCode, u)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// safeReturnTo only accepts local paths, so login cannot be used as an open redirect. Browsers drop tabs and
+// newlines from urls and treat \ as /, so `/\t/evil.com` would be followed as `//evil.com`.
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+		return "/"
+	}
+	if strings.ContainsFunc(returnTo, func(r rune) bool { return r < 0x20 || r == 0x7f || r == '\\' }) {
+		return "/"
+	}
+	u, err := url.Parse(returnTo)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "/"
+	}
+	return returnTo
+}
+
+func appendQuery(endpoint string, query url.Values) string {
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + query.Encode()
+}
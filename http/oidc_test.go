@@ -0,0 +1,229 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/matryer/is"
+)
+
+// testIdP is a minimal OpenID provider, authorize endpoint is skipped and tests issue codes with authorize.
+type testIdP struct {
+	*httptest.Server
+	jwks  *testJWKSServer
+	mu    sync.Mutex
+	codes map[string]url.Values
+	nonce string // replaces nonce of issued id tokens when set
+}
+
+func newTestIdP(is *is.I) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	is.NoErr(err)
+	idp := &testIdP{codes: map[string]url.Values{}}
+	jwks := newTestJWKSServer()
+	idp.jwks = jwks
+	jwks.setKeys(map[string]any{"idp": &key.PublicKey})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/authorize",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              jwks.URL,
+			"end_session_endpoint":                  idp.URL + "/logout",
+			"id_token_signing_alg_values_supported": []string{"RS256", "HS256", "none"},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		authorize, ok := idp.codes[r.PostFormValue("code")]
+		delete(idp.codes, r.PostFormValue("code"))
+		nonce := idp.nonce
+		idp.mu.Unlock()
+		client, secret, _ := r.BasicAuth()
+		challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || client != "app" || secret != "secret" || r.PostFormValue("grant_type") != "authorization_code" ||
+			base64.RawURLEncoding.EncodeToString(challenge[:]) != authorize.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		if nonce == "" {
+			nonce = authorize.Get("nonce")
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   idp.URL,
+			"sub":   "user-1",
+			"aud":   authorize.Get("client_id"),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": nonce,
+			"email": "user@example.com",
+		})
+		token.Header["kid"] = "idp"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "access", "token_type": "Bearer", "id_token": signed})
+	})
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+// authorize approves authorization request of location and returns the callback url.
+func (idp *testIdP) authorize(is *is.I, location string) string {
+	u, err := url.Parse(location)
+	is.NoErr(err)
+	is.Equal(u.Path, "/authorize")
+	query := u.Query()
+	is.Equal(query.Get("code_challenge_method"), "S256")
+	is.Equal(query.Get("response_type"), "code")
+	code := randomToken(16)
+	idp.mu.Lock()
+	idp.codes[code] = query
+	idp.mu.Unlock()
+	return query.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+}
+
+func (idp *testIdP) Close() {
+	idp.Server.Close()
+	idp.jwks.Close()
+}
+
+func (idp *testIdP) setNonce(nonce string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.nonce = nonce
+}
+
+func TestOIDC(t *testing.T) {
+	is := is.New(t)
+	idp := newTestIdP(is)
+	defer idp.Close()
+
+	sessions := NewSessionManager(SessionConfig{Cache: cache.NewMemoryCacher(), Keys: [][]byte{[]byte("key")}})
+	oidc := NewOIDC[jwt.MapClaims](OIDCConfig{
+		Issuer:       idp.URL,
+		ClientID:     "app",
+		ClientSecret: "secret",
+		RedirectURL:  "http://app.example.com/auth/callback",
+		Sessions:     sessions,
+	})
+	mux := NewServeMux()
+	mux.UseMiddlewares(sessions.Middleware(), oidc.Middleware())
+	oidc.MapEndpoints(mux, "/auth")
+	mux.HandleFunc("GET /me", func(r *Request) (Result, error) {
+		claims := r.GetClaims().(*jwt.MapClaims)
+		return Result{Body: (*claims)["email"]}, nil
+	}, oidc.RequireLogin())
+
+	var cookie *http.Cookie
+	do := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if cookies := w.Result().Cookies(); len(cookies) > 0 {
+			cookie = cookies[0]
+		}
+		return w
+	}
+	login := func() string {
+		w := do(http.MethodGet, "/me?page=1")
+		is.Equal(w.Code, http.StatusFound)
+		w = do(http.MethodGet, w.Header().Get("Location"))
+		is.Equal(w.Code, http.StatusFound)
+		return idp.authorize(is, w.Header().Get("Location"))
+	}
+
+	callback := login()
+	anonymous := cookie
+	w := do(http.MethodGet, callback)
+	is.Equal(w.Code, http.StatusFound)
+	is.Equal(w.Header().Get("Location"), "/me?page=1")
+	is.True(cookie.Value != anonymous.Value) // session is rotated on login
+	w = do(http.MethodGet, "/me")
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(strings.TrimSpace(w.Body.String()), `"user@example.com"`)
+
+	// callbacks are single use.
+	is.Equal(do(http.MethodGet, callback).Code, http.StatusBadRequest)
+
+	w = do(http.MethodPost, "/auth/logout")
+	is.Equal(w.Code, http.StatusSeeOther)
+	is.True(strings.HasPrefix(w.Header().Get("Location"), idp.URL+"/logout?"))
+	is.Equal(do(http.MethodGet, "/me").Code, http.StatusFound)
+
+	t.Run("state mismatch", func(t *testing.T) {
+		is := is.New(t)
+		callback := strings.Replace(login(), "state=", "state=forged", 1)
+		is.Equal(do(http.MethodGet, callback).Code, http.StatusBadRequest)
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		is := is.New(t)
+		idp.setNonce("replayed-token-nonce")
+		defer idp.setNonce("")
+		is.Equal(do(http.MethodGet, login()).Code, http.StatusUnauthorized)
+		is.Equal(do(http.MethodGet, "/me").Code, http.StatusFound)
+	})
+
+	t.Run("open redirect", func(t *testing.T) {
+		is := is.New(t)
+		for _, returnTo := range []string{"https://evil.example.com", "//evil.example.com", "/\\evil.example.com", "/\t/evil.example.com", "/\n/evil.example.com"} {
+			w := do(http.MethodGet, "/auth/login?"+url.Values{OIDCReturnToParam: {returnTo}}.Encode())
+			callback := idp.authorize(is, w.Header().Get("Location"))
+			w = do(http.MethodGet, callback)
+			is.Equal(w.Header().Get("Location"), "/")
+		}
+	})
+}
+
+func TestOIDCSlowDiscovery(t *testing.T) {
+	is := is.New(t)
+	release := make(chan struct{})
+	requested := make(chan struct{}, 1)
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer idp.Close()
+	defer close(release)
+
+	sessions := NewSessionManager(SessionConfig{Cache: cache.NewMemoryCacher(), Keys: [][]byte{[]byte("key")}})
+	oidc := NewOIDC[jwt.MapClaims](OIDCConfig{Issuer: idp.URL, ClientID: "app", RedirectURL: "http://app.example.com/auth/callback", Sessions: sessions})
+	mux := NewServeMux()
+	mux.UseMiddlewares(sessions.Middleware(), oidc.Middleware())
+	oidc.MapEndpoints(mux, "/auth")
+	mux.HandleFunc("GET /me", func(r *Request) (Result, error) { return Result{}, nil }, oidc.RequireLogin())
+
+	go mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	<-requested
+
+	// pages that require login are redirected while provider is slow to answer discovery.
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/me", nil))
+		done <- w.Code
+	}()
+	select {
+	case code := <-done:
+		is.Equal(code, http.StatusFound)
+	case <-time.After(time.Second):
+		t.Fatal("login redirect waited for discovery")
+	}
+}
@@ -0,0 +1,296 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/amirrezaask/pkg/http/openapi"
+)
+
+// OpenAPI builds an OpenAPI 3.1 document from routes registered on this mux. Patterns without a method, eg: "/files/",
+// match every method and cannot be described as a single operation, so they are left out.
+func (s *ServeMux) OpenAPI(info openapi.Info) *openapi.Document {
+	s.routesMu.RLock()
+	defer s.routesMu.RUnlock()
+	doc := &openapi.Document{
+		OpenAPI:    "3.1.0",
+		Info:       info,
+		Paths:      &openapi.Paths{Items: map[string]openapi.PathItem{}},
+		Components: &openapi.Components{},
+	}
+	generator := openapi.NewSchemaGenerator(doc.Components)
+
+	for _, route := range s.routes {
+		if route.Hidden || route.Method == "" {
+			continue
+		}
+		path := openAPIPath(route.Path)
+		item := doc.Paths.Items[path]
+		if !item.SetOperation(route.Method, route.operation(generator)) {
+			continue
+		}
+		doc.Paths.Items[path] = item
+		for _, req := range route.Security {
+			for scheme := range req {
+				if definition, ok := s.securityScheme(scheme); ok {
+					if doc.Components.SecuritySchemes == nil {
+						doc.Components.SecuritySchemes = map[string]openapi.SecurityScheme{}
+					}
+					doc.Components.SecuritySchemes[scheme] = definition
+				}
+			}
+		}
+	}
+	if len(doc.Components.Schemas) == 0 && len(doc.Components.SecuritySchemes) == 0 {
+		doc.Components = nil
+	}
+
+	return doc
+}
+
+// AddSecurityScheme describes scheme that security requirements of routes refer to by name,
+// BearerAuthScheme is described as a bearer JWT scheme unless it's added.
+func (s *ServeMux) AddSecurityScheme(name string, scheme openapi.SecurityScheme) {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+	if s.securitySchemes == nil {
+		s.securitySchemes = map[string]openapi.SecurityScheme{}
+	}
+	s.securitySchemes[name] = scheme
+	s.generation++
+}
+
+func (s *ServeMux) securityScheme(name string) (openapi.SecurityScheme, bool) {
+	if scheme, ok := s.securitySchemes[name]; ok {
+		return scheme, true
+	}
+	if name == BearerAuthScheme {
+		return openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}, true
+	}
+	return openapi.SecurityScheme{}, false
+}
+
+// MapOpenAPIEndpoint serves OpenAPI document of this mux on given path, document is encoded
+// as yaml if path ends with `.yaml` or `.yml` and as json otherwise.
+// Document is generated on first request and again whenever routes were registered or changed with Route
+// With methods since, so routes registered after this call are included.
+func (s *ServeMux) MapOpenAPIEndpoint(path string, info openapi.Info) {
+	contentType := "application/json"
+	encode := func(doc *openapi.Document) ([]byte, error) { return json.Marshal(doc) }
+	if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+		contentType = "application/yaml"
+		encode = (*openapi.Document).YAML
+	}
+	var (
+		mu         sync.Mutex
+		generated  []byte
+		generation uint64
+	)
+	document := func() ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		s.routesMu.RLock()
+		current := s.generation
+		s.routesMu.RUnlock()
+		if generated == nil || current != generation {
+			bs, err := encode(s.OpenAPI(info))
+			if err != nil {
+				return nil, err
+			}
+			generated, generation = bs, current
+		}
+		return generated, nil
+	}
+	s.handleEndpoint("GET "+path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, err := document()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(bs)
+	}))
+}
+
+func (r *Route) operation(generator *openapi.SchemaGenerator) *openapi.Operation {
+	op := &openapi.Operation{
+		Tags:        r.Tags,
+		Summary:     r.Summary,
+		Description: r.Description,
+		OperationId: r.OperationID,
+		Deprecated:  r.Deprecated,
+		Responses:   &openapi.Responses{Codes: map[string]openapi.Response{}},
+	}
+	if op.OperationId == "" {
+		op.OperationId = operationID(r.Method, r.Path)
+	}
+
+	if r.Input != nil {
+		op.Parameters = parameters(r.Input, generator)
+	}
+	op.Parameters = append(op.Parameters, undeclaredPathParameters(r.Path, op.Parameters)...)
+	if r.Input != nil {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodDelete {
+			body := generator.ObjectSchema(r.Input, isParamField)
+			if len(body.Properties) > 0 {
+				op.RequestBody = &openapi.RequestBody{
+					Required: true,
+					Content:  openAPIContent(decoders, body),
+				}
+			}
+		}
+	}
+
+	if r.Input != nil {
+		op.Responses.Codes["400"] = problemResponse(generator.Components, "Request could not be bound to input")
+		op.Responses.Codes["422"] = problemResponse(generator.Components, "Input failed validation, `errors` member lists every failed field")
+	}
+	if r.Security != nil {
+		op.Security = r.Security
+		op.Responses.Codes["401"] = problemResponse(generator.Components, "Request is not authenticated")
+		op.Responses.Codes["403"] = problemResponse(generator.Components, "Request is not allowed by authorization policies")
+	}
+	if r.WebSocket {
+		op.Responses.Codes["101"] = openapi.Response{Description: "Connection is upgraded to websocket"}
+	} else if r.Output == eventStreamType {
+		op.Responses.Codes["200"] = openapi.Response{
+			Description: "Stream of server-sent events",
+			Content: map[string]openapi.MediaType{
+				"text/event-stream": {Schema: &openapi.Schema{Type: openapi.Types{"string"}}},
+			},
+		}
+		op.Responses.Codes["default"] = problemResponse(generator.Components, "Error")
+	} else if r.Output != nil {
+		op.Responses.Codes["200"] = openapi.Response{
+			Description: http.StatusText(http.StatusOK),
+			Content:     openAPIContent(encoders, generator.Schema(r.Output)),
+		}
+		op.Responses.Codes["default"] = problemResponse(generator.Components, "Error")
+	} else {
+		op.Responses.Codes["default"] = openapi.Response{Description: "Response of the operation"}
+	}
+
+	return op
+}
+
+// problemResponse describes an `application/problem+json` response and registers Problem schema in components.
+func problemResponse(components *openapi.Components, description string) openapi.Response {
+	if _, exists := components.Schemas["Problem"]; !exists {
+		if components.Schemas == nil {
+			components.Schemas = map[string]*openapi.Schema{}
+		}
+		str := func() *openapi.Schema { return &openapi.Schema{Type: openapi.Types{"string"}} }
+		components.Schemas["Problem"] = &openapi.Schema{
+			Type: openapi.Types{"object"},
+			Properties: map[string]*openapi.Schema{
+				"type":     str(),
+				"title":    str(),
+				"status":   {Type: openapi.Types{"integer"}},
+				"detail":   str(),
+				"instance": str(),
+				"code":     str(),
+				"trace_id": str(),
+			},
+			Required: []string{"type", "title", "status"},
+		}
+	}
+	return openapi.Response{
+		Description: description,
+		Content: map[string]openapi.MediaType{
+			"application/problem+json": {Schema: &openapi.Schema{Ref: "#/components/schemas/Problem"}},
+		},
+	}
+}
+
+func parameters(t reflect.Type, generator *openapi.SchemaGenerator) []openapi.Parameter {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var params []openapi.Parameter
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, in := paramOf(field)
+		if in == "" {
+			if isParamContainer(field) {
+				params = append(params, parameters(field.Type, generator)...)
+			}
+			continue
+		}
+		params = append(params, openapi.Parameter{
+			Name:        name,
+			In:          in,
+			Description: field.Tag.Get("doc"),
+			Required:    in == "path" || hasRule(field, "required"),
+			Schema:      generator.Schema(field.Type),
+		})
+	}
+
+	return params
+}
+
+// undeclaredPathParameters returns string parameters for wildcards of path that are not bound to any input field.
+func undeclaredPathParameters(path string, declared []openapi.Parameter) []openapi.Parameter {
+	var params []openapi.Parameter
+	for _, segment := range strings.Split(openAPIPath(path), "/") {
+		name, isWildcard := strings.CutPrefix(segment, "{")
+		name, _ = strings.CutSuffix(name, "}")
+		if !isWildcard || name == "" {
+			continue
+		}
+		exists := false
+		for _, p := range declared {
+			exists = exists || (p.In == "path" && p.Name == name)
+		}
+		if !exists {
+			params = append(params, openapi.Parameter{Name: name, In: "path", Required: true, Schema: &openapi.Schema{Type: openapi.Types{"string"}}})
+		}
+	}
+	return params
+}
+
+// isParamField reports whether field is bound from somewhere other than body and has no json tag of its own,
+// embedded structs are not param fields since their fields are checked one by one.
+func isParamField(field reflect.StructField) bool {
+	if field.Tag.Get("json") != "" || field.Anonymous {
+		return false
+	}
+	_, in := paramOf(field)
+	return in != "" || isParamContainer(field)
+}
+
+// openAPIPath converts a ServeMux path pattern into an OpenAPI path template,
+// `{name...}` wildcards become `{name}` and `{$}` anchors are removed.
+func openAPIPath(path string) string {
+	path = strings.ReplaceAll(path, "{$}", "")
+	path = strings.ReplaceAll(path, "...}", "}")
+	if path == "" {
+		path = "/"
+	}
+	return path
+}
+
+// operationID generates an id like `getUsersId` for "GET /users/{id}".
+func operationID(method string, path string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(method))
+	upperNext := true
+	for _, r := range openAPIPath(path) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upperNext = true
+			continue
+		}
+		if upperNext {
+			r = unicode.ToUpper(r)
+			upperNext = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
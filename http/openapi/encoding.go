@@ -0,0 +1,448 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Extensions holds specification extensions, keys always start with `x-`.
+type Extensions map[string]any
+
+// marshalJSON encodes v (which must encode as a json object) and appends extensions to it.
+func marshalJSON(v any, ext Extensions) ([]byte, error) {
+	bs, err := json.Marshal(v)
+	if err != nil || len(ext) == 0 {
+		return bs, err
+	}
+	extBs, err := json.Marshal(ext)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(bs, []byte("{}")) {
+		return extBs, nil
+	}
+
+	return append(append(bs[:len(bs)-1], ','), extBs[1:]...), nil
+}
+
+// unmarshalJSON decodes data into v and collects `x-` keys of data into ext.
+func unmarshalJSON(data []byte, v any, ext *Extensions) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for key, value := range raw {
+		if !strings.HasPrefix(key, "x-") {
+			continue
+		}
+		var x any
+		if err := json.Unmarshal(value, &x); err != nil {
+			return err
+		}
+		if *ext == nil {
+			*ext = Extensions{}
+		}
+		(*ext)[key] = x
+	}
+
+	return nil
+}
+
+// reference is the Reference Object, objects that can be replaced by a reference encode as one when their Ref is set.
+type reference struct {
+	Ref         string `json:"$ref"`
+	Summary     string `json:"summary,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// marshalMap encodes m as a json object with extensions appended to it.
+func marshalMap[V any](m map[string]V, ext Extensions) ([]byte, error) {
+	if m == nil {
+		m = map[string]V{}
+	}
+	return marshalJSON(m, ext)
+}
+
+// unmarshalMap decodes a json object into m and collects its `x-` keys into ext.
+func unmarshalMap[V any](data []byte, m *map[string]V, ext *Extensions) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = make(map[string]V, len(raw))
+	for key, value := range raw {
+		if strings.HasPrefix(key, "x-") {
+			var x any
+			if err := json.Unmarshal(value, &x); err != nil {
+				return err
+			}
+			if *ext == nil {
+				*ext = Extensions{}
+			}
+			(*ext)[key] = x
+			continue
+		}
+		var v V
+		if err := json.Unmarshal(value, &v); err != nil {
+			return err
+		}
+		(*m)[key] = v
+	}
+	return nil
+}
+
+func (d Document) MarshalJSON() ([]byte, error) {
+	type document Document
+	return marshalJSON(document(d), d.Extensions)
+}
+
+func (d *Document) UnmarshalJSON(data []byte) error {
+	type document Document
+	return unmarshalJSON(data, (*document)(d), &d.Extensions)
+}
+
+func (i Info) MarshalJSON() ([]byte, error) {
+	type info Info
+	return marshalJSON(info(i), i.Extensions)
+}
+
+func (i *Info) UnmarshalJSON(data []byte) error {
+	type info Info
+	return unmarshalJSON(data, (*info)(i), &i.Extensions)
+}
+
+func (c Contact) MarshalJSON() ([]byte, error) {
+	type contact Contact
+	return marshalJSON(contact(c), c.Extensions)
+}
+
+func (c *Contact) UnmarshalJSON(data []byte) error {
+	type contact Contact
+	return unmarshalJSON(data, (*contact)(c), &c.Extensions)
+}
+
+func (l License) MarshalJSON() ([]byte, error) {
+	type license License
+	return marshalJSON(license(l), l.Extensions)
+}
+
+func (l *License) UnmarshalJSON(data []byte) error {
+	type license License
+	return unmarshalJSON(data, (*license)(l), &l.Extensions)
+}
+
+func (s Server) MarshalJSON() ([]byte, error) {
+	type server Server
+	return marshalJSON(server(s), s.Extensions)
+}
+
+func (s *Server) UnmarshalJSON(data []byte) error {
+	type server Server
+	return unmarshalJSON(data, (*server)(s), &s.Extensions)
+}
+
+func (s ServerVariable) MarshalJSON() ([]byte, error) {
+	type serverVariable ServerVariable
+	return marshalJSON(serverVariable(s), s.Extensions)
+}
+
+func (s *ServerVariable) UnmarshalJSON(data []byte) error {
+	type serverVariable ServerVariable
+	return unmarshalJSON(data, (*serverVariable)(s), &s.Extensions)
+}
+
+func (p Paths) MarshalJSON() ([]byte, error) {
+	return marshalMap(p.Items, p.Extensions)
+}
+
+func (p *Paths) UnmarshalJSON(data []byte) error {
+	return unmarshalMap(data, &p.Items, &p.Extensions)
+}
+
+func (p PathItem) MarshalJSON() ([]byte, error) {
+	type pathItem PathItem
+	return marshalJSON(pathItem(p), p.Extensions)
+}
+
+func (p *PathItem) UnmarshalJSON(data []byte) error {
+	type pathItem PathItem
+	return unmarshalJSON(data, (*pathItem)(p), &p.Extensions)
+}
+
+func (p Parameter) MarshalJSON() ([]byte, error) {
+	if p.Ref != "" {
+		return json.Marshal(reference{Ref: p.Ref, Description: p.Description})
+	}
+	type parameter Parameter
+	return marshalJSON(parameter(p), p.Extensions)
+}
+
+func (p *Parameter) UnmarshalJSON(data []byte) error {
+	type parameter Parameter
+	return unmarshalJSON(data, (*parameter)(p), &p.Extensions)
+}
+
+func (e ExternalDocumentation) MarshalJSON() ([]byte, error) {
+	type externalDocumentation ExternalDocumentation
+	return marshalJSON(externalDocumentation(e), e.Extensions)
+}
+
+func (e *ExternalDocumentation) UnmarshalJSON(data []byte) error {
+	type externalDocumentation ExternalDocumentation
+	return unmarshalJSON(data, (*externalDocumentation)(e), &e.Extensions)
+}
+
+func (t Tag) MarshalJSON() ([]byte, error) {
+	type tag Tag
+	return marshalJSON(tag(t), t.Extensions)
+}
+
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	type tag Tag
+	return unmarshalJSON(data, (*tag)(t), &t.Extensions)
+}
+
+// operationSecurity encodes Operation.Security keeping the difference between nil and empty.
+type operationSecurity struct {
+	Security *[]SecurityRequirement `json:"security,omitempty"`
+}
+
+func (o Operation) MarshalJSON() ([]byte, error) {
+	type operation Operation
+	bs, err := marshalJSON(operation(o), o.Extensions)
+	if err != nil || o.Security == nil {
+		return bs, err
+	}
+	security, err := json.Marshal(operationSecurity{Security: &o.Security})
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(bs, []byte("{}")) {
+		return security, nil
+	}
+	return append(append(bs[:len(bs)-1], ','), security[1:]...), nil
+}
+
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	type operation Operation
+	if err := unmarshalJSON(data, (*operation)(o), &o.Extensions); err != nil {
+		return err
+	}
+	var security operationSecurity
+	if err := json.Unmarshal(data, &security); err != nil {
+		return err
+	}
+	if security.Security != nil {
+		o.Security = *security.Security
+		if o.Security == nil {
+			o.Security = []SecurityRequirement{}
+		}
+	}
+	return nil
+}
+
+func (r Responses) MarshalJSON() ([]byte, error) {
+	return marshalMap(r.Codes, r.Extensions)
+}
+
+func (r *Responses) UnmarshalJSON(data []byte) error {
+	return unmarshalMap(data, &r.Codes, &r.Extensions)
+}
+
+func (c Callback) MarshalJSON() ([]byte, error) {
+	return marshalMap(c.Expressions, c.Extensions)
+}
+
+func (c *Callback) UnmarshalJSON(data []byte) error {
+	return unmarshalMap(data, &c.Expressions, &c.Extensions)
+}
+
+func (m MediaType) MarshalJSON() ([]byte, error) {
+	type mediaType MediaType
+	return marshalJSON(mediaType(m), m.Extensions)
+}
+
+func (m *MediaType) UnmarshalJSON(data []byte) error {
+	type mediaType MediaType
+	return unmarshalJSON(data, (*mediaType)(m), &m.Extensions)
+}
+
+func (r Response) MarshalJSON() ([]byte, error) {
+	if r.Ref != "" {
+		return json.Marshal(reference{Ref: r.Ref, Description: r.Description})
+	}
+	type response Response
+	return marshalJSON(response(r), r.Extensions)
+}
+
+func (r *Response) UnmarshalJSON(data []byte) error {
+	type response Response
+	return unmarshalJSON(data, (*response)(r), &r.Extensions)
+}
+
+func (e Encoding) MarshalJSON() ([]byte, error) {
+	type encoding Encoding
+	return marshalJSON(encoding(e), e.Extensions)
+}
+
+func (e *Encoding) UnmarshalJSON(data []byte) error {
+	type encoding Encoding
+	return unmarshalJSON(data, (*encoding)(e), &e.Extensions)
+}
+
+func (e Example) MarshalJSON() ([]byte, error) {
+	if e.Ref != "" {
+		return json.Marshal(reference{Ref: e.Ref, Summary: e.Summary, Description: e.Description})
+	}
+	type example Example
+	return marshalJSON(example(e), e.Extensions)
+}
+
+func (e *Example) UnmarshalJSON(data []byte) error {
+	type example Example
+	return unmarshalJSON(data, (*example)(e), &e.Extensions)
+}
+
+func (r RequestBody) MarshalJSON() ([]byte, error) {
+	if r.Ref != "" {
+		return json.Marshal(reference{Ref: r.Ref, Description: r.Description})
+	}
+	type requestBody RequestBody
+	return marshalJSON(requestBody(r), r.Extensions)
+}
+
+func (r *RequestBody) UnmarshalJSON(data []byte) error {
+	type requestBody RequestBody
+	return unmarshalJSON(data, (*requestBody)(r), &r.Extensions)
+}
+
+func (h Header) MarshalJSON() ([]byte, error) {
+	if h.Ref != "" {
+		return json.Marshal(reference{Ref: h.Ref, Description: h.Description})
+	}
+	type header Header
+	return marshalJSON(header(h), h.Extensions)
+}
+
+func (h *Header) UnmarshalJSON(data []byte) error {
+	type header Header
+	return unmarshalJSON(data, (*header)(h), &h.Extensions)
+}
+
+func (s SecurityScheme) MarshalJSON() ([]byte, error) {
+	if s.Ref != "" {
+		return json.Marshal(reference{Ref: s.Ref, Description: s.Description})
+	}
+	type securityScheme SecurityScheme
+	return marshalJSON(securityScheme(s), s.Extensions)
+}
+
+func (s *SecurityScheme) UnmarshalJSON(data []byte) error {
+	type securityScheme SecurityScheme
+	return unmarshalJSON(data, (*securityScheme)(s), &s.Extensions)
+}
+
+func (o OAuthFlows) MarshalJSON() ([]byte, error) {
+	type oauthFlows OAuthFlows
+	return marshalJSON(oauthFlows(o), o.Extensions)
+}
+
+func (o *OAuthFlows) UnmarshalJSON(data []byte) error {
+	type oauthFlows OAuthFlows
+	return unmarshalJSON(data, (*oauthFlows)(o), &o.Extensions)
+}
+
+func (o OAuthFlow) MarshalJSON() ([]byte, error) {
+	type oauthFlow OAuthFlow
+	if o.Scopes == nil {
+		o.Scopes = map[string]string{}
+	}
+	return marshalJSON(oauthFlow(o), o.Extensions)
+}
+
+func (o *OAuthFlow) UnmarshalJSON(data []byte) error {
+	type oauthFlow OAuthFlow
+	return unmarshalJSON(data, (*oauthFlow)(o), &o.Extensions)
+}
+
+func (l Link) MarshalJSON() ([]byte, error) {
+	if l.Ref != "" {
+		return json.Marshal(reference{Ref: l.Ref, Description: l.Description})
+	}
+	type link Link
+	return marshalJSON(link(l), l.Extensions)
+}
+
+func (l *Link) UnmarshalJSON(data []byte) error {
+	type link Link
+	return unmarshalJSON(data, (*link)(l), &l.Extensions)
+}
+
+func (c Components) MarshalJSON() ([]byte, error) {
+	type components Components
+	return marshalJSON(components(c), c.Extensions)
+}
+
+func (c *Components) UnmarshalJSON(data []byte) error {
+	type components Components
+	return unmarshalJSON(data, (*components)(c), &c.Extensions)
+}
+
+func (s Schema) MarshalJSON() ([]byte, error) {
+	if s.Boolean != nil {
+		return json.Marshal(*s.Boolean)
+	}
+	type schema Schema
+	return marshalJSON(schema(s), s.Extensions)
+}
+
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.Equal(trimmed, []byte("true")) || bytes.Equal(trimmed, []byte("false")) {
+		b := trimmed[0] == 't'
+		*s = Schema{Boolean: &b}
+		return nil
+	}
+	type schema Schema
+	return unmarshalJSON(data, (*schema)(s), &s.Extensions)
+}
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+func (d Discriminator) MarshalJSON() ([]byte, error) {
+	type discriminator Discriminator
+	return marshalJSON(discriminator(d), d.Extensions)
+}
+
+func (d *Discriminator) UnmarshalJSON(data []byte) error {
+	type discriminator Discriminator
+	return unmarshalJSON(data, (*discriminator)(d), &d.Extensions)
+}
+
+func (x XML) MarshalJSON() ([]byte, error) {
+	type xml XML
+	return marshalJSON(xml(x), x.Extensions)
+}
+
+func (x *XML) UnmarshalJSON(data []byte) error {
+	type xml XML
+	return unmarshalJSON(data, (*xml)(x), &x.Extensions)
+}
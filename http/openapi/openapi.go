@@ -1,131 +1,411 @@
 package openapi
 
+// Document is the root object of an OpenAPI 3.0/3.1 description.
 type Document struct {
-	OpenAPI           string
-	Info              Info
-	jsonSchemaDialect string
-	Servers           []Server
-	Paths             map[string]PathItem
-	Components        Components
-	// Webhooks
-	Security []SecurityRequirement
+	OpenAPI           string                 `json:"openapi"`
+	Info              Info                   `json:"info"`
+	JSONSchemaDialect string                 `json:"jsonSchemaDialect,omitempty"`
+	Servers           []Server               `json:"servers,omitempty"`
+	Paths             *Paths                 `json:"paths,omitempty"`
+	Webhooks          map[string]PathItem    `json:"webhooks,omitempty"`
+	Components        *Components            `json:"components,omitempty"`
+	Security          []SecurityRequirement  `json:"security,omitempty"`
+	Tags              []Tag                  `json:"tags,omitempty"`
+	ExternalDocs      *ExternalDocumentation `json:"externalDocs,omitempty"`
+	Extensions        Extensions             `json:"-"`
 }
 
 type Info struct {
-	Title          string
-	Summary        string
-	Description    string
-	TermsOfService string
-	Contact        Contact
-	License        License
-	Version        string
+	Title          string     `json:"title"`
+	Summary        string     `json:"summary,omitempty"`
+	Description    string     `json:"description,omitempty"`
+	TermsOfService string     `json:"termsOfService,omitempty"`
+	Contact        *Contact   `json:"contact,omitempty"`
+	License        *License   `json:"license,omitempty"`
+	Version        string     `json:"version"`
+	Extensions     Extensions `json:"-"`
 }
 
 type Contact struct {
-	Name  string
-	URL   string
-	Email string
+	Name       string     `json:"name,omitempty"`
+	URL        string     `json:"url,omitempty"`
+	Email      string     `json:"email,omitempty"`
+	Extensions Extensions `json:"-"`
 }
 
 type License struct {
-	Name       string
-	Identifier string
-	URL        string
+	Name       string     `json:"name"`
+	Identifier string     `json:"identifier,omitempty"`
+	URL        string     `json:"url,omitempty"`
+	Extensions Extensions `json:"-"`
 }
 
 type Server struct {
-	URL         string
-	Description string
-	Variables   map[string]ServerVariable
+	URL         string                    `json:"url"`
+	Description string                    `json:"description,omitempty"`
+	Variables   map[string]ServerVariable `json:"variables,omitempty"`
+	Extensions  Extensions                `json:"-"`
 }
 
 type ServerVariable struct {
-	Enum        []string
-	Default     string
-	Description string
+	Enum        []string   `json:"enum,omitempty"`
+	Default     string     `json:"default"`
+	Description string     `json:"description,omitempty"`
+	Extensions  Extensions `json:"-"`
+}
+
+type Paths struct {
+	// Items maps path templates like `/users/{id}` to their PathItem.
+	Items      map[string]PathItem
+	Extensions Extensions
 }
 
 type PathItem struct {
-	Ref         string `json:"$ref"`
-	Summary     string
-	Description string
-	Get         Operation
-	Put         Operation
-	Post        Operation
-	Delete      Operation
-	Options     Operation
-	Head        Operation
-	Patch       Operation
-	Trace       Operation
-	Servers     []Server
-	Parameters  []Parameter
+	Ref         string      `json:"$ref,omitempty"`
+	Summary     string      `json:"summary,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Get         *Operation  `json:"get,omitempty"`
+	Put         *Operation  `json:"put,omitempty"`
+	Post        *Operation  `json:"post,omitempty"`
+	Delete      *Operation  `json:"delete,omitempty"`
+	Options     *Operation  `json:"options,omitempty"`
+	Head        *Operation  `json:"head,omitempty"`
+	Patch       *Operation  `json:"patch,omitempty"`
+	Trace       *Operation  `json:"trace,omitempty"`
+	Servers     []Server    `json:"servers,omitempty"`
+	Parameters  []Parameter `json:"parameters,omitempty"`
+	Extensions  Extensions  `json:"-"`
+}
+
+// SetOperation sets the operation of p for the given (case insensitive) http method,
+// it returns false if method is not one of the methods an OpenAPI path item can describe.
+func (p *PathItem) SetOperation(method string, op *Operation) bool {
+	switch method {
+	case "GET", "get":
+		p.Get = op
+	case "PUT", "put":
+		p.Put = op
+	case "POST", "post":
+		p.Post = op
+	case "DELETE", "delete":
+		p.Delete = op
+	case "OPTIONS", "options":
+		p.Options = op
+	case "HEAD", "head":
+		p.Head = op
+	case "PATCH", "patch":
+		p.Patch = op
+	case "TRACE", "trace":
+		p.Trace = op
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Operations returns non nil operations of p keyed by lowercase http method.
+func (p *PathItem) Operations() map[string]*Operation {
+	ops := map[string]*Operation{}
+	for method, op := range map[string]*Operation{
+		"get": p.Get, "put": p.Put, "post": p.Post, "delete": p.Delete,
+		"options": p.Options, "head": p.Head, "patch": p.Patch, "trace": p.Trace,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
 }
 
+// Parameter describes a single operation parameter, when Ref is set it's a Reference Object.
 type Parameter struct {
-	Name            string
-	In              string
-	Description     string
-	Required        bool
-	Depreacated     bool
-	AllowEmptyValue bool
+	Ref             string               `json:"$ref,omitempty"`
+	Name            string               `json:"name,omitempty"`
+	In              string               `json:"in,omitempty"`
+	Description     string               `json:"description,omitempty"`
+	Required        bool                 `json:"required,omitempty"`
+	Deprecated      bool                 `json:"deprecated,omitempty"`
+	AllowEmptyValue bool                 `json:"allowEmptyValue,omitempty"`
+	Style           string               `json:"style,omitempty"`
+	Explode         *bool                `json:"explode,omitempty"`
+	AllowReserved   bool                 `json:"allowReserved,omitempty"`
+	Schema          *Schema              `json:"schema,omitempty"`
+	Example         any                  `json:"example,omitempty"`
+	Examples        map[string]Example   `json:"examples,omitempty"`
+	Content         map[string]MediaType `json:"content,omitempty"`
+	Extensions      Extensions           `json:"-"`
 }
 
-type SecurityRequirement struct {
+// SecurityRequirement maps security scheme names to the scopes (or roles in 3.1) required for them.
+type SecurityRequirement map[string][]string
+
+type ExternalDocumentation struct {
+	Description string     `json:"description,omitempty"`
+	URL         string     `json:"url"`
+	Extensions  Extensions `json:"-"`
 }
 
-type ExternalDocumentation struct{}
+type Tag struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description,omitempty"`
+	ExternalDocs *ExternalDocumentation `json:"externalDocs,omitempty"`
+	Extensions   Extensions             `json:"-"`
+}
 
 type Operation struct {
-	Tags         []string
-	Summary      string
-	Description  string
-	ExternalDocs ExternalDocumentation
-	OperationId  string
-	Parameters   []Parameter
-	RequestBody  RequestBody
-	Responses    map[string]Response
+	Tags         []string               `json:"tags,omitempty"`
+	Summary      string                 `json:"summary,omitempty"`
+	Description  string                 `json:"description,omitempty"`
+	ExternalDocs *ExternalDocumentation `json:"externalDocs,omitempty"`
+	OperationId  string                 `json:"operationId,omitempty"`
+	Parameters   []Parameter            `json:"parameters,omitempty"`
+	RequestBody  *RequestBody           `json:"requestBody,omitempty"`
+	Responses    *Responses             `json:"responses,omitempty"`
+	Callbacks    map[string]Callback    `json:"callbacks,omitempty"`
+	Deprecated   bool                   `json:"deprecated,omitempty"`
+	// Security overrides document level security, a non nil empty slice removes it for this operation.
+	Security   []SecurityRequirement `json:"-"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Extensions Extensions            `json:"-"`
+}
+
+type Responses struct {
+	// Codes maps http status codes (or ranges like `4XX` and `default`) to responses.
+	Codes      map[string]Response
+	Extensions Extensions
+}
+
+type Callback struct {
+	// Expressions maps runtime expressions to the PathItem describing the callback request.
+	Expressions map[string]PathItem
+	Extensions  Extensions
 }
 
 type MediaType struct {
-	Schema   Schema
-	Example  any
-	Examples map[string]Example
-	Encoding map[string]Encoding
+	Schema     *Schema             `json:"schema,omitempty"`
+	Example    any                 `json:"example,omitempty"`
+	Examples   map[string]Example  `json:"examples,omitempty"`
+	Encoding   map[string]Encoding `json:"encoding,omitempty"`
+	Extensions Extensions          `json:"-"`
 }
+
+// Response describes a single response of an operation, when Ref is set it's a Reference Object.
 type Response struct {
-	Description string
-	Headers     map[string]Header
-	Content     map[string]MediaType
-	Links       map[string]Link
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+	Links       map[string]Link      `json:"links,omitempty"`
+	Extensions  Extensions           `json:"-"`
 }
 
-type Schema struct {
-}
 type Encoding struct {
-	ContentType   string
-	Headers       map[string]Header
-	Style         string
-	Explode       string
-	AllowReserved string
+	ContentType   string            `json:"contentType,omitempty"`
+	Headers       map[string]Header `json:"headers,omitempty"`
+	Style         string            `json:"style,omitempty"`
+	Explode       *bool             `json:"explode,omitempty"`
+	AllowReserved bool              `json:"allowReserved,omitempty"`
+	Extensions    Extensions        `json:"-"`
 }
-type Example struct{}
 
-type RequestBody struct{}
+// Example holds an example value, when Ref is set it's a Reference Object.
+type Example struct {
+	Ref           string     `json:"$ref,omitempty"`
+	Summary       string     `json:"summary,omitempty"`
+	Description   string     `json:"description,omitempty"`
+	Value         any        `json:"value,omitempty"`
+	ExternalValue string     `json:"externalValue,omitempty"`
+	Extensions    Extensions `json:"-"`
+}
 
-type Header struct{}
+// RequestBody describes body of a request, when Ref is set it's a Reference Object.
+type RequestBody struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+	Required    bool                 `json:"required,omitempty"`
+	Extensions  Extensions           `json:"-"`
+}
 
-type SecuritySchema struct{}
+// Header is a Parameter without name and in, when Ref is set it's a Reference Object.
+type Header struct {
+	Ref             string               `json:"$ref,omitempty"`
+	Description     string               `json:"description,omitempty"`
+	Required        bool                 `json:"required,omitempty"`
+	Deprecated      bool                 `json:"deprecated,omitempty"`
+	AllowEmptyValue bool                 `json:"allowEmptyValue,omitempty"`
+	Style           string               `json:"style,omitempty"`
+	Explode         *bool                `json:"explode,omitempty"`
+	AllowReserved   bool                 `json:"allowReserved,omitempty"`
+	Schema          *Schema              `json:"schema,omitempty"`
+	Example         any                  `json:"example,omitempty"`
+	Examples        map[string]Example   `json:"examples,omitempty"`
+	Content         map[string]MediaType `json:"content,omitempty"`
+	Extensions      Extensions           `json:"-"`
+}
+
+// SecurityScheme defines a security scheme that can be used by operations, when Ref is set it's a Reference Object.
+type SecurityScheme struct {
+	Ref              string      `json:"$ref,omitempty"`
+	Type             string      `json:"type,omitempty"`
+	Description      string      `json:"description,omitempty"`
+	Name             string      `json:"name,omitempty"`
+	In               string      `json:"in,omitempty"`
+	Scheme           string      `json:"scheme,omitempty"`
+	BearerFormat     string      `json:"bearerFormat,omitempty"`
+	Flows            *OAuthFlows `json:"flows,omitempty"`
+	OpenIdConnectURL string      `json:"openIdConnectUrl,omitempty"`
+	Extensions       Extensions  `json:"-"`
+}
 
-type Link struct{}
+// Deprecated: use SecurityScheme.
+type SecuritySchema = SecurityScheme
+
+type OAuthFlows struct {
+	Implicit          *OAuthFlow `json:"implicit,omitempty"`
+	Password          *OAuthFlow `json:"password,omitempty"`
+	ClientCredentials *OAuthFlow `json:"clientCredentials,omitempty"`
+	AuthorizationCode *OAuthFlow `json:"authorizationCode,omitempty"`
+	Extensions        Extensions `json:"-"`
+}
+
+type OAuthFlow struct {
+	AuthorizationURL string            `json:"authorizationUrl,omitempty"`
+	TokenURL         string            `json:"tokenUrl,omitempty"`
+	RefreshURL       string            `json:"refreshUrl,omitempty"`
+	Scopes           map[string]string `json:"scopes"`
+	Extensions       Extensions        `json:"-"`
+}
+
+// Link describes a possible design-time link for a response, when Ref is set it's a Reference Object.
+type Link struct {
+	Ref          string         `json:"$ref,omitempty"`
+	OperationRef string         `json:"operationRef,omitempty"`
+	OperationId  string         `json:"operationId,omitempty"`
+	Parameters   map[string]any `json:"parameters,omitempty"`
+	RequestBody  any            `json:"requestBody,omitempty"`
+	Description  string         `json:"description,omitempty"`
+	Server       *Server        `json:"server,omitempty"`
+	Extensions   Extensions     `json:"-"`
+}
 
 type Components struct {
-	Schemas         map[string]Schema
-	Responses       map[string]Response
-	Parameters      map[string]Parameter
-	Examples        map[string]Example
-	RequestBodies   map[string]RequestBody
-	Headers         map[string]Header
-	SecuritySchemas map[string]SecuritySchema
-	Links           map[string]Link
-	PathItems       map[string]PathItem
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	Responses       map[string]Response       `json:"responses,omitempty"`
+	Parameters      map[string]Parameter      `json:"parameters,omitempty"`
+	Examples        map[string]Example        `json:"examples,omitempty"`
+	RequestBodies   map[string]RequestBody    `json:"requestBodies,omitempty"`
+	Headers         map[string]Header         `json:"headers,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+	Links           map[string]Link           `json:"links,omitempty"`
+	Callbacks       map[string]Callback       `json:"callbacks,omitempty"`
+	PathItems       map[string]PathItem       `json:"pathItems,omitempty"`
+	Extensions      Extensions                `json:"-"`
+}
+
+// Schema is a JSON Schema as used by OpenAPI, it covers draft 2020-12 keywords (3.1) and
+// OpenAPI 3.0 specific ones like nullable. Boolean schemas (`true`/`false`) are represented by Boolean.
+type Schema struct {
+	Boolean *bool `json:"-"`
+
+	Ref           string             `json:"$ref,omitempty"`
+	SchemaDialect string             `json:"$schema,omitempty"`
+	ID            string             `json:"$id,omitempty"`
+	Anchor        string             `json:"$anchor,omitempty"`
+	DynamicRef    string             `json:"$dynamicRef,omitempty"`
+	DynamicAnchor string             `json:"$dynamicAnchor,omitempty"`
+	Defs          map[string]*Schema `json:"$defs,omitempty"`
+	Comment       string             `json:"$comment,omitempty"`
+
+	Type  Types `json:"type,omitempty"`
+	Enum  []any `json:"enum,omitempty"`
+	Const any   `json:"const,omitempty"`
+
+	MultipleOf *float64 `json:"multipleOf,omitempty"`
+	Maximum    *float64 `json:"maximum,omitempty"`
+	// ExclusiveMaximum is a bool in OpenAPI 3.0 and a number in 3.1.
+	ExclusiveMaximum any      `json:"exclusiveMaximum,omitempty"`
+	Minimum          *float64 `json:"minimum,omitempty"`
+	// ExclusiveMinimum is a bool in OpenAPI 3.0 and a number in 3.1.
+	ExclusiveMinimum  any                 `json:"exclusiveMinimum,omitempty"`
+	MaxLength         *int                `json:"maxLength,omitempty"`
+	MinLength         *int                `json:"minLength,omitempty"`
+	Pattern           string              `json:"pattern,omitempty"`
+	MaxItems          *int                `json:"maxItems,omitempty"`
+	MinItems          *int                `json:"minItems,omitempty"`
+	UniqueItems       bool                `json:"uniqueItems,omitempty"`
+	MaxContains       *int                `json:"maxContains,omitempty"`
+	MinContains       *int                `json:"minContains,omitempty"`
+	MaxProperties     *int                `json:"maxProperties,omitempty"`
+	MinProperties     *int                `json:"minProperties,omitempty"`
+	Required          []string            `json:"required,omitempty"`
+	DependentRequired map[string][]string `json:"dependentRequired,omitempty"`
+
+	AllOf                 []*Schema          `json:"allOf,omitempty"`
+	AnyOf                 []*Schema          `json:"anyOf,omitempty"`
+	OneOf                 []*Schema          `json:"oneOf,omitempty"`
+	Not                   *Schema            `json:"not,omitempty"`
+	If                    *Schema            `json:"if,omitempty"`
+	Then                  *Schema            `json:"then,omitempty"`
+	Else                  *Schema            `json:"else,omitempty"`
+	DependentSchemas      map[string]*Schema `json:"dependentSchemas,omitempty"`
+	PrefixItems           []*Schema          `json:"prefixItems,omitempty"`
+	Items                 *Schema            `json:"items,omitempty"`
+	Contains              *Schema            `json:"contains,omitempty"`
+	Properties            map[string]*Schema `json:"properties,omitempty"`
+	PatternProperties     map[string]*Schema `json:"patternProperties,omitempty"`
+	AdditionalProperties  *Schema            `json:"additionalProperties,omitempty"`
+	PropertyNames         *Schema            `json:"propertyNames,omitempty"`
+	UnevaluatedItems      *Schema            `json:"unevaluatedItems,omitempty"`
+	UnevaluatedProperties *Schema            `json:"unevaluatedProperties,omitempty"`
+
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Default     any    `json:"default,omitempty"`
+	Deprecated  bool   `json:"deprecated,omitempty"`
+	ReadOnly    bool   `json:"readOnly,omitempty"`
+	WriteOnly   bool   `json:"writeOnly,omitempty"`
+	Examples    []any  `json:"examples,omitempty"`
+
+	ContentEncoding  string  `json:"contentEncoding,omitempty"`
+	ContentMediaType string  `json:"contentMediaType,omitempty"`
+	ContentSchema    *Schema `json:"contentSchema,omitempty"`
+
+	// OpenAPI specific keywords, Nullable and Example are only meaningful in 3.0.
+	Nullable      bool                   `json:"nullable,omitempty"`
+	Example       any                    `json:"example,omitempty"`
+	Discriminator *Discriminator         `json:"discriminator,omitempty"`
+	XML           *XML                   `json:"xml,omitempty"`
+	ExternalDocs  *ExternalDocumentation `json:"externalDocs,omitempty"`
+
+	Extensions Extensions `json:"-"`
+}
+
+// Types is value of schema `type` keyword, it's encoded as a string when it has a single item.
+type Types []string
+
+func (t Types) Contains(typ string) bool {
+	for _, tt := range t {
+		if tt == typ {
+			return true
+		}
+	}
+	return false
+}
+
+type Discriminator struct {
+	PropertyName string            `json:"propertyName"`
+	Mapping      map[string]string `json:"mapping,omitempty"`
+	Extensions   Extensions        `json:"-"`
+}
+
+type XML struct {
+	Name       string     `json:"name,omitempty"`
+	Namespace  string     `json:"namespace,omitempty"`
+	Prefix     string     `json:"prefix,omitempty"`
+	Attribute  bool       `json:"attribute,omitempty"`
+	Wrapped    bool       `json:"wrapped,omitempty"`
+	Extensions Extensions `json:"-"`
 }
@@ -0,0 +1,193 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	is := is.New(t)
+	doc, err := ParseFile("testdata/petstore.yaml")
+	is.NoErr(err)
+	is.NoErr(doc.Validate())
+
+	is.Equal(doc.OpenAPI, "3.0.3")
+	is.Equal(doc.Info.Extensions["x-logo"], "https://example.com/logo.png")
+	list := doc.Paths.Items["/pets"].Get
+	is.Equal(list.OperationId, "listPets")
+	is.Equal(*list.Parameters[0].Schema.Maximum, 100.0)
+	is.Equal(list.Responses.Codes["200"].Content["application/json"].Schema.Ref, "#/components/schemas/Pets")
+	is.Equal(list.Responses.Codes["default"].Ref, "#/components/responses/Error")
+	is.True(list.Security == nil)
+	is.True(doc.Paths.Items["/pets"].Post.Security != nil)
+	is.Equal(len(doc.Paths.Items["/pets"].Post.Security), 0)
+	is.Equal(doc.Paths.Items["/pets/{petId}"].Get.Extensions["x-internal"], true)
+	is.Equal(*doc.Components.Schemas["Pet"].AdditionalProperties.Boolean, false)
+	is.True(doc.Components.Schemas["Pet"].Properties["tag"].Nullable)
+
+	// json -> document -> json must be stable.
+	first, err := json.Marshal(doc)
+	is.NoErr(err)
+	again, err := Parse(first)
+	is.NoErr(err)
+	second, err := json.Marshal(again)
+	is.NoErr(err)
+	is.Equal(string(first), string(second))
+	is.True(json.Valid(first))
+
+	var raw map[string]any
+	is.NoErr(json.Unmarshal(first, &raw))
+	post := raw["paths"].(map[string]any)["/pets"].(map[string]any)["post"].(map[string]any)
+	is.Equal(post["security"], []any{})
+	errorRef := raw["paths"].(map[string]any)["/pets"].(map[string]any)["get"].(map[string]any)["responses"].(map[string]any)["default"]
+	is.Equal(errorRef, map[string]any{"$ref": "#/components/responses/Error"})
+
+	// document -> yaml -> document must be the same.
+	yml, err := doc.YAML()
+	is.NoErr(err)
+	fromYAML, err := Parse(yml)
+	is.NoErr(err)
+	third, err := json.Marshal(fromYAML)
+	is.NoErr(err)
+	is.Equal(string(first), string(third))
+}
+
+func TestParse31(t *testing.T) {
+	is := is.New(t)
+	doc, err := Parse([]byte(`{
+		"openapi": "3.1.0",
+		"info": {"title": "webhooks", "version": "1"},
+		"jsonSchemaDialect": "https://spec.openapis.org/oas/3.1/dialect/base",
+		"webhooks": {
+			"newPet": {
+				"post": {
+					"requestBody": {"content": {"application/json": {"schema": {"type": ["string", "null"], "exclusiveMinimum": 1}}}},
+					"responses": {"200": {"description": "ok"}}
+				}
+			}
+		}
+	}`))
+	is.NoErr(err)
+	is.NoErr(doc.Validate())
+	is.Equal(doc.JSONSchemaDialect, "https://spec.openapis.org/oas/3.1/dialect/base")
+	schema := doc.Webhooks["newPet"].Post.RequestBody.Content["application/json"].Schema
+	is.Equal(schema.Type, Types{"string", "null"})
+	is.Equal(schema.ExclusiveMinimum, 1.0)
+
+	bs, err := json.Marshal(schema)
+	is.NoErr(err)
+	is.Equal(string(bs), `{"type":["string","null"],"exclusiveMinimum":1}`)
+}
+
+func TestValidate(t *testing.T) {
+	is := is.New(t)
+	doc := &Document{
+		OpenAPI: "3.0.0",
+		Info:    Info{Title: "broken"},
+		Paths: &Paths{Items: map[string]PathItem{
+			"/users/{id}": {
+				Get: &Operation{
+					OperationId: "getUser",
+					Parameters:  []Parameter{{Name: "q", In: "body"}},
+					Responses: &Responses{Codes: map[string]Response{
+						"200": {Content: map[string]MediaType{"application/json": {Schema: &Schema{Ref: "#/components/schemas/User"}}}},
+						"99":  {Description: "weird"},
+					}},
+					Security: []SecurityRequirement{{"jwt": nil}},
+				},
+			},
+			"users": {Get: &Operation{OperationId: "getUser", Responses: &Responses{Codes: map[string]Response{"200": {Description: "ok"}}}}},
+		}},
+	}
+
+	err := doc.Validate()
+	var verrs ValidationErrors
+	is.True(errors.As(err, &verrs))
+
+	pointers := map[string]string{}
+	for _, verr := range verrs {
+		pointers[verr.Pointer] += verr.Message
+	}
+	is.True(pointers["/info/version"] != "")
+	is.True(pointers["/paths/~1users~1{id}/get/parameters"] != "")
+	is.True(pointers["/paths/~1users~1{id}/get/parameters/0/in"] != "")
+	is.True(pointers["/paths/~1users~1{id}/get/responses/200/description"] != "")
+	is.True(pointers["/paths/~1users~1{id}/get/responses/200/content/application~1json/schema/$ref"] != "")
+	is.True(pointers["/paths/~1users~1{id}/get/responses/99"] != "")
+	is.True(pointers["/paths/~1users~1{id}/get/security/0/jwt"] != "")
+	is.True(pointers["/paths/users"] != "")
+	is.True(pointers["/paths/users/get/operationId"] != "" || pointers["/paths/~1users~1{id}/get/operationId"] != "")
+}
+
+func TestParseExtensionsAndMerges(t *testing.T) {
+	is := is.New(t)
+	doc, err := Parse([]byte(`
+openapi: 3.1.0
+info: {title: merges, version: "1"}
+x-defaults:
+  error: &error
+    description: failed
+    content:
+      application/json:
+        schema: {type: object}
+paths:
+  x-owner: payments
+  /payments:
+    post:
+      responses:
+        x-retry: true
+        "200":
+          description: ok
+        "500":
+          <<: *error
+          description: server failed
+        "503": *error
+      callbacks:
+        settled:
+          x-async: true
+          "{$request.body#/callback}":
+            post:
+              responses:
+                "200": {description: ok}
+              parameters:
+                - name: id
+                  in: query
+                  schema:
+                    type: string
+                    pattern: "^(?!0)\\d+$"
+`))
+	is.NoErr(err)
+	is.NoErr(doc.Validate()) // ECMA-262 patterns are accepted
+
+	is.Equal(doc.Paths.Extensions["x-owner"], "payments")
+	post := doc.Paths.Items["/payments"].Post
+	is.Equal(post.Responses.Extensions["x-retry"], true)
+	is.Equal(post.Callbacks["settled"].Extensions["x-async"], true)
+	is.True(post.Callbacks["settled"].Expressions["{$request.body#/callback}"].Post != nil)
+	// keys of a mapping override merged ones.
+	is.Equal(post.Responses.Codes["500"].Description, "server failed")
+	is.True(post.Responses.Codes["500"].Content["application/json"].Schema != nil)
+	is.Equal(post.Responses.Codes["503"].Description, "failed")
+
+	first, err := json.Marshal(doc)
+	is.NoErr(err)
+	again, err := Parse(first)
+	is.NoErr(err)
+	second, err := json.Marshal(again)
+	is.NoErr(err)
+	is.Equal(string(first), string(second))
+	is.Equal(again.Paths.Extensions["x-owner"], "payments")
+	is.Equal(again.Paths.Items["/payments"].Post.Responses.Extensions["x-retry"], true)
+	is.Equal(again.Paths.Items["/payments"].Post.Callbacks["settled"].Extensions["x-async"], true)
+
+	yml, err := doc.YAML()
+	is.NoErr(err)
+	fromYAML, err := Parse(yml)
+	is.NoErr(err)
+	third, err := json.Marshal(fromYAML)
+	is.NoErr(err)
+	is.Equal(string(first), string(third))
+}
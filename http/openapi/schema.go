@@ -0,0 +1,192 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	rawMessageType      = reflect.TypeOf(json.RawMessage{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	schemaComponentsRef = "#/components/schemas/"
+)
+
+// SchemaGenerator derives JSON schemas from Go types, named struct types are
+// registered once in Components.Schemas and referenced using $ref.
+type SchemaGenerator struct {
+	Components *Components
+	names      map[reflect.Type]string
+}
+
+func NewSchemaGenerator(components *Components) *SchemaGenerator {
+	if components.Schemas == nil {
+		components.Schemas = map[string]*Schema{}
+	}
+	return &SchemaGenerator{Components: components, names: map[reflect.Type]string{}}
+}
+
+// Schema returns the schema of t as it would be encoded by encoding/json.
+func (g *SchemaGenerator) Schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: Types{"string"}, Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return &Schema{Type: Types{"string"}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: Types{"integer"}, Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: Types{"integer"}, Format: "int32"}
+	case reflect.Float32:
+		return &Schema{Type: Types{"number"}, Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: Types{"number"}, Format: "double"}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Types{"string"}, Format: "byte"}
+		}
+		return &Schema{Type: Types{"array"}, Items: g.Schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: Types{"object"}, AdditionalProperties: g.Schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return &Schema{Ref: schemaComponentsRef + g.register(t)}
+	default:
+		// interfaces, funcs and channels, any value is accepted.
+		return &Schema{}
+	}
+}
+
+func (g *SchemaGenerator) register(t reflect.Type) string {
+	if name, exists := g.names[t]; exists {
+		return name
+	}
+	name := t.Name()
+	if _, taken := g.Components.Schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = strings.ReplaceAll(pkg[strings.LastIndex(pkg, "/")+1:], ".", "_") + "." + name
+	}
+	base := name
+	for i := 2; ; i++ {
+		if _, taken := g.Components.Schemas[name]; !taken {
+			break
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	g.names[t] = name
+	// reserve the name before generating fields so recursive types end up as a $ref to themselves.
+	g.Components.Schemas[name] = &Schema{}
+	*g.Components.Schemas[name] = *g.structSchema(t)
+
+	return name
+}
+
+// ObjectSchema returns an inline schema for struct type t without registering it as a component,
+// fields of t for which skip returns true are left out. Nested types are handled like Schema does.
+func (g *SchemaGenerator) ObjectSchema(t reflect.Type, skip func(reflect.StructField) bool) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	s := &Schema{Type: Types{"object"}, Properties: map[string]*Schema{}}
+	g.addFields(s, t, skip)
+	return s
+}
+
+func (g *SchemaGenerator) structSchema(t reflect.Type) *Schema {
+	return g.ObjectSchema(t, nil)
+}
+
+func (g *SchemaGenerator) addFields(s *Schema, t reflect.Type, skipField func(reflect.StructField) bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, skip := JSONFieldName(field)
+		if skip || (skipField != nil && skipField(field)) {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft, skipField)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			name = ft.Name()
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		var fieldSchema *Schema
+		if strings.Contains(opts, "string") && isScalar(field.Type) {
+			fieldSchema = &Schema{Type: Types{"string"}}
+		} else {
+			fieldSchema = g.Schema(field.Type)
+		}
+		if description := field.Tag.Get("doc"); description != "" {
+			if fieldSchema.Ref != "" {
+				// siblings of $ref are allowed in 3.1, but keep the referenced schema untouched.
+				fieldSchema = &Schema{Ref: fieldSchema.Ref}
+			}
+			fieldSchema.Description = description
+		}
+		s.Properties[name] = fieldSchema
+
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") && field.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// JSONFieldName returns the name and options of a struct field as encoding/json sees it,
+// name is empty when json tag has no name, skip is true for unexported and `json:"-"` fields.
+func JSONFieldName(field reflect.StructField) (name string, opts string, skip bool) {
+	if !field.IsExported() && !field.Anonymous {
+		return "", "", true
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", "", true
+	}
+	name, opts, _ = strings.Cut(tag, ",")
+	return name, opts, false
+}
+
+func isScalar(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
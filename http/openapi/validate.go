@@ -0,0 +1,565 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	versionRegex      = regexp.MustCompile(`^3\.[01]\.\d+(-.+)?$`)
+	componentKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9\.\-_]+$`)
+	pathParamRegex    = regexp.MustCompile(`\{([^{}]+)\}`)
+	statusCodeRegex   = regexp.MustCompile(`^([1-5]XX|[1-5]\d\d|default)$`)
+	schemaTypes       = map[string]bool{"null": true, "boolean": true, "object": true, "array": true, "number": true, "string": true, "integer": true}
+	parameterIns      = map[string]bool{"query": true, "header": true, "path": true, "cookie": true}
+)
+
+// ValidationError is a single structural problem of a document, Pointer is the JSON pointer of the invalid value.
+type ValidationError struct {
+	Pointer string
+	Message string
+}
+
+func (v ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", v.Pointer, v.Message)
+}
+
+// ValidationErrors is returned by Document.Validate and contains every problem found.
+type ValidationErrors []ValidationError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, err := range v {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate checks the structure of d against OpenAPI 3.0/3.1 rules, it reports missing required
+// fields, invalid values, undeclared path parameters, duplicate operation ids and local `$ref`s that cannot be resolved.
+// Returned error is of type ValidationErrors.
+func (d *Document) Validate() error {
+	v := &validator{doc: d, operationIDs: map[string]string{}}
+	v.validate()
+	if len(v.errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.errs, func(i, j int) bool { return v.errs[i].Pointer < v.errs[j].Pointer })
+	return v.errs
+}
+
+type validator struct {
+	doc          *Document
+	errs         ValidationErrors
+	operationIDs map[string]string
+	refs         []ValidationError // Pointer is where the ref is, Message is the ref.
+	is31         bool
+}
+
+// pointer joins tokens into a JSON pointer escaping `~` and `/` as RFC 6901 describes.
+func pointer(base string, tokens ...string) string {
+	var sb strings.Builder
+	sb.WriteString(base)
+	for _, token := range tokens {
+		sb.WriteByte('/')
+		sb.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return sb.String()
+}
+
+func (v *validator) errorf(ptr string, format string, args ...any) {
+	v.errs = append(v.errs, ValidationError{Pointer: ptr, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) ref(ptr string, ref string) {
+	if ref != "" {
+		v.refs = append(v.refs, ValidationError{Pointer: ptr, Message: ref})
+	}
+}
+
+func (v *validator) validate() {
+	d := v.doc
+	if d.OpenAPI == "" {
+		v.errorf("/openapi", "is required")
+	} else if !versionRegex.MatchString(d.OpenAPI) {
+		v.errorf("/openapi", "unsupported version %q, only 3.0.x and 3.1.x are supported", d.OpenAPI)
+	}
+	v.is31 = strings.HasPrefix(d.OpenAPI, "3.1")
+
+	if d.Info.Title == "" {
+		v.errorf("/info/title", "is required")
+	}
+	if d.Info.Version == "" {
+		v.errorf("/info/version", "is required")
+	}
+	if d.Info.License != nil && d.Info.License.Name == "" {
+		v.errorf("/info/license/name", "is required")
+	}
+	if d.Info.License != nil && d.Info.License.Identifier != "" && d.Info.License.URL != "" {
+		v.errorf("/info/license", "identifier and url are mutually exclusive")
+	}
+
+	if v.is31 {
+		if d.Paths == nil && d.Webhooks == nil && d.Components == nil {
+			v.errorf("", "at least one of paths, webhooks or components is required")
+		}
+	} else if d.Paths == nil {
+		v.errorf("/paths", "is required")
+	}
+
+	v.servers("/servers", d.Servers)
+	var paths map[string]PathItem
+	if d.Paths != nil {
+		paths = d.Paths.Items
+	}
+	for path, item := range paths {
+		ptr := pointer("/paths", path)
+		if !strings.HasPrefix(path, "/") {
+			v.errorf(ptr, "path must begin with '/'")
+		}
+		v.pathItem(ptr, path, item)
+	}
+	for name, item := range d.Webhooks {
+		v.pathItem(pointer("/webhooks", name), "", item)
+	}
+	if d.Components != nil {
+		v.components("/components", d.Components)
+	}
+	v.securityRequirements("/security", d.Security)
+	for i, tag := range d.Tags {
+		if tag.Name == "" {
+			v.errorf(pointer("/tags", strconv.Itoa(i), "name"), "is required")
+		}
+	}
+	v.resolveRefs()
+}
+
+func (v *validator) servers(ptr string, servers []Server) {
+	for i, server := range servers {
+		sptr := pointer(ptr, strconv.Itoa(i))
+		if server.URL == "" {
+			v.errorf(sptr+"/url", "is required")
+		}
+		for name, variable := range server.Variables {
+			vptr := pointer(sptr+"/variables", name)
+			if len(variable.Enum) > 0 {
+				found := false
+				for _, e := range variable.Enum {
+					found = found || e == variable.Default
+				}
+				if !found {
+					v.errorf(vptr+"/default", "default value %q is not in enum", variable.Default)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) pathItem(ptr string, path string, item PathItem) {
+	v.ref(ptr, item.Ref)
+	v.servers(ptr+"/servers", item.Servers)
+	v.parameters(ptr+"/parameters", item.Parameters)
+
+	for method, op := range item.Operations() {
+		optr := pointer(ptr, method)
+		v.operation(optr, op)
+		if path == "" {
+			continue
+		}
+		for _, match := range pathParamRegex.FindAllStringSubmatch(path, -1) {
+			if !hasPathParameter(match[1], op.Parameters) && !hasPathParameter(match[1], item.Parameters) {
+				v.errorf(optr+"/parameters", "path parameter %q is not declared", match[1])
+			}
+		}
+	}
+}
+
+// hasPathParameter reports whether params contains path parameter name, references are assumed to declare it.
+func hasPathParameter(name string, params []Parameter) bool {
+	for _, p := range params {
+		if p.Ref != "" || (p.In == "path" && p.Name == name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) operation(ptr string, op *Operation) {
+	if op.OperationId != "" {
+		if other, exists := v.operationIDs[op.OperationId]; exists {
+			v.errorf(ptr+"/operationId", "operationId %q is already used by %s", op.OperationId, other)
+		} else {
+			v.operationIDs[op.OperationId] = ptr
+		}
+	}
+	v.parameters(ptr+"/parameters", op.Parameters)
+	if op.RequestBody != nil {
+		v.requestBody(ptr+"/requestBody", *op.RequestBody)
+	}
+	if op.Responses == nil && !v.is31 {
+		v.errorf(ptr+"/responses", "is required")
+	} else if op.Responses != nil && len(op.Responses.Codes) == 0 {
+		v.errorf(ptr+"/responses", "must contain at least one response")
+	}
+	var responses map[string]Response
+	if op.Responses != nil {
+		responses = op.Responses.Codes
+	}
+	for code, response := range responses {
+		rptr := pointer(ptr+"/responses", code)
+		if !statusCodeRegex.MatchString(code) {
+			v.errorf(rptr, "invalid response code %q", code)
+		}
+		v.response(rptr, response)
+	}
+	for name, callback := range op.Callbacks {
+		for expression, item := range callback.Expressions {
+			v.pathItem(pointer(ptr+"/callbacks", name, expression), "", item)
+		}
+	}
+	v.securityRequirements(ptr+"/security", op.Security)
+	v.servers(ptr+"/servers", op.Servers)
+}
+
+func (v *validator) parameters(ptr string, params []Parameter) {
+	seen := map[string]bool{}
+	for i, p := range params {
+		pptr := pointer(ptr, strconv.Itoa(i))
+		if p.Ref != "" {
+			v.ref(pptr, p.Ref)
+			continue
+		}
+		key := p.In + ":" + p.Name
+		if seen[key] {
+			v.errorf(pptr, "duplicate parameter %q in %s", p.Name, p.In)
+		}
+		seen[key] = true
+		v.parameter(pptr, p)
+	}
+}
+
+func (v *validator) parameter(ptr string, p Parameter) {
+	if p.Ref != "" {
+		v.ref(ptr, p.Ref)
+		return
+	}
+	if p.Name == "" {
+		v.errorf(ptr+"/name", "is required")
+	}
+	if p.In == "" {
+		v.errorf(ptr+"/in", "is required")
+	} else if !parameterIns[p.In] {
+		v.errorf(ptr+"/in", "must be one of query, header, path or cookie, got %q", p.In)
+	}
+	if p.In == "path" && !p.Required {
+		v.errorf(ptr+"/required", "must be true for path parameters")
+	}
+	v.schemaOrContent(ptr, p.Schema, p.Content)
+	v.examples(ptr+"/examples", p.Examples)
+}
+
+func (v *validator) schemaOrContent(ptr string, schema *Schema, content map[string]MediaType) {
+	if schema != nil && content != nil {
+		v.errorf(ptr, "schema and content are mutually exclusive")
+	}
+	if content != nil && len(content) != 1 {
+		v.errorf(ptr+"/content", "must contain exactly one entry")
+	}
+	if schema != nil {
+		v.schema(ptr+"/schema", schema)
+	}
+	v.content(ptr+"/content", content)
+}
+
+func (v *validator) content(ptr string, content map[string]MediaType) {
+	for mediaType, mt := range content {
+		mptr := pointer(ptr, mediaType)
+		if mt.Schema != nil {
+			v.schema(mptr+"/schema", mt.Schema)
+		}
+		v.examples(mptr+"/examples", mt.Examples)
+		for name, encoding := range mt.Encoding {
+			v.headers(pointer(mptr+"/encoding", name, "headers"), encoding.Headers)
+		}
+	}
+}
+
+func (v *validator) examples(ptr string, examples map[string]Example) {
+	for name, example := range examples {
+		eptr := pointer(ptr, name)
+		v.ref(eptr, example.Ref)
+		if example.Value != nil && example.ExternalValue != "" {
+			v.errorf(eptr, "value and externalValue are mutually exclusive")
+		}
+	}
+}
+
+func (v *validator) headers(ptr string, headers map[string]Header) {
+	for name, header := range headers {
+		v.header(pointer(ptr, name), header)
+	}
+}
+
+func (v *validator) header(ptr string, h Header) {
+	if h.Ref != "" {
+		v.ref(ptr, h.Ref)
+		return
+	}
+	v.schemaOrContent(ptr, h.Schema, h.Content)
+	v.examples(ptr+"/examples", h.Examples)
+}
+
+func (v *validator) requestBody(ptr string, body RequestBody) {
+	if body.Ref != "" {
+		v.ref(ptr, body.Ref)
+		return
+	}
+	if body.Content == nil {
+		v.errorf(ptr+"/content", "is required")
+	}
+	v.content(ptr+"/content", body.Content)
+}
+
+func (v *validator) response(ptr string, response Response) {
+	if response.Ref != "" {
+		v.ref(ptr, response.Ref)
+		return
+	}
+	if response.Description == "" {
+		v.errorf(ptr+"/description", "is required")
+	}
+	v.headers(ptr+"/headers", response.Headers)
+	v.content(ptr+"/content", response.Content)
+	for name, link := range response.Links {
+		v.link(pointer(ptr+"/links", name), link)
+	}
+}
+
+func (v *validator) link(ptr string, link Link) {
+	if link.Ref != "" {
+		v.ref(ptr, link.Ref)
+		return
+	}
+	if link.OperationId != "" && link.OperationRef != "" {
+		v.errorf(ptr, "operationId and operationRef are mutually exclusive")
+	}
+}
+
+func (v *validator) schema(ptr string, s *Schema) {
+	if s == nil || s.Boolean != nil {
+		return
+	}
+	v.ref(ptr, s.Ref)
+	for i, t := range s.Type {
+		if !schemaTypes[t] {
+			v.errorf(pointer(ptr+"/type", strconv.Itoa(i)), "invalid type %q", t)
+		}
+	}
+	if len(s.Type) > 1 && !v.is31 {
+		v.errorf(ptr+"/type", "multiple types are only supported in OpenAPI 3.1")
+	}
+	// patterns are ECMA-262 regular expressions, which RE2 cannot compile when they use lookarounds or
+	// backreferences, so they are not checked.
+	if s.Discriminator != nil && s.Discriminator.PropertyName == "" {
+		v.errorf(ptr+"/discriminator/propertyName", "is required")
+	}
+	for name, sub := range s.Properties {
+		v.schema(pointer(ptr+"/properties", name), sub)
+	}
+	for name, sub := range s.PatternProperties {
+		v.schema(pointer(ptr+"/patternProperties", name), sub)
+	}
+	for name, sub := range s.Defs {
+		v.schema(pointer(ptr+"/$defs", name), sub)
+	}
+	for name, sub := range s.DependentSchemas {
+		v.schema(pointer(ptr+"/dependentSchemas", name), sub)
+	}
+	for keyword, subs := range map[string][]*Schema{"allOf": s.AllOf, "anyOf": s.AnyOf, "oneOf": s.OneOf, "prefixItems": s.PrefixItems} {
+		for i, sub := range subs {
+			v.schema(pointer(ptr, keyword, strconv.Itoa(i)), sub)
+		}
+	}
+	for keyword, sub := range map[string]*Schema{
+		"not": s.Not, "if": s.If, "then": s.Then, "else": s.Else, "items": s.Items, "contains": s.Contains,
+		"additionalProperties": s.AdditionalProperties, "propertyNames": s.PropertyNames,
+		"unevaluatedItems": s.UnevaluatedItems, "unevaluatedProperties": s.UnevaluatedProperties, "contentSchema": s.ContentSchema,
+	} {
+		v.schema(pointer(ptr, keyword), sub)
+	}
+}
+
+func (v *validator) securityRequirements(ptr string, reqs []SecurityRequirement) {
+	for i, req := range reqs {
+		for name := range req {
+			if v.doc.Components == nil {
+				v.errorf(pointer(ptr, strconv.Itoa(i), name), "security scheme %q is not defined in components", name)
+				continue
+			}
+			if _, exists := v.doc.Components.SecuritySchemes[name]; !exists {
+				v.errorf(pointer(ptr, strconv.Itoa(i), name), "security scheme %q is not defined in components", name)
+			}
+		}
+	}
+}
+
+func (v *validator) securityScheme(ptr string, s SecurityScheme) {
+	if s.Ref != "" {
+		v.ref(ptr, s.Ref)
+		return
+	}
+	switch s.Type {
+	case "":
+		v.errorf(ptr+"/type", "is required")
+	case "apiKey":
+		if s.Name == "" {
+			v.errorf(ptr+"/name", "is required for apiKey security schemes")
+		}
+		if s.In != "query" && s.In != "header" && s.In != "cookie" {
+			v.errorf(ptr+"/in", "must be one of query, header or cookie")
+		}
+	case "http":
+		if s.Scheme == "" {
+			v.errorf(ptr+"/scheme", "is required for http security schemes")
+		}
+	case "oauth2":
+		if s.Flows == nil {
+			v.errorf(ptr+"/flows", "is required for oauth2 security schemes")
+			return
+		}
+		v.oauthFlow(ptr+"/flows/implicit", s.Flows.Implicit, true, false)
+		v.oauthFlow(ptr+"/flows/password", s.Flows.Password, false, true)
+		v.oauthFlow(ptr+"/flows/clientCredentials", s.Flows.ClientCredentials, false, true)
+		v.oauthFlow(ptr+"/flows/authorizationCode", s.Flows.AuthorizationCode, true, true)
+	case "openIdConnect":
+		if s.OpenIdConnectURL == "" {
+			v.errorf(ptr+"/openIdConnectUrl", "is required for openIdConnect security schemes")
+		}
+	case "mutualTLS":
+		if !v.is31 {
+			v.errorf(ptr+"/type", "mutualTLS is only supported in OpenAPI 3.1")
+		}
+	default:
+		v.errorf(ptr+"/type", "invalid security scheme type %q", s.Type)
+	}
+}
+
+func (v *validator) oauthFlow(ptr string, flow *OAuthFlow, needsAuthorizationURL bool, needsTokenURL bool) {
+	if flow == nil {
+		return
+	}
+	if needsAuthorizationURL && flow.AuthorizationURL == "" {
+		v.errorf(ptr+"/authorizationUrl", "is required")
+	}
+	if needsTokenURL && flow.TokenURL == "" {
+		v.errorf(ptr+"/tokenUrl", "is required")
+	}
+}
+
+func (v *validator) components(ptr string, c *Components) {
+	checkKey := func(kind string, key string) string {
+		kptr := pointer(ptr, kind, key)
+		if !componentKeyRegex.MatchString(key) {
+			v.errorf(kptr, "component name %q must match %s", key, componentKeyRegex)
+		}
+		return kptr
+	}
+	for name, schema := range c.Schemas {
+		v.schema(checkKey("schemas", name), schema)
+	}
+	for name, response := range c.Responses {
+		v.response(checkKey("responses", name), response)
+	}
+	for name, param := range c.Parameters {
+		v.parameter(checkKey("parameters", name), param)
+	}
+	for name, example := range c.Examples {
+		checkKey("examples", name)
+		v.examples(pointer(ptr, "examples"), map[string]Example{name: example})
+	}
+	for name, body := range c.RequestBodies {
+		v.requestBody(checkKey("requestBodies", name), body)
+	}
+	for name, header := range c.Headers {
+		v.header(checkKey("headers", name), header)
+	}
+	for name, scheme := range c.SecuritySchemes {
+		v.securityScheme(checkKey("securitySchemes", name), scheme)
+	}
+	for name, link := range c.Links {
+		v.link(checkKey("links", name), link)
+	}
+	for name, callback := range c.Callbacks {
+		cptr := checkKey("callbacks", name)
+		for expression, item := range callback.Expressions {
+			v.pathItem(pointer(cptr, expression), "", item)
+		}
+	}
+	for name, item := range c.PathItems {
+		v.pathItem(checkKey("pathItems", name), "", item)
+	}
+}
+
+// resolveRefs checks that every local reference (starting with `#`) points to an existing value.
+func (v *validator) resolveRefs() {
+	if len(v.refs) == 0 {
+		return
+	}
+	bs, err := json.Marshal(v.doc)
+	if err != nil {
+		v.errorf("", "cannot encode document to resolve references: %s", err)
+		return
+	}
+	var root any
+	if err := json.Unmarshal(bs, &root); err != nil {
+		v.errorf("", "cannot decode document to resolve references: %s", err)
+		return
+	}
+	for _, ref := range v.refs {
+		target, isLocal := strings.CutPrefix(ref.Message, "#")
+		if !isLocal {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(target); err == nil {
+			target = unescaped
+		}
+		if _, ok := resolvePointer(root, target); !ok {
+			v.errorf(ref.Pointer+"/$ref", "cannot resolve reference %q", ref.Message)
+		}
+	}
+}
+
+func resolvePointer(root any, ptr string) (any, bool) {
+	if ptr == "" {
+		return root, true
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, false
+	}
+	current := root
+	for _, token := range strings.Split(ptr[1:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch value := current.(type) {
+		case map[string]any:
+			next, exists := value[token]
+			if !exists {
+				return nil, false
+			}
+			current = next
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(value) {
+				return nil, false
+			}
+			current = value[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,212 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Parse decodes an OpenAPI document in either json or yaml format.
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, fmt.Errorf("cannot parse openapi json document: %w", err)
+		}
+		return &doc, nil
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("cannot parse openapi yaml document: %w", err)
+	}
+
+	return &doc, nil
+}
+
+// ParseFile reads and parses OpenAPI document at path.
+func ParseFile(path string) (*Document, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(bs)
+}
+
+// YAML encodes d as yaml, keys are in the same order as json encoding.
+func (d *Document) YAML() ([]byte, error) {
+	return yaml.Marshal(d)
+}
+
+func (d Document) MarshalYAML() (any, error) {
+	bs, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	// json is valid yaml, decoding it into a node keeps the keys order.
+	var node yaml.Node
+	if err := yaml.Unmarshal(bs, &node); err != nil {
+		return nil, err
+	}
+	resetStyle(&node)
+	if node.Kind == yaml.DocumentNode && len(node.Content) == 1 {
+		return node.Content[0], nil
+	}
+	return &node, nil
+}
+
+func (d *Document) UnmarshalYAML(node *yaml.Node) error {
+	var buf bytes.Buffer
+	if err := yamlToJSON(&buf, node); err != nil {
+		return err
+	}
+	return json.Unmarshal(buf.Bytes(), d)
+}
+
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+// yamlToJSON writes json representation of node into buf, mapping keys are always converted
+// to strings since OpenAPI uses keys like `200` which yaml decodes as integers.
+func yamlToJSON(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return yamlToJSON(buf, node.Content[0])
+	case yaml.AliasNode:
+		return yamlToJSON(buf, node.Alias)
+	case yaml.MappingNode:
+		entries, err := yamlMappingEntries(node)
+		if err != nil {
+			return err
+		}
+		buf.WriteByte('{')
+		for i, entry := range entries {
+			key, value := entry[0], entry[1]
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			keyBs, err := json.Marshal(key.Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(keyBs)
+			buf.WriteByte(':')
+			if err := yamlToJSON(buf, value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := yamlToJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			buf.WriteString("null")
+		case "!!bool":
+			var b bool
+			if err := node.Decode(&b); err != nil {
+				return err
+			}
+			buf.WriteString(strconv.FormatBool(b))
+		case "!!int":
+			var i int64
+			if err := node.Decode(&i); err != nil {
+				return err
+			}
+			buf.WriteString(strconv.FormatInt(i, 10))
+		case "!!float":
+			var f float64
+			if err := node.Decode(&f); err != nil {
+				return err
+			}
+			if math.IsInf(f, 0) || math.IsNaN(f) {
+				return fmt.Errorf("line %d: %s cannot be represented in json", node.Line, node.Value)
+			}
+			bs, err := json.Marshal(f)
+			if err != nil {
+				return err
+			}
+			buf.Write(bs)
+		default:
+			bs, err := json.Marshal(node.Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(bs)
+		}
+	default:
+		return fmt.Errorf("line %d: unsupported yaml node kind %d", node.Line, node.Kind)
+	}
+
+	return nil
+}
+
+// yamlMappingEntries returns key and value pairs of a mapping node with merge keys (`<<`) resolved, keys of the
+// mapping take precedence over merged ones and earlier merged mappings over later ones.
+func yamlMappingEntries(node *yaml.Node) ([][2]*yaml.Node, error) {
+	explicit := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if key := node.Content[i]; key.Tag != "!!merge" {
+			explicit[key.Value] = true
+		}
+	}
+	var entries [][2]*yaml.Node
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Tag != "!!merge" {
+			entries = append(entries, [2]*yaml.Node{key, value})
+			seen[key.Value] = true
+			continue
+		}
+		sources := []*yaml.Node{value}
+		if resolved := yamlAlias(value); resolved.Kind == yaml.SequenceNode {
+			sources = resolved.Content
+		}
+		for _, source := range sources {
+			source = yamlAlias(source)
+			if source.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("line %d: merge key value should be a mapping or a sequence of mappings", value.Line)
+			}
+			merged, err := yamlMappingEntries(source)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range merged {
+				if name := entry[0].Value; !explicit[name] && !seen[name] {
+					entries = append(entries, entry)
+					seen[name] = true
+				}
+			}
+		}
+	}
+	return entries, nil
+}
+
+func yamlAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
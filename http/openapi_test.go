@@ -0,0 +1,121 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/amirrezaask/pkg/http/openapi"
+	"github.com/matryer/is"
+)
+
+func TestServerOpenAPI(t *testing.T) {
+	is := is.New(t)
+	type address struct {
+		City string `json:"city"`
+	}
+	type user struct {
+		ID      int64          `json:"id"`
+		Name    string         `json:"name"`
+		Email   string         `json:"email,omitempty"`
+		Address *address       `json:"address"`
+		Tags    []string       `json:"tags"`
+		Friends []*user        `json:"friends,omitempty"`
+		Meta    map[string]any `json:"meta,omitempty"`
+	}
+	type createUserRequest struct {
+		OrgID  int    `path:"org_id"`
+		DryRun bool   `query:"dry_run"`
+		Name   string `json:"name"`
+	}
+
+	mux := NewServeMux()
+	mux.HandleFunc("POST /orgs/{org_id}/users", func(r *Request, in *createUserRequest) (user, error) {
+		return user{}, nil
+	}).WithSummary("create user").WithTags("users")
+	mux.HandleFunc("GET /orgs/{org_id}/users/{rest...}", func(r *Request, in *struct {
+		OrgID int `path:"org_id"`
+	}) ([]user, error) {
+		return nil, nil
+	})
+	mux.HandleFunc("GET /std", func(w ResponseWriter, r *Request) {})
+	mux.MapOpenAPIEndpoint("/openapi.json", openapi.Info{Title: "test", Version: "1.0.0"})
+
+	doc := mux.OpenAPI(openapi.Info{Title: "test", Version: "1.0.0"})
+	is.Equal(doc.OpenAPI, "3.1.0")
+	is.NoErr(doc.Validate())
+
+	create := doc.Paths.Items["/orgs/{org_id}/users"].Post
+	is.True(create != nil)
+	is.Equal(create.Summary, "create user")
+	is.Equal(create.OperationId, "postOrgsOrgIdUsers")
+	is.Equal(len(create.Parameters), 2)
+	is.Equal(create.Parameters[0].In, "path")
+	is.True(create.Parameters[0].Required)
+	is.Equal(create.Parameters[1].In, "query")
+	is.True(create.Parameters[1].Schema.Type.Contains("boolean"))
+
+	body := create.RequestBody.Content["application/json"].Schema
+	is.Equal(len(body.Properties), 1)
+	is.True(body.Properties["name"].Type.Contains("string"))
+	is.Equal(create.Responses.Codes["200"].Content["application/json"].Schema.Ref, "#/components/schemas/user")
+	is.Equal(create.Responses.Codes["422"].Content["application/problem+json"].Schema.Ref, "#/components/schemas/Problem")
+	is.True(doc.Components.Schemas["Problem"] != nil)
+
+	userSchema := doc.Components.Schemas["user"]
+	is.Equal(userSchema.Properties["id"].Format, "int64")
+	is.Equal(userSchema.Properties["address"].Ref, "#/components/schemas/address")
+	is.Equal(userSchema.Properties["friends"].Items.Ref, "#/components/schemas/user")
+	is.Equal(userSchema.Required, []string{"id", "name", "tags"})
+
+	list := doc.Paths.Items["/orgs/{org_id}/users/{rest}"].Get
+	is.True(list != nil)
+	is.True(list.RequestBody == nil)
+	is.Equal(list.Parameters[1].Name, "rest")
+	is.Equal(list.Responses.Codes["200"].Content["application/json"].Schema.Items.Ref, "#/components/schemas/user")
+
+	is.True(doc.Paths.Items["/std"].Get != nil)
+	_, documented := doc.Paths.Items["/openapi.json"]
+	is.True(!documented)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	resp, err := Get(srv.URL + "/openapi.json")
+	is.NoErr(err)
+	defer resp.Body.Close()
+	is.Equal(resp.Header.Get("Content-Type"), "application/json")
+	var served map[string]any
+	is.NoErr(json.NewDecoder(resp.Body).Decode(&served))
+	is.Equal(served["openapi"], "3.1.0")
+	is.True(served["paths"].(map[string]any)["/orgs/{org_id}/users"] != nil)
+
+	fetch := func() map[string]any {
+		resp, err := Get(srv.URL + "/openapi.json")
+		is.NoErr(err)
+		defer resp.Body.Close()
+		var served map[string]any
+		is.NoErr(json.NewDecoder(resp.Body).Decode(&served))
+		return served["paths"].(map[string]any)
+	}
+	late := mux.HandleFunc("GET /late", func(r *Request) (Result, error) { return Result{}, nil })
+	is.True(fetch()["/late"] != nil) // routes registered later are documented
+	late.WithSummary("late")
+	is.Equal(fetch()["/late"].(map[string]any)["get"].(map[string]any)["summary"], "late") // so are changes of metadata
+	late.WithHidden()
+	is.True(fetch()["/late"] == nil)
+
+	// routes can be registered while documents are served.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			mux.HandleFunc("GET /concurrent/"+strconv.Itoa(i), func(r *Request) (Result, error) { return Result{}, nil }).WithTags("concurrent")
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		fetch()
+	}
+	<-done
+	is.True(fetch()["/concurrent/9"] != nil)
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/amirrezaask/pkg/logging"
+	"github.com/google/uuid"
+)
+
+// ProductionMode hides messages of unknown errors from clients, set it once at startup.
+var ProductionMode bool
+
+// Problem is an RFC 7807 problem details object, Extensions are encoded as top level members.
+type Problem struct {
+	Type       string         `json:"type"`
+	Title      string         `json:"title"`
+	Status     int            `json:"status"`
+	Detail     string         `json:"detail,omitempty"`
+	Instance   string         `json:"instance,omitempty"`
+	Code       string         `json:"code,omitempty"`
+	TraceID    string         `json:"trace_id,omitempty"`
+	Extensions map[string]any `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]any, len(p.Extensions)+7)
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	type problem Problem
+	bs, err := json.Marshal(problem(p))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bs, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// NewProblem creates a problem for status with its standard text as title.
+func NewProblem(status int, detail string) Problem {
+	return Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// ProblemFromError converts err into a problem, *errors.HTTPError and *ValidationError are reported as is,
+// any other error becomes a 500 whose message is hidden in ProductionMode.
+func ProblemFromError(r *http.Request, err error) Problem {
+	var p Problem
+	var verr *ValidationError
+	if httpErr, ok := errors.AsHTTPError(err); ok {
+		p = NewProblem(httpErr.Status, httpErr.Detail)
+		p.Code = httpErr.Code
+		p.Extensions = httpErr.Extra
+	} else if errors.As(err, &verr) {
+		p = NewProblem(http.StatusUnprocessableEntity, "request is not valid")
+		p.Code = "validation_failed"
+		p.Extensions = map[string]any{"errors": verr.Errors}
+	} else {
+		p = NewProblem(http.StatusInternalServerError, err.Error())
+		if ProductionMode {
+			p.Detail = ""
+		}
+	}
+	if r != nil {
+		p.Instance = r.URL.Path
+		p.TraceID = traceID(r)
+	}
+	return p
+}
+
+// WriteProblem writes p as `application/problem+json`.
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// writeError logs err with a trace id and writes it as a problem.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	p := ProblemFromError(r, err)
+	if p.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "error in http handler", "err", err.Error(), "trace_id", p.TraceID, "path", r.URL.Path)
+	} else {
+		slog.InfoContext(r.Context(), "client error in http handler", "err", err.Error(), "trace_id", p.TraceID, "path", r.URL.Path)
+	}
+	WriteProblem(w, p)
+}
+
+func traceID(r *http.Request) string {
+	if id := logging.RequestID(r.Context()); id != "" {
+		return id
+	}
+	if id := r.Header.Get(RequestIDHeader); id != "" {
+		return id
+	}
+	return uuid.NewString()
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/matryer/is"
+)
+
+func TestServerProblem(t *testing.T) {
+	is := is.New(t)
+	type input struct{}
+	mux := NewServeMux()
+	mux.HandleFunc("GET /typed", func(r *Request) (Result, error) {
+		return Result{}, errors.NewHTTPError(http.StatusConflict, "user_exists", "user already exists").With("user_id", 12)
+	})
+	mux.HandleFunc("GET /unknown", func(r *Request) (Result, error) {
+		return Result{}, errors.New("database password is wrong")
+	})
+	mux.HandleFunc("GET /status", func(r *Request) (Result, error) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		return Result{Status: status}, errors.New("select * from users: connection refused")
+	})
+	mux.HandleFunc("GET /invalid", func(r *Request) (Result, error) {
+		return Result{Status: http.StatusBadRequest}, &ValidationError{Errors: []FieldError{{Field: "name", Message: "is required"}}}
+	})
+	mux.HandleFunc("GET /panic", func(r *Request, _ *input) (map[string]string, error) {
+		panic("boom")
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	get := func(path string) (int, map[string]any) {
+		resp, err := http.Get(srv.URL + path)
+		is.NoErr(err)
+		defer resp.Body.Close()
+		is.Equal(resp.Header.Get("Content-Type"), "application/problem+json")
+		var body map[string]any
+		is.NoErr(json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+
+	status, body := get("/typed")
+	is.Equal(status, http.StatusConflict)
+	is.Equal(body["code"], "user_exists")
+	is.Equal(body["detail"], "user already exists")
+	is.Equal(body["title"], "Conflict")
+	is.Equal(body["user_id"], 12.0)
+	is.True(body["trace_id"] != "")
+
+	status, body = get("/unknown")
+	is.Equal(status, http.StatusInternalServerError)
+	is.True(body["detail"] != nil)
+
+	// status of handler is kept, details of errors that are not http errors are never sent.
+	status, body = get("/status?status=404")
+	is.Equal(status, http.StatusNotFound)
+	is.Equal(body["title"], "Not Found")
+	is.Equal(body["detail"], nil)
+	status, body = get("/status?status=503")
+	is.Equal(status, http.StatusServiceUnavailable)
+	is.Equal(body["detail"], nil)
+	status, body = get("/invalid")
+	is.Equal(status, http.StatusUnprocessableEntity)
+	is.Equal(body["code"], "validation_failed")
+
+	ProductionMode = true
+	defer func() { ProductionMode = false }()
+	status, body = get("/unknown")
+	is.Equal(status, http.StatusInternalServerError)
+	is.Equal(body["detail"], nil)
+
+	status, _ = get("/panic")
+	is.Equal(status, http.StatusInternalServerError)
+}
@@ -0,0 +1,338 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allows bursts up to Requests and refills Requests tokens every Window.
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow allows Requests in any Window, approximated by weighting previous fixed window.
+	SlidingWindow
+)
+
+type RateLimit struct {
+	Algorithm RateLimitAlgorithm
+	Requests  int
+	Window    time.Duration
+}
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is time until next request is allowed, it's zero for allowed requests.
+	RetryAfter time.Duration
+	// ResetAfter is time until the whole limit is available again.
+	ResetAfter time.Duration
+}
+
+// RateLimitStore keeps state of rate limits, replicas that share a store enforce limits together.
+type RateLimitStore interface {
+	// Allow consumes a request of key if limit allows it.
+	Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// RateLimitKeyFunc returns identity of the client that is limited, requests with an empty key are not limited.
+type RateLimitKeyFunc func(r *Request) string
+
+type RateLimitConfig struct {
+	RateLimit
+	// Name separates counters of different limits in a shared store, eg: per route limits using the same redis.
+	Name string
+	// Key is KeyByIP when nil.
+	Key RateLimitKeyFunc
+	// Store is a new in memory store when nil.
+	Store RateLimitStore
+	// FailClosed rejects requests when store fails, by default they are let through.
+	FailClosed bool
+}
+
+// KeyByIP limits clients by remote address of the connection.
+func KeyByIP(r *Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader limits clients by value of a header, eg: an api key.
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(r *Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyByClaims limits clients by subject of their jwt claims and by ip when request is not authenticated.
+func KeyByClaims(r *Request) string {
+	if claims := r.GetClaims(); claims != nil {
+		if sub, err := claims.GetSubject(); err == nil && sub != "" {
+			return "sub:" + sub
+		}
+	}
+	return "ip:" + KeyByIP(r)
+}
+
+// RateLimitMiddleware rejects clients that exceed limit with 429, every response gets `RateLimit-*` headers
+// and rejected ones get `Retry-After` too. For per route limits pass it as a route middleware:
+//
+//	mux.HandleFunc("POST /login", login, RateLimitMiddleware(RateLimitConfig{
+//		Name:      "login",
+//		RateLimit: RateLimit{Algorithm: SlidingWindow, Requests: 5, Window: time.Minute},
+//	}))
+func RateLimitMiddleware(cfg RateLimitConfig) MiddlewareFunc {
+	if cfg.Requests <= 0 || cfg.Window <= 0 {
+		panic("rate limit requests and window should be positive")
+	}
+	if cfg.Key == nil {
+		cfg.Key = KeyByIP
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryRateLimitStore()
+	}
+	policy := fmt.Sprintf("%d;w=%d", cfg.Requests, int(math.Ceil(cfg.Window.Seconds())))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := cfg.Key(&Request{r})
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			res, err := cfg.Store.Allow(r.Context(), "ratelimit:"+cfg.Name+":"+key, cfg.RateLimit)
+			if err != nil {
+				slog.Error("error in rate limit store", "err", err.Error(), "path", r.URL.Path)
+				if cfg.FailClosed {
+					writeError(w, r, errors.NewHTTPError(http.StatusServiceUnavailable, "rate_limit_unavailable", "rate limit cannot be checked").Wrap(err))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Policy", policy)
+			header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+			if !res.Allowed {
+				header.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				writeError(w, r, errors.NewHTTPError(http.StatusTooManyRequests, "rate_limited", "too many requests, retry later"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func tokenBucketResult(limit RateLimit, tokens float64, allowed bool) RateLimitResult {
+	perToken := limit.Window / time.Duration(limit.Requests)
+	res := RateLimitResult{
+		Allowed:    allowed,
+		Limit:      limit.Requests,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration((float64(limit.Requests) - tokens) * float64(perToken)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+	return res
+}
+
+// slidingWindowResult estimates requests of the last window as curr plus the part of prev that is still in window.
+func slidingWindowResult(limit RateLimit, prev int, curr int, elapsed time.Duration, allowed bool) RateLimitResult {
+	weight := 1 - float64(elapsed)/float64(limit.Window)
+	estimated := float64(prev)*weight + float64(curr)
+	res := RateLimitResult{
+		Allowed:    allowed,
+		Limit:      limit.Requests,
+		Remaining:  max(0, int(math.Floor(float64(limit.Requests)-estimated))),
+		ResetAfter: limit.Window - elapsed,
+	}
+	if curr > 0 {
+		res.ResetAfter += limit.Window
+	}
+	if !allowed {
+		if curr+1 > limit.Requests || prev == 0 {
+			res.RetryAfter = limit.Window - elapsed
+		} else {
+			// time until weight of previous window drops enough for one more request.
+			needed := 1 - float64(limit.Requests-curr-1)/float64(prev)
+			res.RetryAfter = max(time.Duration(needed*float64(limit.Window))-elapsed, time.Millisecond)
+		}
+	}
+	return res
+}
+
+type memoryRateLimitState struct {
+	// tokens and last are used by token bucket.
+	tokens float64
+	last   time.Time
+	// window, prev and curr are used by sliding window.
+	window int64
+	prev   int
+	curr   int
+}
+
+type memoryRateLimitStore struct {
+	mu     sync.Mutex
+	states map[string]*memoryRateLimitState
+	calls  int
+	now    func() time.Time
+}
+
+// NewMemoryRateLimitStore keeps limits in process memory, so every replica enforces limits on its own.
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{states: map[string]*memoryRateLimitState{}, now: time.Now}
+}
+
+func (m *memoryRateLimitStore) Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now, limit.Window)
+	state, exists := m.states[key]
+	if !exists {
+		state = &memoryRateLimitState{tokens: float64(limit.Requests), last: now}
+		m.states[key] = state
+	}
+
+	switch limit.Algorithm {
+	case SlidingWindow:
+		window := now.UnixNano() / int64(limit.Window)
+		switch window - state.window {
+		case 0:
+		case 1:
+			state.prev, state.curr = state.curr, 0
+		default:
+			state.prev, state.curr = 0, 0
+		}
+		state.window = window
+		state.last = now
+		elapsed := time.Duration(now.UnixNano() - window*int64(limit.Window))
+		weight := 1 - float64(elapsed)/float64(limit.Window)
+		allowed := float64(state.prev)*weight+float64(state.curr)+1 <= float64(limit.Requests)
+		if allowed {
+			state.curr++
+		}
+		return slidingWindowResult(limit, state.prev, state.curr, elapsed, allowed), nil
+	default:
+		rate := float64(limit.Requests) / float64(limit.Window)
+		state.tokens = math.Min(float64(limit.Requests), state.tokens+float64(now.Sub(state.last))*rate)
+		state.last = now
+		allowed := state.tokens >= 1
+		if allowed {
+			state.tokens--
+		}
+		return tokenBucketResult(limit, state.tokens, allowed), nil
+	}
+}
+
+// sweep removes states that were not used in the last two windows, it runs every few thousand calls.
+func (m *memoryRateLimitStore) sweep(now time.Time, window time.Duration) {
+	m.calls++
+	if m.calls%4096 != 0 {
+		return
+	}
+	for key, state := range m.states {
+		if now.Sub(state.last) > 2*window {
+			delete(m.states, key)
+		}
+	}
+}
+
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`)
+
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+local curr = tonumber(redis.call('GET', KEYS[1]) or '0')
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+if prev * weight + curr + 1 > limit then
+	return {0, prev, curr}
+end
+curr = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {1, prev, curr}
+`)
+
+type redisRateLimitStore struct {
+	client redis.Scripter
+	now    func() time.Time
+}
+
+// NewRedisRateLimitStore keeps limits in redis so they hold across replicas, updates are atomic lua scripts.
+func NewRedisRateLimitStore(client redis.Scripter) RateLimitStore {
+	return &redisRateLimitStore{client: client, now: time.Now}
+}
+
+func (s *redisRateLimitStore) Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	now := s.now()
+	switch limit.Algorithm {
+	case SlidingWindow:
+		window := now.UnixNano() / int64(limit.Window)
+		elapsed := time.Duration(now.UnixNano() - window*int64(limit.Window))
+		weight := 1 - float64(elapsed)/float64(limit.Window)
+		// hash tag keeps both windows on the same cluster slot.
+		keys := []string{fmt.Sprintf("{%s}:%d", key, window), fmt.Sprintf("{%s}:%d", key, window-1)}
+		values, err := slidingWindowScript.Run(ctx, s.client, keys, limit.Requests, weight, (2 * limit.Window).Milliseconds()).Int64Slice()
+		if err != nil {
+			return RateLimitResult{}, errors.Wrap(err, "cannot run sliding window script")
+		}
+		if len(values) != 3 {
+			return RateLimitResult{}, errors.Newf("unexpected sliding window script result %v", values)
+		}
+		return slidingWindowResult(limit, int(values[1]), int(values[2]), elapsed, values[0] == 1), nil
+	default:
+		rate := float64(limit.Requests) / float64(limit.Window.Milliseconds())
+		values, err := tokenBucketScript.Run(ctx, s.client, []string{key}, limit.Requests, rate, now.UnixMilli(), (2 * limit.Window).Milliseconds()).Slice()
+		if err != nil {
+			return RateLimitResult{}, errors.Wrap(err, "cannot run token bucket script")
+		}
+		if len(values) != 2 {
+			return RateLimitResult{}, errors.Newf("unexpected token bucket script result %v", values)
+		}
+		allowed, _ := values[0].(int64)
+		tokens, err := strconv.ParseFloat(fmt.Sprint(values[1]), 64)
+		if err != nil {
+			return RateLimitResult{}, errors.Wrap(err, "invalid token bucket tokens")
+		}
+		return tokenBucketResult(limit, tokens, allowed == 1), nil
+	}
+}
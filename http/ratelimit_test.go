@@ -0,0 +1,113 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/matryer/is"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	store := NewMemoryRateLimitStore().(*memoryRateLimitStore)
+	store.now = func() time.Time { return now }
+
+	bucket := RateLimit{Algorithm: TokenBucket, Requests: 2, Window: 2 * time.Second}
+	for i := 0; i < 2; i++ {
+		res, err := store.Allow(ctx, "bucket", bucket)
+		is.NoErr(err)
+		is.True(res.Allowed)
+		is.Equal(res.Remaining, 1-i)
+	}
+	res, err := store.Allow(ctx, "bucket", bucket)
+	is.NoErr(err)
+	is.True(!res.Allowed)
+	is.Equal(res.RetryAfter, time.Second)
+	now = now.Add(time.Second)
+	res, _ = store.Allow(ctx, "bucket", bucket)
+	is.True(res.Allowed)
+
+	window := RateLimit{Algorithm: SlidingWindow, Requests: 4, Window: 10 * time.Second}
+	now = time.Unix(1000, 0)
+	for i := 0; i < 4; i++ {
+		res, _ = store.Allow(ctx, "window", window)
+		is.True(res.Allowed)
+	}
+	res, _ = store.Allow(ctx, "window", window)
+	is.True(!res.Allowed)
+	is.Equal(res.RetryAfter, 10*time.Second)
+	// half of previous window is still counted: 4*0.5 = 2 requests.
+	now = time.Unix(1015, 0)
+	for i := 0; i < 2; i++ {
+		res, _ = store.Allow(ctx, "window", window)
+		is.True(res.Allowed)
+	}
+	res, _ = store.Allow(ctx, "window", window)
+	is.True(!res.Allowed)
+	is.True(res.RetryAfter > 0 && res.RetryAfter <= 5*time.Second)
+}
+
+func TestRedisRateLimitStore(t *testing.T) {
+	is := is.New(t)
+	client, mock := redismock.NewClientMock()
+	store := NewRedisRateLimitStore(client).(*redisRateLimitStore)
+	now := time.UnixMilli(1_000_500)
+	store.now = func() time.Time { return now }
+
+	bucket := RateLimit{Algorithm: TokenBucket, Requests: 10, Window: 10 * time.Second}
+	mock.ExpectEvalSha(tokenBucketScript.Hash(), []string{"k"}, 10, 0.001, int64(1_000_500), int64(20_000)).SetVal([]any{int64(0), "0.5"})
+	res, err := store.Allow(context.Background(), "k", bucket)
+	is.NoErr(err)
+	is.True(!res.Allowed)
+	is.Equal(res.RetryAfter, 500*time.Millisecond)
+
+	window := RateLimit{Algorithm: SlidingWindow, Requests: 10, Window: time.Second}
+	mock.ExpectEvalSha(slidingWindowScript.Hash(), []string{"{k}:1000", "{k}:999"}, 10, 0.5, int64(2000)).SetVal([]any{int64(1), int64(4), int64(3)})
+	res, err = store.Allow(context.Background(), "k", window)
+	is.NoErr(err)
+	is.True(res.Allowed)
+	is.Equal(res.Remaining, 5)
+	is.NoErr(mock.ExpectationsWereMet())
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	is := is.New(t)
+	mux := NewServeMux()
+	mux.HandleFunc("POST /login", func(r *Request) (Result, error) {
+		return Result{Body: "ok"}, nil
+	}, RateLimitMiddleware(RateLimitConfig{
+		Name:      "login",
+		RateLimit: RateLimit{Algorithm: SlidingWindow, Requests: 1, Window: time.Minute},
+		Key:       KeyByHeader("X-API-Key"),
+	}))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	post := func(key string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/login", nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		is.NoErr(err)
+		resp.Body.Close()
+		return resp
+	}
+	resp := post("a")
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.Equal(resp.Header.Get("RateLimit-Limit"), "1")
+	is.Equal(resp.Header.Get("RateLimit-Remaining"), "0")
+	is.Equal(resp.Header.Get("RateLimit-Policy"), "1;w=60")
+
+	resp = post("a")
+	is.Equal(resp.StatusCode, http.StatusTooManyRequests)
+	is.True(resp.Header.Get("Retry-After") != "")
+	is.Equal(resp.Header.Get("Content-Type"), "application/problem+json")
+
+	resp = post("b")
+	is.Equal(resp.StatusCode, http.StatusOK)
+}
@@ -0,0 +1,44 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/amirrezaask/pkg/logging"
+	"github.com/google/uuid"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits ids accepted from clients, so they cannot bloat logs.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware stores request id from X-Request-ID header, or a new one when it's missing or invalid,
+// in context of the request and echoes it in the response. Records logged with that context get the id
+// when logging.Init is used, and clients made by NewClient forward it.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// RequestID returns id stored by RequestIDMiddleware.
+func (r *Request) RequestID() string {
+	return logging.RequestID(r.Context())
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
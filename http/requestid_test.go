@@ -0,0 +1,74 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirrezaask/pkg/logging"
+	"github.com/matryer/is"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	is := is.New(t)
+	var logs bytes.Buffer
+	logger := slog.New(logging.NewContextHandler(slog.NewTextHandler(&logs, nil)))
+
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(RequestIDHeader)))
+	}))
+	defer downstream.Close()
+	client := NewClient("request_id_test", "downstream", time.Second)
+
+	mux := NewServeMux()
+	mux.UseMiddlewares(RequestIDMiddleware)
+	mux.HandleFunc("GET /", func(r *Request) (Result, error) {
+		logger.InfoContext(r.Context(), "handling")
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, downstream.URL, nil)
+		if err != nil {
+			return Result{}, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return Result{}, err
+		}
+		defer resp.Body.Close()
+		bs, err := io.ReadAll(resp.Body)
+		return Result{Body: bytes.NewReader(bs)}, err
+	})
+
+	do := func(id string) (string, string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		is.Equal(w.Code, http.StatusOK)
+		return w.Header().Get(RequestIDHeader), w.Body.String()
+	}
+
+	header, forwarded := do("abc-123")
+	is.Equal(header, "abc-123")
+	is.Equal(forwarded, "abc-123")
+	is.True(strings.Contains(logs.String(), "request_id=abc-123"))
+
+	header, forwarded = do("")
+	is.True(header != "")
+	is.Equal(forwarded, header)
+
+	header, _ = do("has spaces\tand tabs")
+	is.True(header != "has spaces\tand tabs")
+	header, _ = do(strings.Repeat("a", 200))
+	is.Equal(len(header), 36) // replaced by a uuid
+
+	logs.Reset()
+	logger.InfoContext(context.Background(), "no request")
+	is.True(!strings.Contains(logs.String(), "request_id"))
+}
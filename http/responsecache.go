@@ -0,0 +1,412 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/amirrezaask/pkg/errors"
+)
+
+// CacheTagHeader lists tags of a response as comma separated values, handlers set it in Result.Header
+// and it's removed before the response is sent.
+const CacheTagHeader = "Cache-Tag"
+
+const (
+	DefaultResponseCacheTTL = time.Minute
+	// tagPurgeTTL bounds ttl of cached responses, so an expired purge time cannot revive purged responses.
+	tagPurgeTTL = 7 * 24 * time.Hour
+)
+
+type ResponseCacheConfig struct {
+	// WeakETags makes generated etags weak, use it when equivalent responses are not byte for byte equal.
+	WeakETags bool
+	// Cache stores full GET responses, only etags and conditional requests are handled when nil.
+	// Responses are stored as json strings, redis cachers should be created with a *string or *[]byte ptr provider.
+	Cache cache.Cacher
+	// TTL of responses without max-age or s-maxage directives, DefaultResponseCacheTTL when zero.
+	TTL time.Duration
+	// VaryHeaders are request headers that are part of cache key besides Accept, eg: Accept-Language.
+	VaryHeaders []string
+	// Key returns who a request is answered for, eg: a user id derived from its credentials, and whether its
+	// response can be cached, result is part of cache key. By default requests with any of CredentialHeaders are
+	// not cached, since their responses may be personalized and middlewares that authenticate them usually run
+	// after this one.
+	Key func(r *Request) (string, bool)
+	// CredentialHeaders are request headers that carry credentials, Authorization, Cookie and APIKeyHeader when
+	// empty. Add APIKeyConfig.Header here when it's customized.
+	CredentialHeaders []string
+}
+
+// ResponseCache adds etags to successful GET responses, answers conditional requests with 304 and optionally
+// caches responses. Cached responses can be purged by their tags:
+//
+//	rc := NewResponseCache(ResponseCacheConfig{Cache: cacher})
+//	mux.UseMiddlewares(rc.Middleware())
+//	mux.HandleFunc("GET /products/{id}", func(r *Request) (Result, error) {
+//		return Result{Header: http.Header{CacheTagHeader: {"products, product:" + r.PathValue("id")}}, Body: p}, nil
+//	})
+//	mux.HandleFunc("PUT /products/{id}", func(r *Request) (Result, error) {
+//		...
+//		return Result{}, PurgeCacheTags(r.Context(), "products", "product:"+r.PathValue("id"))
+//	})
+type ResponseCache struct {
+	cfg ResponseCacheConfig
+}
+
+type responseCacheKey struct{}
+
+type cachedResponse struct {
+	Status int               `json:"status"`
+	Header http.Header       `json:"header"`
+	Body   []byte            `json:"body"`
+	Tags   []string          `json:"tags"`
+	Vary   map[string]string `json:"vary"`
+	// StoredAt is when handler started, so purges that happen while it runs invalidate the response.
+	StoredAt time.Time `json:"stored_at"`
+}
+
+func NewResponseCache(cfg ResponseCacheConfig) *ResponseCache {
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultResponseCacheTTL
+	}
+	if len(cfg.CredentialHeaders) == 0 {
+		cfg.CredentialHeaders = []string{"Authorization", "Cookie", APIKeyHeader}
+	}
+	return &ResponseCache{cfg: cfg}
+}
+
+// PurgeCacheTags invalidates responses tagged with any of tags in the ResponseCache that handles request of ctx.
+func PurgeCacheTags(ctx context.Context, tags ...string) error {
+	rc, ok := ctx.Value(responseCacheKey{}).(*ResponseCache)
+	if !ok {
+		return errors.New("no response cache in context")
+	}
+	return rc.Purge(ctx, tags...)
+}
+
+// Purge invalidates responses tagged with any of tags, last purge time of every tag is stored and responses
+// rendered before it are ignored, so no entry is deleted. Clocks of servers sharing a cache should be in sync.
+func (c *ResponseCache) Purge(ctx context.Context, tags ...string) error {
+	if c.cfg.Cache == nil {
+		return nil
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var errs []error
+	for _, tag := range tags {
+		if err := c.cfg.Cache.Remember(ctx, tagPurgeKey(tag), now, tagPurgeTTL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *ResponseCache) Middleware() MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*r = *r.WithContext(context.WithValue(r.Context(), responseCacheKey{}, c))
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			addVary(w.Header(), "Accept")
+			key, cacheable := c.key(r)
+			cacheable = cacheable && c.cfg.Cache != nil && r.Method == http.MethodGet
+			if cacheable {
+				if stored, ok := c.lookup(r, key); ok {
+					header := w.Header()
+					for k, vs := range stored.Header {
+						header[k] = vs
+					}
+					header.Set("Age", strconv.Itoa(int(time.Since(stored.StoredAt).Seconds())))
+					writeConditional(w, r, stored.Status, stored.Body)
+					return
+				}
+			}
+
+			// headers set by outer middlewares for this request, eg: X-Request-ID, are not stored.
+			outer := w.Header().Clone()
+			startedAt := time.Now()
+			bw := &bufferedWriter{ResponseWriter: w}
+			next.ServeHTTP(bw, r)
+			if bw.streaming {
+				return
+			}
+			status := bw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			header := w.Header()
+			tags := splitHeader(header.Get(CacheTagHeader))
+			header.Del(CacheTagHeader)
+			if status != http.StatusOK {
+				bw.flush()
+				return
+			}
+			if header.Get("ETag") == "" {
+				header.Set("ETag", c.etag(bw.body.Bytes()))
+			}
+			if cacheable {
+				c.store(r, key, responseHeader(outer, header), bw.body.Bytes(), tags, startedAt)
+			}
+			writeConditional(w, r, status, bw.body.Bytes())
+		})
+	}
+}
+
+func (c *ResponseCache) key(r *http.Request) (string, bool) {
+	var scope string
+	if c.cfg.Key != nil {
+		var ok bool
+		if scope, ok = c.cfg.Key(&Request{r}); !ok {
+			return "", false
+		}
+	} else if slices.ContainsFunc(c.cfg.CredentialHeaders, func(name string) bool { return r.Header.Get(name) != "" }) {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString("httpcache:")
+	b.WriteString(r.URL.RequestURI())
+	// responses are encoded by negotiating Accept, so it's always part of key.
+	b.WriteString("|" + r.Header.Get("Accept"))
+	for _, name := range c.cfg.VaryHeaders {
+		b.WriteString("|" + r.Header.Get(name))
+	}
+	b.WriteString("|" + scope)
+	return b.String(), true
+}
+
+func (c *ResponseCache) etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if c.cfg.WeakETags {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// lookup returns stored response of key if none of its tags were purged since it was stored.
+func (c *ResponseCache) lookup(r *http.Request, key string) (cachedResponse, bool) {
+	ctx := r.Context()
+	cached, err := c.cfg.Cache.Get(ctx, key)
+	if err != nil {
+		return cachedResponse{}, false
+	}
+	var stored cachedResponse
+	if err := decodeCached(cached, &stored); err != nil {
+		slog.ErrorContext(ctx, "cannot decode cached response", "err", err)
+		return cachedResponse{}, false
+	}
+	for name, value := range stored.Vary {
+		if r.Header.Get(name) != value {
+			return cachedResponse{}, false
+		}
+	}
+	for _, tag := range stored.Tags {
+		if purgedAt := c.tagPurgedAt(ctx, tag); !purgedAt.IsZero() && !purgedAt.Before(stored.StoredAt) {
+			return cachedResponse{}, false
+		}
+	}
+	return stored, true
+}
+
+func (c *ResponseCache) store(r *http.Request, key string, header http.Header, body []byte, tags []string, startedAt time.Time) {
+	ttl, cacheable := cacheTTL(header, c.cfg.TTL)
+	if !cacheable {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	stored := cachedResponse{
+		Status:   http.StatusOK,
+		Header:   header,
+		Body:     body,
+		Tags:     tags,
+		Vary:     map[string]string{},
+		StoredAt: startedAt,
+	}
+	// headers that response varies on but are not part of the key, eg: Accept-Encoding of compression middleware.
+	for _, name := range splitHeader(strings.Join(header.Values("Vary"), ",")) {
+		if !strings.EqualFold(name, "Accept") && !slices.ContainsFunc(c.cfg.VaryHeaders, func(h string) bool { return strings.EqualFold(h, name) }) {
+			stored.Vary[name] = r.Header.Get(name)
+		}
+	}
+	bs, err := json.Marshal(stored)
+	if err == nil {
+		err = c.cfg.Cache.Remember(ctx, key, string(bs), ttl)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "cannot cache response", "err", err)
+	}
+}
+
+func (c *ResponseCache) tagPurgedAt(ctx context.Context, tag string) time.Time {
+	cached, err := c.cfg.Cache.Get(ctx, tagPurgeKey(tag))
+	if err != nil {
+		return time.Time{}
+	}
+	var purgedAt string
+	if err := decodeCached(cached, &purgedAt); err != nil {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339Nano, purgedAt)
+	return t
+}
+
+func tagPurgeKey(tag string) string {
+	return "httpcache:tag:" + tag
+}
+
+// responseHeader returns headers of header that were added or changed since outer was taken.
+func responseHeader(outer, header http.Header) http.Header {
+	added := http.Header{}
+	for k, vs := range header {
+		if !slices.Equal(outer[k], vs) {
+			added[k] = slices.Clone(vs)
+		}
+	}
+	return added
+}
+
+// cacheTTL returns how long a response with header can be cached, following Cache-Control set by handler.
+func cacheTTL(header http.Header, fallback time.Duration) (time.Duration, bool) {
+	if header.Get("Set-Cookie") != "" || header.Get("Vary") == "*" {
+		return 0, false
+	}
+	ttl := fallback
+	maxAge, sMaxAge := -1, -1
+	for _, directive := range splitHeader(header.Get("Cache-Control")) {
+		name, value, _ := strings.Cut(strings.ToLower(directive), "=")
+		switch name {
+		case "no-store", "no-cache", "private":
+			return 0, false
+		case "max-age":
+			maxAge, _ = strconv.Atoi(strings.Trim(value, `"`))
+		case "s-maxage":
+			sMaxAge, _ = strconv.Atoi(strings.Trim(value, `"`))
+		}
+	}
+	if sMaxAge >= 0 {
+		ttl = time.Duration(sMaxAge) * time.Second
+	} else if maxAge >= 0 {
+		ttl = time.Duration(maxAge) * time.Second
+	}
+	return min(ttl, tagPurgeTTL), ttl > 0
+}
+
+// writeConditional writes a 304 when validators of r match headers of w, and body with status otherwise.
+func writeConditional(w http.ResponseWriter, r *http.Request, status int, body []byte) {
+	header := w.Header()
+	if status == http.StatusOK && notModified(r, header) {
+		for _, name := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+			header.Del(name)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range splitHeader(inm) {
+			// weak comparison, as required for If-None-Match.
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
+// addVary adds name to Vary header unless it's already there.
+func addVary(header http.Header, name string) {
+	for _, v := range splitHeader(strings.Join(header.Values("Vary"), ",")) {
+		if strings.EqualFold(v, name) || v == "*" {
+			return
+		}
+	}
+	header.Add("Vary", name)
+}
+
+func splitHeader(value string) []string {
+	var parts []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// bufferedWriter holds response back so it can be inspected before sending, flushing switches it to streaming.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+func (b *bufferedWriter) WriteHeader(status int) {
+	if status < 200 {
+		b.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedWriter) Write(bs []byte) (int, error) {
+	if b.streaming {
+		return b.ResponseWriter.Write(bs)
+	}
+	return b.body.Write(bs)
+}
+
+func (b *bufferedWriter) Flush() {
+	if !b.streaming {
+		b.ResponseWriter.Header().Del(CacheTagHeader)
+		b.flush()
+		b.streaming = true
+	}
+	http.NewResponseController(b.ResponseWriter).Flush()
+}
+
+// flush writes held back status and body.
+func (b *bufferedWriter) flush() {
+	if b.status != 0 {
+		b.ResponseWriter.WriteHeader(b.status)
+	}
+	b.ResponseWriter.Write(b.body.Bytes())
+	b.body.Reset()
+}
+
+// Unwrap lets http.ResponseController reach features of the underlying writer.
+func (b *bufferedWriter) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
+}
@@ -0,0 +1,180 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/matryer/is"
+)
+
+func TestResponseCache(t *testing.T) {
+	is := is.New(t)
+	calls := map[string]int{}
+	lastModified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rc := NewResponseCache(ResponseCacheConfig{Cache: cache.NewMemoryCacher(), VaryHeaders: []string{"Accept-Language"}})
+	mux := NewServeMux()
+	mux.UseMiddlewares(rc.Middleware())
+	mux.HandleFunc("GET /products/{id}", func(r *Request) (Result, error) {
+		calls[r.URL.Path]++
+		return Result{
+			Header: http.Header{CacheTagHeader: {"products, product:" + r.PathValue("id")}},
+			Body:   map[string]any{"id": r.PathValue("id"), "lang": r.Header.Get("Accept-Language")},
+		}, nil
+	})
+	mux.HandleFunc("PUT /products/{id}", func(r *Request) (Result, error) {
+		return Result{Status: http.StatusNoContent}, PurgeCacheTags(r.Context(), "product:"+r.PathValue("id"))
+	})
+	mux.HandleFunc("GET /private", func(r *Request) (Result, error) {
+		calls[r.URL.Path]++
+		return Result{Header: http.Header{"Cache-Control": {"private, max-age=60"}}, Body: "mine"}, nil
+	})
+	mux.HandleFunc("GET /dated", func(r *Request) (Result, error) {
+		calls[r.URL.Path]++
+		return Result{Header: http.Header{"Cache-Control": {"no-store"}, "Last-Modified": {lastModified.Format(http.TimeFormat)}}, Body: "dated"}, nil
+	})
+	mux.HandleFunc("GET /missing", func(r *Request) (Result, error) {
+		return Result{}, &ValidationError{}
+	})
+
+	do := func(method, path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	first := do(http.MethodGet, "/products/1")
+	is.Equal(first.Code, http.StatusOK)
+	etag := first.Header().Get("ETag")
+	is.True(strings.HasPrefix(etag, `"`))
+	is.Equal(first.Header().Get(CacheTagHeader), "") // tags are not sent to clients
+
+	cached := do(http.MethodGet, "/products/1")
+	is.Equal(cached.Body.String(), first.Body.String())
+	is.Equal(cached.Header().Get("ETag"), etag)
+	is.Equal(cached.Header().Get("Age"), "0")
+	is.Equal(calls["/products/1"], 1)
+
+	notModified := do(http.MethodGet, "/products/1", "If-None-Match", `"other", W/`+etag)
+	is.Equal(notModified.Code, http.StatusNotModified)
+	is.Equal(notModified.Body.Len(), 0)
+	is.Equal(notModified.Header().Get("ETag"), etag)
+
+	is.True(strings.Contains(cached.Header().Get("Vary"), "Accept"))
+
+	do(http.MethodGet, "/products/1", "Accept-Language", "fa")
+	is.Equal(calls["/products/1"], 2) // vary headers are part of the key
+	do(http.MethodGet, "/products/1", "Accept", "application/xml")
+	is.Equal(calls["/products/1"], 3) // so is Accept
+	do(http.MethodGet, "/products/1", "Authorization", "Bearer user-1")
+	do(http.MethodGet, "/products/1", "Cookie", "session=user-2")
+	is.Equal(calls["/products/1"], 5) // personalized requests are not cached
+
+	do(http.MethodGet, "/products/2")
+	is.Equal(do(http.MethodPut, "/products/1").Code, http.StatusNoContent)
+	do(http.MethodGet, "/products/1")
+	do(http.MethodGet, "/products/2")
+	is.Equal(calls["/products/1"], 6) // purged
+	is.Equal(calls["/products/2"], 1) // other tags are untouched
+
+	do(http.MethodGet, "/private")
+	do(http.MethodGet, "/private")
+	is.Equal(calls["/private"], 2)
+
+	is.Equal(do(http.MethodGet, "/dated", "If-Modified-Since", lastModified.Add(time.Hour).Format(http.TimeFormat)).Code, http.StatusNotModified)
+	is.Equal(do(http.MethodGet, "/dated", "If-Modified-Since", lastModified.Add(-time.Hour).Format(http.TimeFormat)).Code, http.StatusOK)
+	is.Equal(calls["/dated"], 2)
+
+	missing := do(http.MethodGet, "/missing")
+	is.Equal(missing.Code, http.StatusUnprocessableEntity)
+	is.Equal(missing.Header().Get("ETag"), "")
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	is := is.New(t)
+	calls := 0
+	rc := NewResponseCache(ResponseCacheConfig{Cache: cache.NewMemoryCacher(), Key: func(r *Request) (string, bool) {
+		return r.Header.Get("Authorization"), r.URL.Query().Get("fresh") == ""
+	}})
+	mux := NewServeMux()
+	mux.UseMiddlewares(rc.Middleware())
+	mux.HandleFunc("GET /me", func(r *Request) (Result, error) {
+		calls++
+		return Result{Body: r.Header.Get("Authorization")}, nil
+	})
+	do := func(path, auth string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return strings.TrimSpace(w.Body.String())
+	}
+	is.Equal(do("/me", "user-1"), `"user-1"`)
+	is.Equal(do("/me", "user-2"), `"user-2"`)
+	is.Equal(do("/me", "user-1"), `"user-1"`)
+	is.Equal(calls, 2)
+	do("/me?fresh=1", "user-1")
+	do("/me?fresh=1", "user-1")
+	is.Equal(calls, 4)
+}
+
+func TestResponseCacheStaleness(t *testing.T) {
+	is := is.New(t)
+	calls, requests := 0, 0
+	rc := NewResponseCache(ResponseCacheConfig{Cache: cache.NewMemoryCacher()})
+	mux := NewServeMux()
+	mux.UseMiddlewares(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set(RequestIDHeader, strconv.Itoa(requests))
+			next.ServeHTTP(w, r)
+		})
+	}, rc.Middleware())
+	mux.HandleFunc("GET /products", func(r *Request) (Result, error) {
+		calls++
+		if calls == 1 {
+			// a purge that lands while the handler runs.
+			is.NoErr(rc.Purge(r.Context(), "products"))
+		}
+		return Result{Header: http.Header{CacheTagHeader: {"products"}, "X-Total": {"1"}}, Body: calls}, nil
+	})
+	do := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products", nil))
+		return w
+	}
+	do()
+	do()
+	is.Equal(calls, 2) // response rendered before purge is not served
+	w := do()
+	is.Equal(calls, 2)
+	is.Equal(w.Header().Get(RequestIDHeader), "3") // headers of outer middlewares are not stored
+	is.Equal(w.Header().Get("X-Total"), "1")
+}
+
+func TestCacheTTL(t *testing.T) {
+	is := is.New(t)
+	for cacheControl, expected := range map[string]time.Duration{
+		"":                          time.Minute,
+		"public, max-age=30":        30 * time.Second,
+		"max-age=30, s-maxage=120":  2 * time.Minute,
+		"max-age=0":                 0,
+		"no-cache":                  0,
+		"max-age=999999999, public": tagPurgeTTL,
+	} {
+		ttl, cacheable := cacheTTL(http.Header{"Cache-Control": {cacheControl}}, time.Minute)
+		is.Equal(ttl, expected)           // cacheControl
+		is.Equal(cacheable, expected > 0) // cacheControl
+	}
+	_, cacheable := cacheTTL(http.Header{"Set-Cookie": {"a=b"}}, time.Minute)
+	is.True(!cacheable)
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/amirrezaask/pkg/http/openapi"
+)
+
+// Route is metadata of a pattern registered on ServeMux, it's used to generate OpenAPI documents.
+type Route struct {
+	// Pattern as registered on ServeMux, eg: "GET /users/{id}".
+	Pattern string
+	Method  string
+	Host    string
+	Path    string
+	// Input and Output are set for routes registered with reflect form handlers `func(*Request, *Input) (Output, error)`.
+	Input  reflect.Type
+	Output reflect.Type
+	// WebSocket is set for routes registered with `func(*Request, *WebSocketConn) error` handlers.
+	WebSocket bool
+
+	OperationID string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+	// Hidden routes are not included in generated documents.
+	Hidden bool
+	// Security lists alternative requirements of Authorize middlewares of the route, nil when it's not authorized.
+	Security []openapi.SecurityRequirement
+
+	handler     http.Handler
+	middlewares []MiddlewareFunc
+	// raw is set for `func(http.ResponseWriter, *Request)` handlers, they run without middlewares.
+	raw bool
+	// mux is set once route is registered, fields set directly after that are not picked up by served documents,
+	// With methods should be used instead.
+	mux *ServeMux
+}
+
+func newRoute(pattern string) *Route {
+	route := &Route{Pattern: pattern}
+	rest := strings.TrimLeft(pattern, " \t")
+	if method, path, found := strings.Cut(rest, " "); found {
+		route.Method = method
+		rest = strings.TrimLeft(path, " \t")
+	}
+	if i := strings.Index(rest, "/"); i > 0 {
+		route.Host = rest[:i]
+		rest = rest[i:]
+	}
+	route.Path = rest
+
+	return route
+}
+
+func (r *Route) WithSummary(summary string) *Route {
+	return r.update(func() { r.Summary = summary })
+}
+
+func (r *Route) WithDescription(description string) *Route {
+	return r.update(func() { r.Description = description })
+}
+
+func (r *Route) WithTags(tags ...string) *Route {
+	return r.update(func() { r.Tags = append(r.Tags, tags...) })
+}
+
+func (r *Route) WithOperationID(id string) *Route {
+	return r.update(func() { r.OperationID = id })
+}
+
+// WithDeprecated marks operation of route as deprecated.
+func (r *Route) WithDeprecated() *Route {
+	return r.update(func() { r.Deprecated = true })
+}
+
+// WithHidden excludes route from generated documents.
+func (r *Route) WithHidden() *Route {
+	return r.update(func() { r.Hidden = true })
+}
+
+// update applies change to r, once r is registered it's done under lock of its mux so served documents are
+// regenerated.
+func (r *Route) update(change func()) *Route {
+	if r.mux == nil {
+		change()
+		return r
+	}
+	r.mux.routesMu.Lock()
+	defer r.mux.routesMu.Unlock()
+	change()
+	r.mux.generation++
+	return r
+}
+
+// Routes returns metadata of every route registered on this mux in registration order.
+func (s *ServeMux) Routes() []*Route {
+	s.routesMu.RLock()
+	defer s.routesMu.RUnlock()
+	return slices.Clone(s.routes)
+}
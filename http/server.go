@@ -1,18 +1,23 @@
 package http
 
 import (
+	"bufio"
+	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"reflect"
 	"regexp"
 	"runtime"
-	"strings"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/amirrezaask/pkg/http/openapi"
 	"github.com/getsentry/sentry-go"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/prometheus/client_golang/prometheus"
@@ -31,96 +36,108 @@ type Request struct {
 }
 
 func (r *Request) GetClaims() jwt.Claims {
-	claims := r.Context().Value(ClaimsKey)
-	if claims == nil {
-		return nil
-	}
-	return claims.(jwt.Claims)
-}
-
-func (r *Request) Bind(v any) error {
-	rvPtr := reflect.ValueOf(v)
-	if rvPtr.Kind() != reflect.Ptr {
-		return fmt.Errorf("input should be a pointer for Bind")
-	}
-	rv := rvPtr.Elem()
-	rt := rv.Type()
-	for i := 0; i < rv.NumField(); i++ {
-		qp := rt.Field(i).Tag.Get("query")
-		if qp == "" {
-			continue
-		}
-		q := r.URL.Query().Get(qp)
-		if q == "" {
-			continue
-		}
-		setWithProperType(rt.Field(i).Type.Kind(), q, rv.Field(i))
-	}
-	for i := 0; i < rv.NumField(); i++ {
-		pp := rt.Field(i).Tag.Get("path")
-		if pp == "" {
-			continue
-		}
-		q := r.PathValue(pp)
-		if q == "" {
-			continue
-		}
-		setWithProperType(rt.Field(i).Type.Kind(), q, rv.Field(i))
-	}
-
-	return r.BindBody(v)
+	// BasicAuthMiddleware stores username as claims, so claims are not always jwt.Claims.
+	claims, _ := r.Context().Value(ClaimsKey).(jwt.Claims)
+	return claims
 }
 
+// BindBody decodes request body into v using decoder registered for its Content-Type,
+// requests without Content-Type are decoded as DefaultMediaType.
 func (r *Request) BindBody(v any) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr {
 		return fmt.Errorf("input should be a pointer for Bind")
 	}
-	if r.Header.Get("Content-Type") == "" {
-		r.Header.Set("Content-Type", "application/json")
-	}
-	switch r.Header.Get("Content-Type") {
-	case "application/json":
-		err := json.NewDecoder(r.Body).Decode(v)
-		if err == io.EOF && r.Method == "GET" {
-			return nil
-		}
-
+	decode, err := decoderFor(r.Header.Get("Content-Type"))
+	if err != nil {
 		return err
-	default:
-		return fmt.Errorf("Content-Type '%s' is not supported", r.Header.Get("Content-Type"))
 	}
+	err = decode(r.Request, v)
+	// an empty body leaves v untouched.
+	if err == io.EOF {
+		return nil
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errors.NewHTTPError(http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit)).Wrap(err)
+	}
+	if err != nil {
+		return errors.NewHTTPError(http.StatusBadRequest, "invalid_body", "request body cannot be decoded: "+err.Error()).Wrap(err)
+	}
+
+	return nil
 }
 
 type HandlerFunc func(*Request) (Result, error)
 
 func (h HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	res, err := h(&Request{r})
+	for k, vs := range res.Header {
+		w.Header()[k] = vs
+	}
 	if err != nil {
-		slog.Error("error in http handler", "err", err.Error())
+		// status set by handler is kept for errors that don't carry their own, their messages may contain
+		// internals like queries and source paths, so they are only logged.
+		var verr *ValidationError
+		if _, isHTTPErr := errors.AsHTTPError(err); !isHTTPErr && !errors.As(err, &verr) && res.Status >= 400 {
+			err = errors.NewHTTPError(res.Status, "", "").Wrap(err)
+		}
+		writeError(w, r, err)
+		return
 	}
 
-	if res.Status == 0 && err == nil {
+	if res.Status == 0 {
 		res.Status = 200
-	} else if res.Status == 0 && err != nil {
-		res.Status = 500
 	}
 
-	w.WriteHeader(res.Status)
+	if stream, isStream := res.Body.(*EventStream); isStream {
+		stream.serve(w, r, res.Status)
+		return
+	}
+	if reader, isReader := res.Body.(io.Reader); isReader {
+		w.WriteHeader(res.Status)
+		io.Copy(w, reader)
+		return
+	}
 
-	switch res.Body.(type) {
-	case io.Reader:
-		io.Copy(w, res.Body.(io.Reader))
-	default:
-		//marshal json
-		json.NewEncoder(w).Encode(res.Body)
+	mediaType, encode, ok := negotiate(r.Header.Get("Accept"))
+	addVary(w.Header(), "Accept")
+	if !ok {
+		writeError(w, r, errors.NewHTTPError(http.StatusNotAcceptable, "not_acceptable", fmt.Sprintf("none of '%s' can be produced", r.Header.Get("Accept"))))
+		return
 	}
+	// body is encoded before writing the header so encoding errors can still be reported.
+	var buf bytes.Buffer
+	if err := encode(&buf, res.Body); err != nil {
+		writeError(w, r, errors.Wrap(err, "cannot encode response as %s", mediaType))
+		return
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", mediaType)
+	}
+	w.WriteHeader(res.Status)
+	w.Write(buf.Bytes())
 }
 
 type MiddlewareFunc = func(http.Handler) http.Handler
 type ServeMux struct {
 	*http.ServeMux
 	middlewares []MiddlewareFunc
+	cors        *cors
+	// routesMu guards routes, their metadata and securitySchemes, generation is bumped on every change of them
+	// so generated documents know when they are stale.
+	routesMu   sync.RWMutex
+	generation uint64
+	routes     []*Route
+	endpoints  []endpoint
+	// securitySchemes are described in generated OpenAPI documents, see AddSecurityScheme.
+	securitySchemes map[string]openapi.SecurityScheme
+}
+
+// endpoint is a handler registered by Map methods, eg: MapPrometheusEndpoint.
+type endpoint struct {
+	pattern string
+	handler http.Handler
 }
 
 func NewServeMux() *ServeMux {
@@ -131,24 +148,73 @@ func (s *ServeMux) UseMiddlewares(middlewares ...MiddlewareFunc) {
 	s.middlewares = append(s.middlewares, middlewares...)
 }
 
-func (s *ServeMux) MapPrometheusEndpoint(path string) {
-	s.ServeMux.Handle("GET "+path, promhttp.Handler())
+// MapPrometheusEndpoint serves metrics on path behind middlewares, eg: BasicAuth, global middlewares of the mux are not applied.
+func (s *ServeMux) MapPrometheusEndpoint(path string, middlewares ...MiddlewareFunc) {
+	// exemplars are only exposed in OpenMetrics format.
+	s.handleEndpoint("GET "+path, ChainMiddlewares(middlewares...)(promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))))
+}
+
+// handleEndpoint registers handler without middlewares and without describing it as a route, endpoints are
+// kept so they can be mounted on another mux.
+func (s *ServeMux) handleEndpoint(pattern string, handler http.Handler) {
+	s.ServeMux.Handle(pattern, handler)
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+	s.endpoints = append(s.endpoints, endpoint{pattern: pattern, handler: handler})
+}
+
+func (s *ServeMux) Handle(path string, handler http.Handler, middlewares ...MiddlewareFunc) *Route {
+	route := newRoute(path)
+	s.handle(route, handler, middlewares...)
+	return route
 }
 
-func (s *ServeMux) Handle(path string, handler http.Handler, middlewares ...MiddlewareFunc) {
-	handler = ChainMiddlewares(append(s.middlewares, middlewares...)...)(handler)
+func (s *ServeMux) handle(route *Route, handler http.Handler, middlewares ...MiddlewareFunc) {
+	// raw handler and route middlewares are kept so route can be mounted on another mux.
+	route.handler = handler
+	route.middlewares = slices.Clone(middlewares)
+	route.Security = nil
+	chain := append(slices.Clone(s.middlewares), middlewares...)
+	if route.raw {
+		chain, route.middlewares = nil, nil
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+		// policies of Authorize are collected while chaining, since middlewares are opaque functions.
+		if authorize, ok := handler.(*authorizeHandler); ok {
+			if route.Security == nil {
+				route.Security = authorize.policy.requirements
+			} else {
+				route.Security = AllOf(Policy{requirements: route.Security}, authorize.policy).requirements
+			}
+		}
+	}
 	wrapped := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		*r = *r.WithContext(context.WithValue(r.Context(), "registered_uri", path))
+		*r = *r.WithContext(context.WithValue(r.Context(), "registered_uri", route.Pattern))
 		handler.ServeHTTP(w, r)
 	})
-	s.ServeMux.Handle(path, wrapped)
+	s.ServeMux.Handle(route.Pattern, wrapped)
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+	route.mux = s
+	s.routes = append(s.routes, route)
+	s.generation++
 }
 
-func (s *ServeMux) handleFuncSimple(path string, handler HandlerFunc, middlewares ...MiddlewareFunc) {
-	s.Handle(path, handler, middlewares...)
+func (s *ServeMux) handleFuncSimple(path string, handler HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return s.Handle(path, handler, middlewares...)
 }
 
-func (s *ServeMux) HandleFunc(path string, handler interface{}, middlewares ...MiddlewareFunc) {
+// HandleFunc registers handler for given pattern, handler can be one of following forms:
+//   - func(*http.Request) (Result, error)
+//   - func(http.ResponseWriter, *http.Request)
+//   - func(*http.Request, *INPUTTYPE) (OUTPUTTYPE, error)
+//   - func(*http.Request, *WebSocketConn) error
+//
+// func(http.ResponseWriter, *http.Request) handlers run without middlewares of the mux and route.
+// returned route can be used to describe the operation in generated OpenAPI document.
+func (s *ServeMux) HandleFunc(path string, handler interface{}, middlewares ...MiddlewareFunc) *Route {
 	t := reflect.TypeOf(handler)
 	v := reflect.ValueOf(handler)
 	if t.Kind() != reflect.Func {
@@ -157,14 +223,22 @@ func (s *ServeMux) HandleFunc(path string, handler interface{}, middlewares ...M
 
 	switch handler := handler.(type) {
 	case func(*Request) (Result, error):
-		s.handleFuncSimple(path, handler, middlewares...)
-		return
+		return s.handleFuncSimple(path, handler, middlewares...)
 	case func(http.ResponseWriter, *Request):
-		s.ServeMux.HandleFunc(path, func(rw http.ResponseWriter, r *http.Request) {
+		route := newRoute(path)
+		route.raw = true
+		s.handle(route, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 			defer _recover()
 			handler(rw, &Request{r})
-		})
-		return
+		}))
+		return route
+	case func(*Request, *WebSocketConn) error:
+		route := newRoute(path)
+		route.WebSocket = true
+		s.handle(route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveWebSocket(w, r, handler)
+		}), middlewares...)
+		return route
 	}
 
 	if t.NumIn() != 2 {
@@ -178,11 +252,19 @@ func (s *ServeMux) HandleFunc(path string, handler interface{}, middlewares ...M
 		panic("second output of handler should be error")
 	}
 
-	s.Handle(path, HandlerFunc(func(r *Request) (Result, error) {
-		defer _recover()
+	if err := checkValidationTags(t.In(1).Elem()); err != nil {
+		panic(fmt.Sprintf("invalid validation tags on input of %s: %s", path, err))
+	}
+	route := newRoute(path)
+	route.Input = t.In(1).Elem()
+	route.Output = t.Out(0)
+	s.handle(route, HandlerFunc(func(r *Request) (_ Result, err error) {
+		defer recoverAsError(&err)
 		req := reflect.New(t.In(1).Elem())
-		err := r.Bind(req.Interface())
-		if err != nil {
+		if err := r.Bind(req.Interface()); err != nil {
+			return Result{}, err
+		}
+		if err := Validate(req.Interface()); err != nil {
 			return Result{}, err
 		}
 		res := v.Call([]reflect.Value{reflect.ValueOf(r), req})
@@ -192,19 +274,24 @@ func (s *ServeMux) HandleFunc(path string, handler interface{}, middlewares ...M
 		}
 		return Result{Body: res[0].Interface()}, errI.(error)
 	}), middlewares...)
+
+	return route
 }
 
 func (s *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.cors != nil && s.serveCORS(w, r) {
+		return
+	}
 	s.ServeMux.ServeHTTP(w, r)
 }
 
 var DefaultServeMux = &ServeMux{}
 
-func Handle(path string, handler http.Handler, middlewares ...MiddlewareFunc) {
-	DefaultServeMux.Handle(path, handler, middlewares...)
+func Handle(path string, handler http.Handler, middlewares ...MiddlewareFunc) *Route {
+	return DefaultServeMux.Handle(path, handler, middlewares...)
 }
-func HandleFunc(path string, handler HandlerFunc, middlewares ...MiddlewareFunc) {
-	DefaultServeMux.Handle(path, handler, middlewares...)
+func HandleFunc(path string, handler HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return DefaultServeMux.Handle(path, handler, middlewares...)
 }
 
 type statusRecorder struct {
@@ -213,10 +300,37 @@ type statusRecorder struct {
 }
 
 func (s *statusRecorder) WriteHeader(status int) {
-	s.status = status
+	if s.status == 0 {
+		s.status = status
+	}
 	s.ResponseWriter.WriteHeader(status)
 }
 
+func (s *statusRecorder) Write(bs []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(bs)
+}
+
+func (s *statusRecorder) Flush() {
+	http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+// Hijack records switching protocols status since upgraded connections never call WriteHeader.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(s.ResponseWriter).Hijack()
+	if err == nil && s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// Unwrap lets http.ResponseController reach features of the underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
 func PrometheusExporterMiddleware(namespace string, excludePaths ...string) func(h http.Handler) http.Handler {
 	var pathRegexps []*regexp.Regexp
 	for _, path := range excludePaths {
@@ -272,8 +386,8 @@ func PrometheusExporterMiddleware(namespace string, excludePaths ...string) func
 			requestCount.WithLabelValues(fmt.Sprint(statusRecorder.status), req.Method, rPath).
 				Inc()
 
-			requestsHist.WithLabelValues(fmt.Sprint(statusRecorder.status), req.Method, rPath).
-				Observe(time.Since(start).Seconds())
+			observeWithTrace(req.Context(), requestsHist.WithLabelValues(fmt.Sprint(statusRecorder.status), req.Method, rPath),
+				time.Since(start).Seconds())
 		})
 	}
 
@@ -296,6 +410,18 @@ func _recover() {
 	}
 }
 
+// recoverAsError recovers a panic and reports it through err so it's rendered like any other error.
+func recoverAsError(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := make([]byte, 4<<10)
+	stack = stack[:runtime.Stack(stack, false)]
+	slog.Error("panic in http handler", "recover()", r, "stack", string(stack))
+	*err = fmt.Errorf("panic: %v", r)
+}
+
 func RecoverMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer _recover()
@@ -335,6 +461,8 @@ var (
 	IsAuthenticatedKey = "isAuthenticated"
 )
 
+// BasicAuthMiddleware authenticates a single plaintext credential and lets other requests continue unauthenticated.
+// Use BasicAuth for hashed credentials of multiple users, challenges and lockout.
 func BasicAuthMiddleware(user string, pass string) func(h http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -344,7 +472,8 @@ func BasicAuthMiddleware(user string, pass string) func(h http.Handler) http.Han
 				return
 			}
 
-			if username == user && password == pass {
+			// both are compared so time does not reveal which one was wrong.
+			if compareCredential(username, user)&compareCredential(password, pass) == 1 {
 				r = r.WithContext(context.WithValue(r.Context(), IsAuthenticatedKey, true))
 				r = r.WithContext(context.WithValue(r.Context(), ClaimsKey, username))
 			}
@@ -354,34 +483,19 @@ func BasicAuthMiddleware(user string, pass string) func(h http.Handler) http.Han
 	}
 }
 
+// JWTBearerAuthenticationMiddleware authenticates HMAC signed bearer tokens, invalid tokens continue unauthenticated.
+// Use JWTVerifierMiddleware for asymmetric keys, JWKS and claim validation.
 func JWTBearerAuthenticationMiddleware[C any, CLAIMS interface {
 	jwt.Claims
 	*C
 }](secret []byte) func(h http.Handler) http.Handler {
-	return func(h http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authorization := r.Header.Get("Authorization")
-			authorization, ok := strings.CutPrefix(authorization, "Bearer ")
-			if !ok {
-				h.ServeHTTP(w, r)
-				return
-			}
-			claims := CLAIMS(new(C))
-			tok, err := jwt.ParseWithClaims(authorization, claims, func(token *jwt.Token) (interface{}, error) {
-				return secret, nil
-			})
-			if err != nil {
-				slog.Error("error in parsing jwt with claims", "err", err)
-				h.ServeHTTP(w, r)
-				return
-			}
-			r = r.WithContext(context.WithValue(r.Context(), ClaimsKey, tok.Claims))
-			r = r.WithContext(context.WithValue(r.Context(), IsAuthenticatedKey, true))
-			h.ServeHTTP(w, r)
-		})
-	}
+	return JWTVerifierMiddleware[C, CLAIMS](NewJWTVerifier(JWTVerifierConfig{
+		Keys:       StaticKeys{"": secret},
+		Algorithms: []string{"HS256", "HS384", "HS512"},
+	}))
 }
 
+// AuthenticatedOnlyMiddleware rejects unauthenticated requests, use Authorize for policies that show up in docs.
 func AuthenticatedOnlyMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Context().Value(IsAuthenticatedKey) != true {
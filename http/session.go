@@ -0,0 +1,380 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/amirrezaask/pkg/errors"
+)
+
+const (
+	DefaultSessionCookieName      = "session"
+	DefaultSessionIdleTimeout     = 30 * time.Minute
+	DefaultSessionAbsoluteTimeout = 12 * time.Hour
+
+	CSRFTokenHeader = "X-CSRF-Token"
+	CSRFTokenField  = "csrf_token"
+)
+
+type SessionConfig struct {
+	// Cache stores session data, cookies only carry signed session ids.
+	Cache cache.Cacher
+	// Keys sign session ids, first key signs and every key verifies so keys can be rotated.
+	Keys       [][]byte
+	CookieName string
+	Domain     string
+	Path       string
+	// Insecure allows cookies over plain http, eg: in local development.
+	Insecure bool
+	// SameSite is http.SameSiteLaxMode when zero.
+	SameSite http.SameSite
+	// Persist keeps cookies until absolute timeout, otherwise they are removed when browser is closed.
+	Persist bool
+	// IdleTimeout ends sessions that are not used for a while, AbsoluteTimeout ends them regardless of use.
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+}
+
+// SessionManager keeps server side sessions identified by signed cookies, sessions are loaded by Middleware
+// and saved before response is written when they are changed.
+type SessionManager struct {
+	cfg SessionConfig
+}
+
+func NewSessionManager(cfg SessionConfig) *SessionManager {
+	if cfg.Cache == nil || len(cfg.Keys) == 0 {
+		panic("session manager needs a cache and signing keys")
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = DefaultSessionCookieName
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if cfg.SameSite == 0 {
+		cfg.SameSite = http.SameSiteLaxMode
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = DefaultSessionIdleTimeout
+	}
+	if cfg.AbsoluteTimeout == 0 {
+		cfg.AbsoluteTimeout = DefaultSessionAbsoluteTimeout
+	}
+	return &SessionManager{cfg: cfg}
+}
+
+type sessionKey struct{}
+
+// Session is data of a client kept between requests, values are stored as json.
+type Session struct {
+	mu        sync.Mutex
+	id        string
+	data      sessionData
+	modified  bool
+	destroyed bool
+	stored    bool
+	// previousID is removed from store when session is renewed.
+	previousID string
+}
+
+type sessionData struct {
+	Values    map[string]json.RawMessage `json:"values"`
+	Flashes   []string                   `json:"flashes,omitempty"`
+	CSRFToken string                     `json:"csrf_token,omitempty"`
+	CreatedAt time.Time                  `json:"created_at"`
+	TouchedAt time.Time                  `json:"touched_at"`
+}
+
+// Session returns session of r, it's nil when SessionManager.Middleware is not used.
+func (r *Request) Session() *Session {
+	s, _ := r.Context().Value(sessionKey{}).(*Session)
+	return s
+}
+
+// Get decodes value of key into v and reports whether it exists.
+func (s *Session) Get(key string, v any) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	raw, ok := s.data.Values[key]
+	return ok && json.Unmarshal(raw, v) == nil
+}
+
+func (s *Session) Set(key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode session value '%s'", key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Values[key] = raw
+	s.modified = true
+	return nil
+}
+
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data.Values, key)
+	s.modified = true
+}
+
+// AddFlash adds a message that is shown once, eg: on the page user is redirected to.
+func (s *Session) AddFlash(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Flashes = append(s.data.Flashes, message)
+	s.modified = true
+}
+
+// Flashes returns flash messages and removes them from session.
+func (s *Session) Flashes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flashes := s.data.Flashes
+	if len(flashes) > 0 {
+		s.data.Flashes = nil
+		s.modified = true
+	}
+	return flashes
+}
+
+// CSRFToken returns synchronizer token of session that CSRFMiddleware expects in unsafe requests.
+func (s *Session) CSRFToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.CSRFToken == "" {
+		s.data.CSRFToken = randomToken(32)
+		s.modified = true
+	}
+	return s.data.CSRFToken
+}
+
+// Renew gives session a new id and csrf token keeping its data, it should be called on login and privilege
+// changes so an id planted before login cannot be used after it.
+func (s *Session) Renew() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stored && s.previousID == "" {
+		s.previousID = s.id
+	}
+	s.id = randomToken(32)
+	s.data.CSRFToken = ""
+	s.data.CreatedAt = time.Now()
+	s.modified = true
+}
+
+// Destroy removes session from store and its cookie from client, eg: on logout.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.destroyed = true
+	s.modified = true
+}
+
+// Middleware loads session of requests, new sessions are only stored when they are changed.
+func (m *SessionManager) Middleware() MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := m.load(r)
+			sw := &sessionWriter{ResponseWriter: w, save: func() { m.save(w, r, session) }}
+			*r = *r.WithContext(context.WithValue(r.Context(), sessionKey{}, session))
+			h.ServeHTTP(sw, r)
+			sw.commit()
+		})
+	}
+}
+
+func (m *SessionManager) load(r *http.Request) *Session {
+	now := time.Now()
+	fresh := &Session{id: randomToken(32), data: sessionData{Values: map[string]json.RawMessage{}, CreatedAt: now, TouchedAt: now}}
+	cookie, err := r.Cookie(m.cfg.CookieName)
+	if err != nil {
+		return fresh
+	}
+	id, ok := m.verify(cookie.Value)
+	if !ok {
+		return fresh
+	}
+	cached, err := m.cfg.Cache.Get(r.Context(), sessionCacheKey(id))
+	if err != nil {
+		return fresh
+	}
+	var data sessionData
+	if err := decodeCached(cached, &data); err != nil || data.CreatedAt.IsZero() {
+		return fresh
+	}
+	// store ttls are not trusted to be exact, so timeouts are checked here too.
+	if now.Sub(data.TouchedAt) > m.cfg.IdleTimeout || now.Sub(data.CreatedAt) > m.cfg.AbsoluteTimeout {
+		return fresh
+	}
+	if data.Values == nil {
+		data.Values = map[string]json.RawMessage{}
+	}
+	s := &Session{id: id, data: data, stored: true}
+	// idle timeout is extended by saving, which is done at most once every few minutes for unchanged sessions.
+	if now.Sub(data.TouchedAt) > min(time.Minute, m.cfg.IdleTimeout/10) {
+		s.modified = true
+	}
+	return s
+}
+
+func (m *SessionManager) save(w http.ResponseWriter, r *http.Request, s *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.modified {
+		return
+	}
+	ctx := r.Context()
+	if s.previousID != "" {
+		m.remove(ctx, s.previousID)
+		s.previousID = ""
+	}
+	cookie := &http.Cookie{
+		Name:     m.cfg.CookieName,
+		Path:     m.cfg.Path,
+		Domain:   m.cfg.Domain,
+		Secure:   !m.cfg.Insecure,
+		HttpOnly: true,
+		SameSite: m.cfg.SameSite,
+	}
+	if s.destroyed {
+		if s.stored {
+			m.remove(ctx, s.id)
+		}
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+		return
+	}
+
+	now := time.Now()
+	s.data.TouchedAt = now
+	ttl := min(m.cfg.IdleTimeout, s.data.CreatedAt.Add(m.cfg.AbsoluteTimeout).Sub(now))
+	bs, err := json.Marshal(s.data)
+	if err == nil {
+		err = m.cfg.Cache.Remember(ctx, sessionCacheKey(s.id), string(bs), ttl)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "cannot save session", "err", err)
+		return
+	}
+	cookie.Value = m.sign(s.id)
+	if m.cfg.Persist {
+		cookie.Expires = s.data.CreatedAt.Add(m.cfg.AbsoluteTimeout)
+	}
+	http.SetCookie(w, cookie)
+	s.modified = false
+	s.stored = true
+}
+
+// remove overwrites session of id, Cacher has no delete so an empty entry that expires soon takes its place.
+func (m *SessionManager) remove(ctx context.Context, id string) {
+	if err := m.cfg.Cache.Remember(ctx, sessionCacheKey(id), "{}", time.Second); err != nil {
+		slog.ErrorContext(ctx, "cannot remove session", "err", err)
+	}
+}
+
+func (m *SessionManager) sign(id string) string {
+	mac := hmac.New(sha256.New, m.cfg.Keys[0])
+	mac.Write([]byte(id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (m *SessionManager) verify(value string) (string, bool) {
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", false
+	}
+	for _, key := range m.cfg.Keys {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(id))
+		if hmac.Equal([]byte(base64.RawURLEncoding.EncodeToString(mac.Sum(nil))), []byte(sig)) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func sessionCacheKey(id string) string {
+	return "session:" + id
+}
+
+// sessionWriter saves session before headers are written, since its cookie is a header.
+type sessionWriter struct {
+	http.ResponseWriter
+	save      func()
+	committed bool
+}
+
+func (s *sessionWriter) commit() {
+	if !s.committed {
+		s.committed = true
+		s.save()
+	}
+}
+
+func (s *sessionWriter) WriteHeader(status int) {
+	s.commit()
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *sessionWriter) Write(bs []byte) (int, error) {
+	s.commit()
+	return s.ResponseWriter.Write(bs)
+}
+
+func (s *sessionWriter) Flush() {
+	s.commit()
+	http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+func (s *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	s.commit()
+	return http.NewResponseController(s.ResponseWriter).Hijack()
+}
+
+func (s *sessionWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// CSRFMiddleware rejects unsafe requests whose `X-CSRF-Token` header or `csrf_token` form field does not match
+// token of their session with 403. It should run after Middleware, pages put Session.CSRFToken in their forms.
+func (m *SessionManager) CSRFMiddleware() MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				h.ServeHTTP(w, r)
+				return
+			}
+			session := (&Request{r}).Session()
+			if session == nil {
+				writeError(w, r, errors.New("csrf middleware needs session middleware"))
+				return
+			}
+			token := r.Header.Get(CSRFTokenHeader)
+			if token == "" {
+				token = r.PostFormValue(CSRFTokenField)
+			}
+			session.mu.Lock()
+			expected := session.data.CSRFToken
+			session.mu.Unlock()
+			if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+				writeError(w, r, errors.NewHTTPError(http.StatusForbidden, "csrf_token_invalid", "csrf token is missing or invalid"))
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
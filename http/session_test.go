@@ -0,0 +1,135 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/matryer/is"
+)
+
+func TestSessions(t *testing.T) {
+	is := is.New(t)
+	sessions := NewSessionManager(SessionConfig{Cache: cache.NewMemoryCacher(), Keys: [][]byte{[]byte("key")}})
+	mux := NewServeMux()
+	mux.UseMiddlewares(sessions.Middleware(), sessions.CSRFMiddleware())
+	mux.HandleFunc("GET /login", func(r *Request) (Result, error) {
+		return Result{Body: r.Session().CSRFToken()}, nil
+	})
+	mux.HandleFunc("POST /login", func(r *Request) (Result, error) {
+		r.Session().Renew()
+		r.Session().AddFlash("welcome")
+		return Result{Status: http.StatusSeeOther}, r.Session().Set("user", r.PostFormValue("user"))
+	})
+	mux.HandleFunc("GET /me", func(r *Request) (Result, error) {
+		var user string
+		r.Session().Get("user", &user)
+		return Result{Body: map[string]any{"user": user, "flashes": r.Session().Flashes()}}, nil
+	})
+	mux.HandleFunc("POST /logout", func(r *Request) (Result, error) {
+		r.Session().Destroy()
+		return Result{Status: http.StatusNoContent}, nil
+	})
+
+	var cookie *http.Cookie
+	do := func(method, path string, form url.Values, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if cookies := w.Result().Cookies(); len(cookies) > 0 {
+			cookie = cookies[0]
+		}
+		return w
+	}
+
+	is.Equal(len(do(http.MethodGet, "/me", nil).Result().Cookies()), 0) // untouched sessions are not stored
+
+	w := do(http.MethodGet, "/login", nil)
+	is.True(cookie != nil)
+	is.True(cookie.HttpOnly && cookie.Secure)
+	is.Equal(cookie.SameSite, http.SameSiteLaxMode)
+	token := strings.Trim(strings.TrimSpace(w.Body.String()), `"`)
+	anonymous := cookie
+
+	is.Equal(do(http.MethodPost, "/login", url.Values{"user": {"admin"}}).Code, http.StatusForbidden)
+	is.Equal(do(http.MethodPost, "/login", url.Values{"user": {"admin"}, CSRFTokenField: {"wrong"}}).Code, http.StatusForbidden)
+	is.Equal(do(http.MethodPost, "/login", url.Values{"user": {"admin"}, CSRFTokenField: {token}}).Code, http.StatusSeeOther)
+	is.True(cookie.Value != anonymous.Value) // session is rotated on login
+
+	is.Equal(strings.TrimSpace(do(http.MethodGet, "/me", nil).Body.String()), `{"flashes":["welcome"],"user":"admin"}`)
+	is.Equal(strings.TrimSpace(do(http.MethodGet, "/me", nil).Body.String()), `{"flashes":null,"user":"admin"}`)
+
+	// csrf token is rotated with session, token of anonymous session does not work anymore.
+	is.Equal(do(http.MethodPost, "/logout", nil, CSRFTokenHeader, token).Code, http.StatusForbidden)
+	loggedIn := cookie
+	cookie = anonymous
+	is.Equal(strings.TrimSpace(do(http.MethodGet, "/me", nil).Body.String()), `{"flashes":null,"user":""}`)
+
+	cookie = loggedIn
+	token = strings.Trim(strings.TrimSpace(do(http.MethodGet, "/login", nil).Body.String()), `"`)
+	w = do(http.MethodPost, "/logout", nil, CSRFTokenHeader, token)
+	is.Equal(w.Code, http.StatusNoContent)
+	is.Equal(w.Result().Cookies()[0].MaxAge, -1)
+	cookie = loggedIn
+	is.Equal(strings.TrimSpace(do(http.MethodGet, "/me", nil).Body.String()), `{"flashes":null,"user":""}`)
+
+	// tampered cookies are ignored.
+	id, _, _ := strings.Cut(loggedIn.Value, ".")
+	cookie = &http.Cookie{Name: DefaultSessionCookieName, Value: id + ".forged"}
+	is.Equal(strings.TrimSpace(do(http.MethodGet, "/me", nil).Body.String()), `{"flashes":null,"user":""}`)
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	is := is.New(t)
+	sessions := NewSessionManager(SessionConfig{
+		Cache:           cache.NewMemoryCacher(),
+		Keys:            [][]byte{[]byte("new"), []byte("old")},
+		IdleTimeout:     100 * time.Millisecond,
+		AbsoluteTimeout: 250 * time.Millisecond,
+		Insecure:        true,
+	})
+	mux := NewServeMux()
+	mux.UseMiddlewares(sessions.Middleware())
+	mux.HandleFunc("GET /visit", func(r *Request) (Result, error) {
+		var visits int
+		r.Session().Get("visits", &visits)
+		return Result{Body: visits}, r.Session().Set("visits", visits+1)
+	})
+	var cookie *http.Cookie
+	visit := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/visit", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		cookie = w.Result().Cookies()[0]
+		return strings.TrimSpace(w.Body.String())
+	}
+
+	is.Equal(visit(), "0")
+	is.True(!cookie.Secure)
+	time.Sleep(60 * time.Millisecond)
+	is.Equal(visit(), "1")
+	time.Sleep(60 * time.Millisecond)
+	is.Equal(visit(), "2") // every visit extends idle timeout
+	time.Sleep(150 * time.Millisecond)
+	is.Equal(visit(), "0") // idle
+	for range 3 {
+		time.Sleep(70 * time.Millisecond)
+		visit()
+	}
+	time.Sleep(70 * time.Millisecond)
+	is.Equal(visit(), "0") // absolute
+}
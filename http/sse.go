@@ -0,0 +1,178 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var eventStreamType = reflect.TypeOf((*EventStream)(nil))
+
+// DefaultHeartbeat is the interval of keep alive comments sent on idle event streams.
+const DefaultHeartbeat = 15 * time.Second
+
+// Event is a single server-sent event, string and []byte Data is sent as is and other values are encoded as json.
+type Event struct {
+	ID    string
+	Event string
+	Data  any
+	Retry time.Duration
+}
+
+// EventStream is a Result body that streams events to client as `text/event-stream`,
+// stream ends when events are exhausted or client disconnects.
+type EventStream struct {
+	// Heartbeat is interval of keep alive comments, DefaultHeartbeat is used when zero and negative disables it.
+	Heartbeat time.Duration
+
+	events <-chan Event
+	seq    iter.Seq[Event]
+}
+
+// NewEventStream streams events yielded by seq, seq should stop when context of the request is done
+// since iteration cannot be interrupted while seq is waiting for its next event.
+func NewEventStream(seq iter.Seq[Event]) *EventStream {
+	return &EventStream{seq: seq}
+}
+
+// NewEventStreamFromChannel streams events received from ch until it's closed or client disconnects. Nothing is
+// received from ch after client disconnects, so producers should select on context of the request while sending,
+// otherwise they block forever:
+//
+//	ch := make(chan Event)
+//	go func() {
+//		defer close(ch)
+//		for update := range updates {
+//			select {
+//			case ch <- Event{Data: update}:
+//			case <-r.Context().Done():
+//				return
+//			}
+//		}
+//	}()
+//	return Result{Body: NewEventStreamFromChannel(ch)}, nil
+func NewEventStreamFromChannel(ch <-chan Event) *EventStream {
+	return &EventStream{events: ch}
+}
+
+// LastEventID returns id of the last event client received before reconnecting.
+func (r *Request) LastEventID() string {
+	return r.Header.Get("Last-Event-ID")
+}
+
+func (s *EventStream) serve(w http.ResponseWriter, r *http.Request, status int) {
+	rc := http.NewResponseController(w)
+	// streams outlive write timeout of the server.
+	rc.SetWriteDeadline(time.Time{})
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(status)
+	if err := rc.Flush(); err != nil {
+		slog.Error("event stream needs a flushable response writer", "err", err, "path", r.URL.Path)
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	events := s.events
+	if s.seq != nil {
+		ch := make(chan Event)
+		events = ch
+		go func() {
+			defer close(ch)
+			for event := range s.seq {
+				select {
+				case ch <- event:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	heartbeat := s.Heartbeat
+	if heartbeat == 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var bs []byte
+		select {
+		case <-r.Context().Done():
+			return
+		case <-tick:
+			bs = []byte(": heartbeat\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			var err error
+			if bs, err = event.encode(); err != nil {
+				bs = []byte(fmt.Sprintf(": cannot encode event: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " ")))
+			}
+		}
+		if _, err := w.Write(bs); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (e Event) encode() ([]byte, error) {
+	var data string
+	switch d := e.Data.(type) {
+	case nil:
+	case string:
+		data = d
+	case []byte:
+		data = string(d)
+	default:
+		bs, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		data = string(bs)
+	}
+
+	// id and event are single line fields, a line break would start another field. Clients ignore ids with NUL.
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return nil, fmt.Errorf("event id cannot contain CR, LF or NUL")
+	}
+	if strings.ContainsAny(e.Event, "\r\n") {
+		return nil, fmt.Errorf("event name cannot contain CR or LF")
+	}
+
+	var buf bytes.Buffer
+	if e.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", e.ID)
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", e.Event)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&buf, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(data), "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
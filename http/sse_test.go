@@ -0,0 +1,130 @@
+package http
+
+import (
+	"bufio"
+	"io"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestEventStream(t *testing.T) {
+	is := is.New(t)
+	type input struct {
+		LastEventID string `header:"Last-Event-ID"`
+	}
+	events := make(chan Event)
+	disconnected := make(chan struct{})
+	mux := NewServeMux()
+	mux.UseMiddlewares(RequestLoggerMiddleware(io.Discard), PrometheusExporterMiddleware("sse_test"))
+	mux.HandleFunc("GET /orders/{id}/status", func(r *Request, in *input) (*EventStream, error) {
+		go func() {
+			<-r.Context().Done()
+			close(disconnected)
+		}()
+		return NewEventStreamFromChannel(events), nil
+	})
+	mux.HandleFunc("GET /numbers", func(r *Request) (Result, error) {
+		var seq iter.Seq[Event] = func(yield func(Event) bool) {
+			for i, n := range []string{"one", "two"} {
+				if !yield(Event{ID: string(rune('1' + i)), Data: map[string]string{"n": n}}) {
+					return
+				}
+			}
+		}
+		stream := NewEventStream(seq)
+		stream.Heartbeat = -1
+		return Result{Body: stream}, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/numbers")
+	is.NoErr(err)
+	body, err := io.ReadAll(resp.Body)
+	is.NoErr(err)
+	resp.Body.Close()
+	is.Equal(resp.Header.Get("Content-Type"), "text/event-stream")
+	is.Equal(string(body), "id: 1\ndata: {\"n\":\"one\"}\n\nid: 2\ndata: {\"n\":\"two\"}\n\n")
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/orders/1/status", nil)
+	is.NoErr(err)
+	req.Header.Set("Last-Event-ID", "41")
+	resp, err = http.DefaultClient.Do(req)
+	is.NoErr(err)
+	is.Equal(resp.StatusCode, http.StatusOK)
+	reader := bufio.NewReader(resp.Body)
+
+	// each event must reach client before the next one is produced.
+	events <- Event{ID: "42", Event: "status", Data: "paid\nshipped", Retry: time.Second}
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		is.NoErr(err)
+		if line == "\n" {
+			break
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	is.Equal(lines, []string{"id: 42", "event: status", "retry: 1000", "data: paid", "data: shipped"})
+
+	resp.Body.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("handler was not cancelled after client disconnected")
+	}
+}
+
+func TestEventStreamProducerDisconnect(t *testing.T) {
+	is := is.New(t)
+	stopped := make(chan struct{})
+	mux := NewServeMux()
+	mux.HandleFunc("GET /ticks", func(r *Request) (Result, error) {
+		ch := make(chan Event)
+		go func() {
+			defer close(stopped)
+			defer close(ch)
+			for i := 0; ; i++ {
+				select {
+				case ch <- Event{Data: i}:
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}()
+		return Result{Body: NewEventStreamFromChannel(ch)}, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/ticks")
+	is.NoErr(err)
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	is.NoErr(err)
+	is.Equal(line, "data: 0\n")
+	resp.Body.Close()
+
+	// producer that selects on context of the request is not left blocked on send.
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("producer was left blocked after client disconnected")
+	}
+}
+
+func TestEventEncode(t *testing.T) {
+	is := is.New(t)
+	bs, err := Event{Data: "a\rb\r\nc"}.encode()
+	is.NoErr(err)
+	is.Equal(string(bs), "data: a\ndata: b\ndata: c\n\n")
+	for _, event := range []Event{{ID: "1\ndata: forged"}, {ID: "1\x00"}, {Event: "status\rid: 2"}} {
+		_, err := event.encode()
+		is.True(err != nil) // event
+	}
+}
@@ -0,0 +1,363 @@
+package http
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/amirrezaask/pkg/lock"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrTokenRevoked        = stderrors.New("token is revoked")
+	ErrInvalidRefreshToken = stderrors.New("refresh token is invalid or expired")
+	// ErrRefreshTokenReused means a rotated refresh token was used again, so it was probably stolen
+	// and every token of its family is revoked.
+	ErrRefreshTokenReused = stderrors.New("refresh token was already used")
+)
+
+var registeredClaimsType = reflect.TypeOf(jwt.RegisteredClaims{})
+
+type TokenServiceConfig struct {
+	SigningMethod jwt.SigningMethod
+	// SigningKey is a []byte secret for HMAC methods and a private key for others.
+	SigningKey any
+	// KeyID is set as kid header, so verifiers using JWKS can find the key.
+	KeyID           string
+	Issuer          string
+	Audience        []string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Cache stores refresh tokens and revoked token ids.
+	Cache cache.Cacher
+	// Locker serializes concurrent uses of the same refresh token when set, Cacher alone cannot detect such races.
+	Locker lock.Locker
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenService issues access tokens with claims of type C, which must embed jwt.RegisteredClaims, and rotating
+// refresh tokens. Every refresh token belongs to the family started by Issue, jti of access tokens carries
+// the family too, so revoking a family revokes its access tokens as well.
+type TokenService[C any, CLAIMS interface {
+	jwt.Claims
+	*C
+}] struct {
+	cfg      TokenServiceConfig
+	verifier *JWTVerifier
+}
+
+type refreshTokenRecord struct {
+	Family string          `json:"family"`
+	Claims json.RawMessage `json:"claims"`
+	Used   bool            `json:"used"`
+}
+
+func NewTokenService[C any, CLAIMS interface {
+	jwt.Claims
+	*C
+}](cfg TokenServiceConfig) *TokenService[C, CLAIMS] {
+	if cfg.SigningMethod == nil || cfg.SigningKey == nil || cfg.Cache == nil {
+		panic("token service needs signing method, signing key and cache")
+	}
+	if field, ok := reflect.TypeOf(new(C)).Elem().FieldByName(registeredClaimsType.Name()); !ok || field.Type != registeredClaimsType {
+		panic("claims of token service should embed jwt.RegisteredClaims by value")
+	}
+	if cfg.AccessTokenTTL == 0 {
+		cfg.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if cfg.RefreshTokenTTL == 0 {
+		cfg.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+	verificationKey := cfg.SigningKey
+	if signer, ok := cfg.SigningKey.(crypto.Signer); ok {
+		verificationKey = signer.Public()
+	}
+	var audience string
+	if len(cfg.Audience) > 0 {
+		audience = cfg.Audience[0]
+	}
+	return &TokenService[C, CLAIMS]{
+		cfg: cfg,
+		verifier: NewJWTVerifier(JWTVerifierConfig{
+			Keys:              StaticKeys{"": verificationKey},
+			Algorithms:        []string{cfg.SigningMethod.Alg()},
+			Issuer:            cfg.Issuer,
+			Audience:          audience,
+			RequireExpiration: true,
+			Strict:            true,
+		}),
+	}
+}
+
+// Issue starts a new refresh token family for claims, registered claims other than subject are set by the service.
+func (s *TokenService[C, CLAIMS]) Issue(ctx context.Context, claims CLAIMS) (TokenPair, error) {
+	return s.issue(ctx, claims, randomToken(16))
+}
+
+// Refresh rotates refreshToken, it can be used only once and using it again revokes its whole family.
+func (s *TokenService[C, CLAIMS]) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	key := refreshTokenKey(refreshToken)
+	if s.cfg.Locker != nil {
+		// a token used concurrently is rejected, only one of them can win the rotation.
+		if err := s.cfg.Locker.Lock(ctx, key+":lock"); errors.Is(err, lock.ErrLocked) {
+			return TokenPair{}, ErrInvalidRefreshToken
+		} else if err != nil {
+			return TokenPair{}, tokenStoreUnavailable(err)
+		}
+		defer s.cfg.Locker.Unlock(context.WithoutCancel(ctx), key+":lock")
+	}
+	cached, err := s.cfg.Cache.Get(ctx, key)
+	if cache.IsMiss(err) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return TokenPair{}, tokenStoreUnavailable(err)
+	}
+	var record refreshTokenRecord
+	if err := decodeCached(cached, &record); err != nil {
+		return TokenPair{}, errors.Wrap(err, "cannot decode refresh token")
+	}
+	revoked, err := s.revoked(ctx, familyKey(record.Family))
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if revoked {
+		return TokenPair{}, ErrTokenRevoked
+	}
+	if record.Used {
+		if err := s.revokeFamily(ctx, record.Family); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrRefreshTokenReused
+	}
+
+	// used tokens are kept until they expire, so their reuse can be detected.
+	record.Used = true
+	if err := s.remember(ctx, key, record, s.cfg.RefreshTokenTTL); err != nil {
+		return TokenPair{}, err
+	}
+	claims := CLAIMS(new(C))
+	if err := json.Unmarshal(record.Claims, claims); err != nil {
+		return TokenPair{}, errors.Wrap(err, "cannot decode claims of refresh token")
+	}
+	return s.issue(ctx, claims, record.Family)
+}
+
+// Verify checks signature, registered claims and revocation of an access token.
+func (s *TokenService[C, CLAIMS]) Verify(ctx context.Context, accessToken string) (CLAIMS, error) {
+	claims, err := VerifyJWT[C, CLAIMS](ctx, s.verifier, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	jti := registeredClaims(claims).ID
+	family, _, _ := strings.Cut(jti, ".")
+	for _, key := range []string{revokedKey(jti), familyKey(family)} {
+		revoked, err := s.revoked(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+// RevokeAccessToken adds jti of accessToken to the denylist until it expires, invalid tokens are ignored
+// since they cannot be used anyway.
+func (s *TokenService[C, CLAIMS]) RevokeAccessToken(ctx context.Context, accessToken string) error {
+	claims, err := s.Verify(ctx, accessToken)
+	if _, unavailable := errors.AsHTTPError(err); unavailable {
+		return err
+	}
+	if err != nil {
+		return nil
+	}
+	rc := registeredClaims(claims)
+	ttl := time.Until(rc.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.cfg.Cache.Remember(ctx, revokedKey(rc.ID), "1", ttl)
+}
+
+// RevokeRefreshToken revokes the family of refreshToken, including its access tokens.
+func (s *TokenService[C, CLAIMS]) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	cached, err := s.cfg.Cache.Get(ctx, refreshTokenKey(refreshToken))
+	if cache.IsMiss(err) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return tokenStoreUnavailable(err)
+	}
+	var record refreshTokenRecord
+	if err := decodeCached(cached, &record); err != nil {
+		return errors.Wrap(err, "cannot decode refresh token")
+	}
+	return s.revokeFamily(ctx, record.Family)
+}
+
+// Middleware authenticates requests with access tokens of s, revoked tokens are rejected.
+func (s *TokenService[C, CLAIMS]) Middleware() MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			claims, err := s.Verify(r.Context(), token)
+			if _, unavailable := errors.AsHTTPError(err); unavailable {
+				writeError(w, r, err)
+				return
+			}
+			if err != nil {
+				s.verifier.challenge(w, r, "invalid_token", "token is invalid")
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), ClaimsKey, jwt.Claims(claims)))
+			r = r.WithContext(context.WithValue(r.Context(), IsAuthenticatedKey, true))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type revokeTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+	// TokenTypeHint is either access_token or refresh_token, both are tried when it's empty.
+	TokenTypeHint string `json:"token_type_hint"`
+}
+
+// MapEndpoints registers `POST <prefix>/refresh` that rotates refresh tokens and `POST <prefix>/revoke`
+// that revokes access or refresh tokens as described in RFC 7009, both accept JSON and form bodies.
+func (s *TokenService[C, CLAIMS]) MapEndpoints(mux *ServeMux, prefix string, middlewares ...MiddlewareFunc) {
+	prefix = groupPrefix(prefix)
+	mux.HandleFunc("POST "+prefix+"/refresh", func(r *Request, in *refreshTokenRequest) (TokenPair, error) {
+		pair, err := s.Refresh(r.Context(), in.RefreshToken)
+		if stderrors.Is(err, ErrInvalidRefreshToken) || stderrors.Is(err, ErrRefreshTokenReused) || stderrors.Is(err, ErrTokenRevoked) {
+			return TokenPair{}, errors.NewHTTPError(http.StatusBadRequest, "invalid_grant", err.Error()).Wrap(err)
+		}
+		return pair, err
+	}, middlewares...).WithSummary("Rotate refresh token")
+
+	mux.HandleFunc("POST "+prefix+"/revoke", func(r *Request, in *revokeTokenRequest) (struct{}, error) {
+		if in.TokenTypeHint != "access_token" {
+			err := s.RevokeRefreshToken(r.Context(), in.Token)
+			if !stderrors.Is(err, ErrInvalidRefreshToken) {
+				return struct{}{}, err
+			}
+		}
+		return struct{}{}, s.RevokeAccessToken(r.Context(), in.Token)
+	}, middlewares...).WithSummary("Revoke token")
+}
+
+func (s *TokenService[C, CLAIMS]) issue(ctx context.Context, claims CLAIMS, family string) (TokenPair, error) {
+	now := time.Now()
+	rc := registeredClaims(claims)
+	rc.Issuer = s.cfg.Issuer
+	rc.Audience = s.cfg.Audience
+	rc.IssuedAt = jwt.NewNumericDate(now)
+	rc.NotBefore = jwt.NewNumericDate(now)
+	rc.ExpiresAt = jwt.NewNumericDate(now.Add(s.cfg.AccessTokenTTL))
+	rc.ID = family + "." + randomToken(8)
+
+	token := jwt.NewWithClaims(s.cfg.SigningMethod, claims)
+	if s.cfg.KeyID != "" {
+		token.Header["kid"] = s.cfg.KeyID
+	}
+	access, err := token.SignedString(s.cfg.SigningKey)
+	if err != nil {
+		return TokenPair{}, errors.Wrap(err, "cannot sign access token")
+	}
+	bs, err := json.Marshal(claims)
+	if err != nil {
+		return TokenPair{}, errors.Wrap(err, "cannot encode claims")
+	}
+	refresh := randomToken(32)
+	if err := s.remember(ctx, refreshTokenKey(refresh), refreshTokenRecord{Family: family, Claims: bs}, s.cfg.RefreshTokenTTL); err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{AccessToken: access, TokenType: "Bearer", ExpiresIn: int(s.cfg.AccessTokenTTL.Seconds()), RefreshToken: refresh}, nil
+}
+
+func (s *TokenService[C, CLAIMS]) revokeFamily(ctx context.Context, family string) error {
+	// family lives as long as its latest refresh token.
+	return s.cfg.Cache.Remember(ctx, familyKey(family), "1", s.cfg.RefreshTokenTTL)
+}
+
+// revoked reports whether key is in the denylist, failures of cache are returned as 503 so revocation never fails open.
+func (s *TokenService[C, CLAIMS]) revoked(ctx context.Context, key string) (bool, error) {
+	_, err := s.cfg.Cache.Get(ctx, key)
+	if cache.IsMiss(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.NewHTTPError(http.StatusServiceUnavailable, "revocation_unavailable", "token revocation cannot be checked").Wrap(err)
+	}
+	return true, nil
+}
+
+// tokenStoreUnavailable reports failures of Cache or Locker, clients should retry instead of dropping their tokens.
+func tokenStoreUnavailable(err error) error {
+	return errors.NewHTTPError(http.StatusServiceUnavailable, "token_store_unavailable", "refresh token cannot be checked").Wrap(err)
+}
+
+func (s *TokenService[C, CLAIMS]) remember(ctx context.Context, key string, v any, ttl time.Duration) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(s.cfg.Cache.Remember(ctx, key, string(bs), ttl), "cannot store token")
+}
+
+// registeredClaims returns jwt.RegisteredClaims embedded in claims.
+func registeredClaims(claims any) *jwt.RegisteredClaims {
+	return reflect.ValueOf(claims).Elem().FieldByName(registeredClaimsType.Name()).Addr().Interface().(*jwt.RegisteredClaims)
+}
+
+// refresh tokens are stored by their hash, so a leaked cache does not leak usable tokens.
+func refreshTokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:refresh:" + hex.EncodeToString(sum[:])
+}
+
+func familyKey(family string) string {
+	return "token:family:" + family
+}
+
+func revokedKey(jti string) string {
+	return "token:revoked:" + jti
+}
+
+func randomToken(n int) string {
+	bs := make([]byte, n)
+	rand.Read(bs)
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
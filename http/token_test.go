@@ -0,0 +1,221 @@
+package http
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/amirrezaask/pkg/cache"
+	"github.com/amirrezaask/pkg/errors"
+	"github.com/amirrezaask/pkg/lock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/matryer/is"
+)
+
+type testTokenClaims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role"`
+}
+
+func TestTokenService(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	is.NoErr(err)
+	tokens := NewTokenService[testTokenClaims](TokenServiceConfig{
+		SigningMethod: jwt.SigningMethodEdDSA,
+		SigningKey:    key,
+		Issuer:        "https://auth.example.com",
+		Audience:      []string{"orders"},
+		Cache:         cache.NewMemoryCacher(),
+		Locker:        lock.NewInMemoryLock(),
+	})
+
+	mux := NewServeMux()
+	tokens.MapEndpoints(mux, "/token")
+	mux.HandleFunc("GET /me", func(r *Request) (Result, error) {
+		return Result{Body: r.GetClaims().(*testTokenClaims).Role}, nil
+	}, tokens.Middleware(), AuthenticatedOnlyMiddleware)
+
+	me := func(access string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+access)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	refresh := func(token string) (TokenPair, int) {
+		w := post("/token/refresh", url.Values{"refresh_token": {token}})
+		var pair TokenPair
+		json.Unmarshal(w.Body.Bytes(), &pair)
+		return pair, w.Code
+	}
+
+	first, err := tokens.Issue(ctx, &testTokenClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"}, Role: "admin"})
+	is.NoErr(err)
+	is.Equal(first.TokenType, "Bearer")
+	is.Equal(first.ExpiresIn, int(DefaultAccessTokenTTL.Seconds()))
+	w := me(first.AccessToken)
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(strings.TrimSpace(w.Body.String()), `"admin"`)
+
+	second, status := refresh(first.RefreshToken)
+	is.Equal(status, http.StatusOK)
+	is.True(second.RefreshToken != first.RefreshToken)
+	claims, err := tokens.Verify(ctx, second.AccessToken)
+	is.NoErr(err)
+	is.Equal(claims.Subject, "user-1") // claims are carried over rotations
+	is.Equal(claims.Role, "admin")
+	is.Equal(claims.Issuer, "https://auth.example.com")
+
+	// access tokens are revoked by their jti.
+	is.Equal(post("/token/revoke", url.Values{"token": {first.AccessToken}, "token_type_hint": {"access_token"}}).Code, http.StatusOK)
+	is.Equal(me(first.AccessToken).Code, http.StatusUnauthorized)
+	is.Equal(me(second.AccessToken).Code, http.StatusOK)
+
+	// reusing a rotated refresh token revokes the whole family.
+	_, status = refresh(first.RefreshToken)
+	is.Equal(status, http.StatusBadRequest)
+	_, status = refresh(second.RefreshToken)
+	is.Equal(status, http.StatusBadRequest)
+	is.Equal(me(second.AccessToken).Code, http.StatusUnauthorized)
+
+	// other families are untouched and can be revoked by their refresh tokens.
+	other, err := tokens.Issue(ctx, &testTokenClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user-2"}})
+	is.NoErr(err)
+	is.Equal(me(other.AccessToken).Code, http.StatusOK)
+	is.Equal(post("/token/revoke", url.Values{"token": {other.RefreshToken}}).Code, http.StatusOK)
+	is.Equal(me(other.AccessToken).Code, http.StatusUnauthorized)
+	_, status = refresh(other.RefreshToken)
+	is.Equal(status, http.StatusBadRequest)
+
+	// unknown tokens are not reported, RFC 7009.
+	is.Equal(post("/token/revoke", url.Values{"token": {"unknown"}}).Code, http.StatusOK)
+	_, status = refresh("unknown")
+	is.Equal(status, http.StatusBadRequest)
+}
+
+// unavailableCacher fails reads of revocation keys while down is set and reads of every key while refreshDown is set.
+type unavailableCacher struct {
+	cache.Cacher
+	down        bool
+	refreshDown bool
+}
+
+func (c *unavailableCacher) Get(ctx context.Context, key string) (any, error) {
+	if c.refreshDown || (c.down && !strings.HasPrefix(key, "token:refresh:")) {
+		return nil, errors.New("connection refused")
+	}
+	return c.Cacher.Get(ctx, key)
+}
+
+func TestTokenServiceCacheFailure(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	cacher := &unavailableCacher{Cacher: cache.NewMemoryCacher()}
+	tokens := NewTokenService[testTokenClaims](TokenServiceConfig{SigningMethod: jwt.SigningMethodHS256, SigningKey: []byte("secret"), Cache: cacher})
+	pair, err := tokens.Issue(ctx, &testTokenClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"}})
+	is.NoErr(err)
+	_, err = tokens.Verify(ctx, pair.AccessToken)
+	is.NoErr(err)
+
+	// revocation cannot be checked, so tokens are not trusted.
+	cacher.down = true
+	_, err = tokens.Verify(ctx, pair.AccessToken)
+	is.True(err != nil)
+	_, err = tokens.Refresh(ctx, pair.RefreshToken)
+	is.True(err != nil)
+
+	mux := NewServeMux()
+	mux.UseMiddlewares(tokens.Middleware())
+	mux.HandleFunc("GET /", func(r *Request) (Result, error) { return Result{}, nil })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	is.Equal(w.Code, http.StatusServiceUnavailable)
+
+	cacher.down = false
+	_, err = tokens.Refresh(ctx, pair.RefreshToken)
+	is.NoErr(err) // failed refresh did not use up the token
+}
+
+func TestTokenServiceRefreshStoreFailure(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	cacher := &unavailableCacher{Cacher: cache.NewMemoryCacher()}
+	tokens := NewTokenService[testTokenClaims](TokenServiceConfig{SigningMethod: jwt.SigningMethodHS256, SigningKey: []byte("secret"), Cache: cacher})
+	pair, err := tokens.Issue(ctx, &testTokenClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"}})
+	is.NoErr(err)
+	mux := NewServeMux()
+	tokens.MapEndpoints(mux, "/auth")
+	refresh := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(`{"refresh_token":"`+pair.RefreshToken+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// store failures are not reported as invalid grants, so clients keep their tokens and retry.
+	cacher.refreshDown = true
+	is.Equal(refresh().Code, http.StatusServiceUnavailable)
+	_, unavailable := errors.AsHTTPError(tokens.RevokeRefreshToken(ctx, pair.RefreshToken))
+	is.True(unavailable)
+	cacher.refreshDown = false
+
+	failing := NewTokenService[testTokenClaims](TokenServiceConfig{SigningMethod: jwt.SigningMethodHS256, SigningKey: []byte("secret"), Cache: cacher, Locker: failingLocker{}})
+	_, err = failing.Refresh(ctx, pair.RefreshToken)
+	_, unavailable = errors.AsHTTPError(err)
+	is.True(unavailable)
+
+	is.Equal(refresh().Code, http.StatusOK)
+	is.Equal(refresh().Code, http.StatusBadRequest) // reused
+	_, err = tokens.Refresh(ctx, "unknown")
+	is.True(errors.Is(err, ErrInvalidRefreshToken))
+}
+
+func TestTokenServiceClaimsType(t *testing.T) {
+	is := is.New(t)
+	type pointerClaims struct {
+		*jwt.RegisteredClaims
+	}
+	defer func() {
+		is.True(recover() != nil) // claims should embed jwt.RegisteredClaims by value
+	}()
+	NewTokenService[pointerClaims](TokenServiceConfig{SigningMethod: jwt.SigningMethodHS256, SigningKey: []byte("secret"), Cache: cache.NewMemoryCacher()})
+}
+
+func TestTokenServiceHMAC(t *testing.T) {
+	is := is.New(t)
+	secret := []byte("secret")
+	tokens := NewTokenService[testTokenClaims](TokenServiceConfig{SigningMethod: jwt.SigningMethodHS256, SigningKey: secret, Cache: cache.NewMemoryCacher()})
+	pair, err := tokens.Issue(context.Background(), &testTokenClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"}})
+	is.NoErr(err)
+
+	// tokens are verifiable by JWTBearerAuthenticationMiddleware with the same claims type.
+	mux := NewServeMux()
+	mux.UseMiddlewares(JWTBearerAuthenticationMiddleware[testTokenClaims](secret))
+	mux.HandleFunc("GET /", func(r *Request) (Result, error) {
+		sub, err := r.GetClaims().GetSubject()
+		return Result{Body: sub}, err
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	is.Equal(strings.TrimSpace(w.Body.String()), `"user-1"`)
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/amirrezaask/pkg/http"
+
+// TracePropagator extracts and injects W3C traceparent and baggage headers.
+var TracePropagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// TracingMiddleware starts a server span for every request named by its registered pattern, continuing the trace
+// of incoming traceparent header, tp defaults to the global provider when nil.
+// Histograms of PrometheusExporterMiddleware and NewClient get trace id exemplars of sampled spans.
+func TracingMiddleware(tp trace.TracerProvider) MiddlewareFunc {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	tracer := tp.Tracer(tracerName)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := TracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			route, _ := r.Context().Value("registered_uri").(string)
+			name := route
+			if name == "" {
+				name = r.Method
+			}
+			attrs := []attribute.KeyValue{
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.URLScheme(scheme(r)),
+				semconv.NetworkProtocolVersion(strings.TrimPrefix(r.Proto, "HTTP/")),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			}
+			if route != "" {
+				attrs = append(attrs, semconv.HTTPRoute(newRoute(route).Path))
+			}
+			attrs = append(attrs, hostAttributes(r.Host)...)
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				attrs = append(attrs, semconv.ClientAddress(host))
+			}
+			ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+			defer span.End()
+
+			recorder := &statusRecorder{ResponseWriter: w}
+			// r is updated in place like registered_uri, so middlewares that run before this one see the span too.
+			*r = *r.WithContext(ctx)
+			next.ServeHTTP(recorder, r)
+
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
+
+// startClientSpan starts a client span for req and injects its context into a copy of req.
+func startClientSpan(req *http.Request) (*http.Request, trace.Span) {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.URLFull(req.URL.Redacted()),
+	}
+	attrs = append(attrs, hostAttributes(req.URL.Host)...)
+	ctx, span := otel.Tracer(tracerName).Start(req.Context(), req.Method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	// round trippers must not modify the request.
+	req = req.Clone(ctx)
+	TracePropagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, span
+}
+
+func endClientSpan(span trace.Span, resp *http.Response, err error) {
+	defer span.End()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+}
+
+// observeWithTrace observes v with trace id of ctx as exemplar when ctx carries a sampled span.
+func observeWithTrace(ctx context.Context, o prometheus.Observer, v float64) {
+	sc := trace.SpanContextFromContext(ctx)
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && sc.IsValid() && sc.IsSampled() {
+		eo.ObserveWithExemplar(v, prometheus.Labels{"trace_id": sc.TraceID().String()})
+		return
+	}
+	o.Observe(v)
+}
+
+func hostAttributes(hostport string) []attribute.KeyValue {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return []attribute.KeyValue{semconv.ServerAddress(hostport)}
+	}
+	attrs := []attribute.KeyValue{semconv.ServerAddress(host)}
+	if p, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, semconv.ServerPort(p))
+	}
+	return attrs
+}
+
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
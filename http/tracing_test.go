@@ -0,0 +1,90 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	is := is.New(t)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	// client spans use the global provider.
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(previous)
+
+	var downstreamTraceparent string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstreamTraceparent = r.Header.Get("traceparent")
+	}))
+	defer downstream.Close()
+	client := NewClient("tracing_test", "downstream", time.Second)
+
+	mux := NewServeMux()
+	mux.UseMiddlewares(PrometheusExporterMiddleware("tracing_test"), TracingMiddleware(tp))
+	mux.HandleFunc("GET /users/{id}", func(r *Request) (Result, error) {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, downstream.URL, nil)
+		if err != nil {
+			return Result{}, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return Result{}, err
+		}
+		resp.Body.Close()
+		return Result{Status: http.StatusInternalServerError, Body: "failed"}, nil
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	is.Equal(w.Code, http.StatusInternalServerError)
+
+	spans := exporter.GetSpans()
+	is.Equal(len(spans), 2)
+	clientSpan, serverSpan := spans[0], spans[1]
+
+	is.Equal(serverSpan.Name, "GET /users/{id}")
+	is.Equal(serverSpan.SpanKind, trace.SpanKindServer)
+	is.Equal(serverSpan.SpanContext.TraceID().String(), traceID) // continues incoming trace
+	is.Equal(serverSpan.Parent.SpanID().String(), "00f067aa0ba902b7")
+	is.Equal(serverSpan.Status.Code.String(), "Error")
+	attrs := attribute.NewSet(serverSpan.Attributes...)
+	route, _ := attrs.Value("http.route")
+	is.Equal(route.AsString(), "/users/{id}")
+	status, _ := attrs.Value("http.response.status_code")
+	is.Equal(status.AsInt64(), int64(http.StatusInternalServerError))
+
+	is.Equal(clientSpan.Name, http.MethodGet)
+	is.Equal(clientSpan.SpanKind, trace.SpanKindClient)
+	is.Equal(clientSpan.Parent.SpanID(), serverSpan.SpanContext.SpanID())
+	is.Equal(downstreamTraceparent, "00-"+traceID+"-"+clientSpan.SpanContext.SpanID().String()+"-01")
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	is.NoErr(err)
+	var exemplar string
+	for _, family := range families {
+		if family.GetName() != "tracing_test_httpserver_requests_duration" {
+			continue
+		}
+		for _, bucket := range family.GetMetric()[0].GetHistogram().GetBucket() {
+			for _, label := range bucket.GetExemplar().GetLabel() {
+				exemplar = label.GetValue()
+			}
+		}
+	}
+	is.Equal(exemplar, traceID)
+}
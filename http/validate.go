@@ -0,0 +1,439 @@
+package http
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/amirrezaask/pkg/http/openapi"
+)
+
+// ValidatorFunc reports whether value satisfies the rule, param is the text after `=` in the rule, eg: `3` in `min=3`.
+type ValidatorFunc func(value reflect.Value, param string) bool
+
+var (
+	validatorsMu sync.RWMutex
+	validators   = map[string]ValidatorFunc{
+		"required": validateRequired,
+		"min":      validateMin,
+		"max":      validateMax,
+		"len":      validateLen,
+		"regex":    validateRegex,
+		"oneof":    validateOneOf,
+		"email":    validateEmail,
+	}
+	regexCache sync.Map
+	timeType   = reflect.TypeOf(time.Time{})
+)
+
+// RegisterValidator adds a rule that can be used in `validate` struct tags, registering an existing name replaces it.
+func RegisterValidator(name string, fn ValidatorFunc) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	validators[name] = fn
+}
+
+// FieldError describes a single field that failed validation.
+type FieldError struct {
+	// Field is the name client used for the value, eg: json name for body fields and query name for query params.
+	Field string `json:"field"`
+	// In is where the field is coming from: body, query, path, header, cookie.
+	In      string `json:"in"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by Validate and contains every field that failed validation.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (v *ValidationError) Error() string {
+	msgs := make([]string, 0, len(v.Errors))
+	for _, fe := range v.Errors {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, ", ")
+}
+
+// Validate checks struct v against rules in `validate` struct tags. Rules are separated by comma:
+//
+//	Name  string   `json:"name" validate:"required,min=3,max=64"`
+//	Color string   `query:"color" validate:"omitempty,oneof=red green blue"`
+//	Tags  []string `json:"tags" validate:"max=5,dive,regex=^[a-z]+$"`
+//
+// `omitempty` skips the remaining rules when value is zero, `dive` applies the rules after it to every
+// element of a slice, array or map. Nested structs and slices of structs are validated recursively.
+// Returned error is a *ValidationError.
+func Validate(v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs []FieldError
+	validateStruct(rv, "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: errs}
+}
+
+func validateStruct(rv reflect.Value, prefix string, errs *[]FieldError) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if (field.Anonymous && field.Tag.Get("json") == "") || isParamContainer(field) {
+			// embedded struct fields are promoted and parameters are named by their own tags, so they don't get a prefix.
+			if embedded := indirect(rv.Field(i)); embedded.Kind() == reflect.Struct {
+				validateStruct(embedded, prefix, errs)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name, in := fieldName(field)
+		if name == "" {
+			continue
+		}
+		validateValue(rv.Field(i), field.Tag.Get("validate"), prefix+name, in, errs)
+	}
+}
+
+// checkValidationTags checks rules in `validate` tags of t and its nested structs, so a typo in a rule
+// fails when a route is registered instead of on the first request that reaches the field.
+func checkValidationTags(t reflect.Type) error {
+	return checkStructTags(t, "", map[reflect.Type]bool{})
+}
+
+func checkStructTags(t reflect.Type, prefix string, seen map[reflect.Type]bool) error {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct || t == timeType || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if (field.Anonymous && field.Tag.Get("json") == "") || isParamContainer(field) {
+			if embedded := indirectType(field.Type); embedded.Kind() == reflect.Struct {
+				if err := checkStructTags(embedded, prefix, seen); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name, _ := fieldName(field)
+		if name == "" {
+			continue
+		}
+		if err := checkTag(field.Type, field.Tag.Get("validate"), prefix+name, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkTag(t reflect.Type, tag string, path string, seen map[reflect.Type]bool) error {
+	rules := splitRules(tag)
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "", "omitempty":
+			continue
+		case "dive":
+			switch elem := indirectType(t); elem.Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map:
+				return checkTag(elem.Elem(), strings.Join(rules[i+1:], ","), path+"[]", seen)
+			}
+			return fmt.Errorf("dive rule on %s that is not a slice, array or map", path)
+		}
+		if err := checkRule(name, param); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	switch t = indirectType(t); t.Kind() {
+	case reflect.Struct:
+		return checkStructTags(t, path+".", seen)
+	case reflect.Slice, reflect.Array:
+		return checkStructTags(t.Elem(), path+"[].", seen)
+	}
+	return nil
+}
+
+// checkRule checks that rule is registered and parameters of builtin rules can be parsed.
+func checkRule(name string, param string) error {
+	validatorsMu.RLock()
+	_, exists := validators[name]
+	validatorsMu.RUnlock()
+	if !exists {
+		return fmt.Errorf("unknown validation rule %q", name)
+	}
+	switch name {
+	case "min", "max", "len":
+		if _, err := strconv.ParseFloat(param, 64); err != nil {
+			return fmt.Errorf("invalid parameter %q of %s rule: %w", param, name, err)
+		}
+	case "regex":
+		if _, err := regexp.Compile(param); err != nil {
+			return fmt.Errorf("invalid parameter of regex rule: %w", err)
+		}
+	case "oneof":
+		if strings.TrimSpace(param) == "" {
+			return fmt.Errorf("oneof rule needs at least one value")
+		}
+	}
+	return nil
+}
+
+// fieldName returns name and location of field as client sends it.
+func fieldName(field reflect.StructField) (string, string) {
+	if name, in := paramOf(field); in != "" {
+		return name, in
+	}
+	name, _, skip := openapi.JSONFieldName(field)
+	if skip {
+		return "", ""
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, "body"
+}
+
+func validateValue(value reflect.Value, tag string, path string, in string, errs *[]FieldError) {
+	rules := splitRules(tag)
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "":
+			continue
+		case "omitempty":
+			if value.IsZero() {
+				return
+			}
+			continue
+		case "dive":
+			elemTag := strings.Join(rules[i+1:], ",")
+			value = indirect(value)
+			switch value.Kind() {
+			case reflect.Slice, reflect.Array:
+				for j := 0; j < value.Len(); j++ {
+					validateValue(value.Index(j), elemTag, fmt.Sprintf("%s[%d]", path, j), in, errs)
+				}
+			case reflect.Map:
+				iter := value.MapRange()
+				for iter.Next() {
+					validateValue(iter.Value(), elemTag, fmt.Sprintf("%s[%v]", path, iter.Key()), in, errs)
+				}
+			}
+			return
+		}
+
+		validatorsMu.RLock()
+		fn, exists := validators[name]
+		validatorsMu.RUnlock()
+		if !exists {
+			panic(fmt.Sprintf("unknown validation rule %q on %s", name, path))
+		}
+		if !fn(value, param) {
+			*errs = append(*errs, FieldError{Field: path, In: in, Rule: name, Param: param, Message: ruleMessage(name, param, value)})
+			// rest of the rules are meaningless when a required value is missing.
+			if name == "required" {
+				return
+			}
+		}
+	}
+
+	value = indirect(value)
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type() != timeType {
+			validateStruct(value, path+".", errs)
+		}
+	case reflect.Slice, reflect.Array:
+		if elem := value.Type().Elem(); elem.Kind() == reflect.Struct || (elem.Kind() == reflect.Pointer && elem.Elem().Kind() == reflect.Struct) {
+			for j := 0; j < value.Len(); j++ {
+				validateValue(value.Index(j), "", fmt.Sprintf("%s[%d]", path, j), in, errs)
+			}
+		}
+	}
+}
+
+// splitRules splits tag by commas, commas inside a regex parameter are kept when escaped as `\,`.
+func splitRules(tag string) []string {
+	if tag == "" {
+		return nil
+	}
+	var rules []string
+	var current strings.Builder
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case tag[i] == ',':
+			rules = append(rules, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(tag[i])
+		}
+	}
+	return append(rules, current.String())
+}
+
+// hasRule reports whether field has rule in its validate tag, rules that are applied to elements using dive don't count.
+func hasRule(field reflect.StructField, rule string) bool {
+	for _, r := range splitRules(field.Tag.Get("validate")) {
+		name, _, _ := strings.Cut(r, "=")
+		if name == "dive" {
+			return false
+		}
+		if name == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func ruleMessage(rule string, param string, value reflect.Value) string {
+	isLength := false
+	switch indirect(value).Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		isLength = true
+	}
+	switch rule {
+	case "required":
+		return "is required"
+	case "min":
+		if isLength {
+			return "length must be at least " + param
+		}
+		return "must be at least " + param
+	case "max":
+		if isLength {
+			return "length must be at most " + param
+		}
+		return "must be at most " + param
+	case "len":
+		return "length must be exactly " + param
+	case "regex":
+		return "must match " + param
+	case "oneof":
+		return "must be one of [" + param + "]"
+	case "email":
+		return "must be a valid email address"
+	default:
+		return "failed on " + rule + " rule"
+	}
+}
+
+func validateRequired(value reflect.Value, _ string) bool {
+	if value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		return !value.IsNil()
+	}
+	return !value.IsZero()
+}
+
+// size returns numeric value of v, or its length for strings, slices and maps.
+func size(v reflect.Value) (float64, bool) {
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func compareSize(value reflect.Value, param string, ok func(size float64, limit float64) bool) bool {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("invalid validation rule parameter %q: %s", param, err))
+	}
+	if value.Kind() == reflect.Pointer && value.IsNil() {
+		return true
+	}
+	s, sizable := size(value)
+	return !sizable || ok(s, limit)
+}
+
+func validateMin(value reflect.Value, param string) bool {
+	return compareSize(value, param, func(size, limit float64) bool { return size >= limit })
+}
+
+func validateMax(value reflect.Value, param string) bool {
+	return compareSize(value, param, func(size, limit float64) bool { return size <= limit })
+}
+
+func validateLen(value reflect.Value, param string) bool {
+	return compareSize(value, param, func(size, limit float64) bool { return size == limit })
+}
+
+func validateRegex(value reflect.Value, param string) bool {
+	value = indirect(value)
+	if value.Kind() != reflect.String {
+		return true
+	}
+	re, cached := regexCache.Load(param)
+	if !cached {
+		re, _ = regexCache.LoadOrStore(param, regexp.MustCompile(param))
+	}
+	return re.(*regexp.Regexp).MatchString(value.String())
+}
+
+func validateOneOf(value reflect.Value, param string) bool {
+	value = indirect(value)
+	// like other rules nil values pass, required rejects them.
+	if !value.IsValid() || ((value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) && value.IsNil()) {
+		return true
+	}
+	s := fmt.Sprint(value.Interface())
+	for _, allowed := range strings.Fields(param) {
+		if s == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func validateEmail(value reflect.Value, _ string) bool {
+	value = indirect(value)
+	if value.Kind() != reflect.String {
+		return true
+	}
+	addr, err := mail.ParseAddress(value.String())
+	return err == nil && addr.Address == value.String() && strings.Contains(addr.Address[strings.LastIndex(addr.Address, "@"):], ".")
+}
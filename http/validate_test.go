@@ -0,0 +1,146 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestValidate(t *testing.T) {
+	is := is.New(t)
+	RegisterValidator("even", func(value reflect.Value, _ string) bool {
+		return value.Int()%2 == 0
+	})
+	type item struct {
+		SKU      string `json:"sku" validate:"required,len=4"`
+		Quantity int    `json:"quantity" validate:"min=1,even"`
+	}
+	type input struct {
+		Page   int      `query:"page" validate:"min=1,max=100"`
+		Name   string   `json:"name" validate:"required"`
+		Email  string   `json:"email" validate:"omitempty,email"`
+		Color  string   `json:"color" validate:"oneof=red green"`
+		Slug   string   `json:"slug" validate:"regex=^[a-z]+$"`
+		Labels []string `json:"labels" validate:"max=2,dive,min=2"`
+		Items  []item   `json:"items" validate:"min=1"`
+		Owner  *item    `json:"owner"`
+	}
+
+	is.NoErr(Validate(&input{Page: 1, Name: "n", Color: "red", Slug: "abc", Items: []item{{SKU: "abcd", Quantity: 2}}}))
+
+	err := Validate(&input{
+		Page:   0,
+		Email:  "not-an-email",
+		Color:  "blue",
+		Slug:   "ABC",
+		Labels: []string{"a", "bb", "cc"},
+		Items:  []item{{SKU: "abc", Quantity: 3}},
+		Owner:  &item{},
+	})
+	var verr *ValidationError
+	is.True(err != nil)
+	verr = err.(*ValidationError)
+
+	failed := map[string]FieldError{}
+	for _, fe := range verr.Errors {
+		failed[fe.Field+":"+fe.Rule] = fe
+	}
+	is.Equal(failed["page:min"].In, "query")
+	is.Equal(failed["name:required"].In, "body")
+	is.True(failed["email:email"].Rule != "")
+	is.True(failed["color:oneof"].Rule != "")
+	is.True(failed["slug:regex"].Rule != "")
+	is.True(failed["labels:max"].Rule != "")
+	is.True(failed["labels[0]:min"].Rule != "")
+	is.True(failed["items[0].sku:len"].Rule != "")
+	is.True(failed["items[0].quantity:even"].Rule != "")
+	is.True(failed["owner.sku:required"].Rule != "")
+	is.Equal(len(verr.Errors), 11)
+
+	// nil pointers pass every rule but required.
+	type optional struct {
+		Color *string `json:"color" validate:"oneof=red green"`
+		Size  *int    `json:"size" validate:"min=1"`
+	}
+	is.NoErr(Validate(&optional{}))
+}
+
+func TestCheckValidationTags(t *testing.T) {
+	is := is.New(t)
+	type item struct {
+		SKU string `json:"sku" validate:"lenn=4"`
+	}
+	type valid struct {
+		Page   int      `query:"page" validate:"min=1,max=100"`
+		Labels []string `json:"labels" validate:"max=2,dive,regex=^[a-z]+$"`
+	}
+	is.NoErr(checkValidationTags(reflect.TypeOf(valid{})))
+	for _, input := range []any{
+		struct {
+			Name string `json:"name" validate:"requird"`
+		}{},
+		struct {
+			Name string `json:"name" validate:"min=three"`
+		}{},
+		struct {
+			Name string `json:"name" validate:"regex=^[a-z"`
+		}{},
+		struct {
+			Tags []string `json:"tags" validate:"dive,oneof="`
+		}{},
+		struct {
+			Items []item `json:"items"`
+		}{},
+	} {
+		is.True(checkValidationTags(reflect.TypeOf(input)) != nil) // input
+	}
+
+	defer func() {
+		is.True(recover() != nil) // routes with invalid tags are rejected at registration
+	}()
+	NewServeMux().HandleFunc("POST /items", func(r *Request, in *item) (item, error) { return *in, nil })
+}
+
+func TestServerValidation(t *testing.T) {
+	is := is.New(t)
+	type input struct {
+		ID   int    `path:"id" validate:"min=10"`
+		Name string `json:"name" validate:"required,min=3"`
+	}
+	mux := NewServeMux()
+	called := false
+	mux.HandleFunc("POST /users/{id}", func(r *Request, in *input) (map[string]string, error) {
+		called = true
+		return map[string]string{"name": in.Name}, nil
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/users/1", "application/json", strings.NewReader(`{"name": "ab"}`))
+	is.NoErr(err)
+	defer resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusUnprocessableEntity)
+	is.Equal(resp.Header.Get("Content-Type"), "application/problem+json")
+	is.True(!called)
+
+	var body struct {
+		Errors []FieldError `json:"errors"`
+	}
+	is.NoErr(json.NewDecoder(resp.Body).Decode(&body))
+	is.Equal(len(body.Errors), 2)
+	is.Equal(body.Errors[0], FieldError{Field: "id", In: "path", Rule: "min", Param: "10", Message: "must be at least 10"})
+	is.Equal(body.Errors[1].Field, "name")
+
+	resp, err = http.Post(srv.URL+"/users/12", "application/json", bytes.NewReader([]byte(`{"name": "abc"}`)))
+	is.NoErr(err)
+	defer resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.True(called)
+}
@@ -0,0 +1,509 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/amirrezaask/pkg/errors"
+)
+
+// Message types of websocket frames.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// Close codes defined in RFC 6455 section 7.4.1.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseInternalServerErr       = 1011
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// DefaultWebSocketReadLimit is the maximum size of a message read from a websocket, see WebSocketConn.SetReadLimit.
+	DefaultWebSocketReadLimit int64 = 1 << 20
+	// WebSocketPingInterval is how often server pings clients, connections that don't send anything
+	// in two intervals are considered dead.
+	WebSocketPingInterval = 30 * time.Second
+	// CheckWebSocketOrigin decides whether an upgrade request is allowed, by default browsers can only
+	// connect from the same host.
+	CheckWebSocketOrigin = sameOrigin
+)
+
+// CloseError is returned from reads after peer closed the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed with code=%d reason='%s'", e.Code, e.Reason)
+}
+
+// WebSocketConn is a websocket connection. Reads should happen from a single goroutine and must continue
+// for control frames such as pings and close to be handled, writes are safe to use concurrently.
+type WebSocketConn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	isClient  bool
+	readLimit int64
+
+	writeMu    sync.Mutex
+	closeSent  bool
+	closed     chan struct{}
+	closedOnce sync.Once
+}
+
+func newWebSocketConn(conn net.Conn, br *bufio.Reader, isClient bool) *WebSocketConn {
+	return &WebSocketConn{conn: conn, br: br, isClient: isClient, readLimit: DefaultWebSocketReadLimit, closed: make(chan struct{})}
+}
+
+// SetReadLimit sets maximum size of a message in bytes, peers sending larger messages are closed with CloseMessageTooBig.
+// Limit must be positive, since frame lengths are declared by peer and buffers are allocated for them.
+func (c *WebSocketConn) SetReadLimit(limit int64) {
+	if limit <= 0 {
+		panic(fmt.Sprintf("websocket read limit should be positive, got %d", limit))
+	}
+	c.readLimit = limit
+}
+
+// RemoteAddr returns address of the peer.
+func (c *WebSocketConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage returns the next text or binary message, fragmented messages are reassembled.
+// Once peer closes the connection a *CloseError is returned.
+func (c *WebSocketConn) ReadMessage() (int, []byte, error) {
+	messageType := 0
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case PingMessage:
+			if err := c.writeFrame(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			closeErr := &CloseError{Code: CloseNoStatusReceived}
+			if len(payload) == 1 {
+				return 0, nil, c.fail(CloseProtocolError, "invalid close payload")
+			}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+				if !utf8.Valid(payload[2:]) {
+					return 0, nil, c.fail(CloseInvalidFramePayloadData, "invalid close reason")
+				}
+			}
+			echo := closeErr.Code
+			if echo == CloseNoStatusReceived {
+				echo = CloseNormalClosure
+			}
+			c.Close(echo, "")
+			return 0, nil, closeErr
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "new message started before previous one finished")
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "continuation frame without a message")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", opcode))
+		}
+
+		if int64(len(message)+len(payload)) > c.readLimit {
+			return 0, nil, c.fail(CloseMessageTooBig, fmt.Sprintf("message is larger than %d bytes", c.readLimit))
+		}
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+		if messageType == TextMessage && !utf8.Valid(message) {
+			return 0, nil, c.fail(CloseInvalidFramePayloadData, "text message is not valid utf-8")
+		}
+		return messageType, message, nil
+	}
+}
+
+// ReadJSON reads the next message and decodes it as json into v.
+func (c *WebSocketConn) ReadJSON(v any) error {
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(message, v)
+}
+
+// WriteMessage sends data as a single frame of messageType.
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket message type %d cannot be written as a message", messageType)
+	}
+	return c.writeFrame(messageType, data)
+}
+
+// WriteJSON encodes v as json and sends it as a text message.
+func (c *WebSocketConn) WriteJSON(v any) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(TextMessage, bs)
+}
+
+// Ping sends a ping frame, peer answers with a pong that is handled by ReadMessage.
+func (c *WebSocketConn) Ping() error {
+	return c.writeFrame(PingMessage, nil)
+}
+
+// Close sends a close frame with code and reason and closes the underlying connection, it's safe to call more than once.
+func (c *WebSocketConn) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	err := c.writeFrame(CloseMessage, payload)
+	c.closedOnce.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// fail closes the connection because peer did not follow the protocol.
+func (c *WebSocketConn) fail(code int, reason string) error {
+	c.Close(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func (c *WebSocketConn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	if !c.isClient {
+		c.conn.SetReadDeadline(time.Now().Add(2 * WebSocketPingInterval))
+	}
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = int(header[0] & 0x0f)
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits are set")
+	}
+	masked := header[1]&0x80 != 0
+	if masked == c.isClient {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid frame masking")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length>>63 != 0 {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid frame length")
+		}
+	}
+	if opcode >= CloseMessage && (!fin || length > 125) {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+	}
+	if length > uint64(c.readLimit) {
+		return false, 0, nil, c.fail(CloseMessageTooBig, fmt.Sprintf("message is larger than %d bytes", c.readLimit))
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+func (c *WebSocketConn) writeFrame(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|byte(opcode))
+	maskBit := byte(0)
+	if c.isClient {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	if c.isClient {
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(mask, frame[start:])
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(WebSocketPingInterval))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func (c *WebSocketConn) keepAlive() {
+	ticker := time.NewTicker(WebSocketPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			if err := c.Ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func maskBytes(mask [4]byte, bs []byte) {
+	for i := range bs {
+		bs[i] ^= mask[i%4]
+	}
+}
+
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// upgradeWebSocket performs the opening handshake and takes over connection of w.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocketConn, error) {
+	if r.Method != http.MethodGet {
+		return nil, errors.NewHTTPError(http.StatusMethodNotAllowed, "websocket_method_not_allowed", "websocket upgrade requires GET")
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		return nil, errors.NewHTTPError(http.StatusUpgradeRequired, "websocket_upgrade_required", "this endpoint only accepts websocket connections")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "websocket_unsupported_version", "only websocket version 13 is supported")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, errors.NewHTTPError(http.StatusBadRequest, "websocket_invalid_key", "Sec-WebSocket-Key is not valid")
+	}
+	if !CheckWebSocketOrigin(r) {
+		return nil, errors.NewHTTPError(http.StatusForbidden, "websocket_origin_not_allowed", "origin is not allowed")
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot hijack connection for websocket")
+	}
+	// deadlines of http server don't apply to websockets.
+	conn.SetDeadline(time.Time{})
+	if brw.Reader.Buffered() > 0 {
+		conn.Close()
+		return nil, errors.New("client sent data before websocket handshake finished")
+	}
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return newWebSocketConn(conn, brw.Reader, false), nil
+}
+
+// serveWebSocket upgrades request and runs handler on the connection, connection is closed after handler returns.
+func serveWebSocket(w http.ResponseWriter, r *http.Request, handler func(*Request, *WebSocketConn) error) {
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		if _, isHTTPErr := errors.AsHTTPError(err); isHTTPErr {
+			writeError(w, r, err)
+		} else {
+			slog.Error("cannot upgrade to websocket", "err", err, "path", r.URL.Path)
+		}
+		return
+	}
+	go conn.keepAlive()
+
+	err = func() (err error) {
+		defer recoverAsError(&err)
+		return handler(&Request{r}, conn)
+	}()
+	var closeErr *CloseError
+	if err != nil && !errors.As(err, &closeErr) && !errors.Is(err, net.ErrClosed) {
+		slog.Error("error in websocket handler", "err", err.Error(), "path", r.URL.Path)
+		conn.Close(CloseInternalServerErr, "")
+		return
+	}
+	conn.Close(CloseNormalClosure, "")
+}
+
+// DialWebSocket connects to a websocket server, rawURL can use ws, wss, http or https schemes.
+func DialWebSocket(ctx context.Context, rawURL string, header http.Header) (*WebSocketConn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	secure := false
+	switch u.Scheme {
+	case "ws", "http":
+		u.Scheme = "http"
+	case "wss", "https":
+		u.Scheme = "https"
+		secure = true
+	default:
+		return nil, nil, errors.Newf("unsupported websocket scheme '%s'", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), map[bool]string{false: "80", true: "443"}[secure])
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, nil, err
+	}
+	if secure {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		conn = tlsConn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var nonce [16]byte
+	rand.Read(nonce[:])
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		conn.Close()
+		return nil, resp, errors.Newf("websocket handshake failed with status %d", resp.StatusCode)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return newWebSocketConn(conn, br, true), resp, nil
+}
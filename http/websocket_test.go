@@ -0,0 +1,100 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// writeRawFrame writes a masked client frame with given fin bit, used to send fragmented messages.
+func writeRawFrame(c *WebSocketConn, fin bool, opcode int, payload []byte) error {
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	mask := [4]byte{1, 2, 3, 4}
+	masked := append([]byte(nil), payload...)
+	maskBytes(mask, masked)
+	frame := append([]byte{first, 0x80 | byte(len(payload))}, mask[:]...)
+	_, err := c.conn.Write(append(frame, masked...))
+	return err
+}
+
+func TestWebSocket(t *testing.T) {
+	is := is.New(t)
+	type message struct {
+		Text string `json:"text"`
+		User string `json:"user"`
+	}
+	mux := NewServeMux()
+	mux.UseMiddlewares(PrometheusExporterMiddleware("websocket_test"))
+	userMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), ClaimsKey, r.URL.Query().Get("user")))
+			next.ServeHTTP(w, r)
+		})
+	}
+	mux.HandleFunc("GET /chat", func(r *Request, conn *WebSocketConn) error {
+		conn.SetReadLimit(64)
+		for {
+			var msg message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return err
+			}
+			msg.User = r.Context().Value(ClaimsKey).(string)
+			if err := conn.WriteJSON(msg); err != nil {
+				return err
+			}
+		}
+	}, userMiddleware)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, resp, err := DialWebSocket(ctx, strings.Replace(srv.URL, "http", "ws", 1)+"/chat?user=ali", nil)
+	is.NoErr(err)
+	is.Equal(resp.StatusCode, http.StatusSwitchingProtocols)
+
+	is.NoErr(conn.WriteJSON(message{Text: "hello"}))
+	var got message
+	is.NoErr(conn.ReadJSON(&got))
+	is.Equal(got, message{Text: "hello", User: "ali"})
+
+	// fragmented message with a ping in between.
+	is.NoErr(writeRawFrame(conn, false, TextMessage, []byte(`{"text":`)))
+	is.NoErr(writeRawFrame(conn, true, PingMessage, []byte("p")))
+	is.NoErr(writeRawFrame(conn, true, continuationFrame, []byte(`"parts"}`)))
+	is.NoErr(conn.ReadJSON(&got))
+	is.Equal(got.Text, "parts")
+
+	is.NoErr(conn.WriteMessage(TextMessage, []byte(strings.Repeat("a", 100))))
+	_, _, err = conn.ReadMessage()
+	var closeErr *CloseError
+	is.True(errors.As(err, &closeErr))
+	is.Equal(closeErr.Code, CloseMessageTooBig)
+
+	resp, err = http.Get(srv.URL + "/chat")
+	is.NoErr(err)
+	resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusUpgradeRequired)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/chat", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	_, resp, err = DialWebSocket(ctx, srv.URL+"/chat", req.Header)
+	is.True(err != nil)
+	is.Equal(resp.StatusCode, http.StatusForbidden)
+}
+
+func TestWebSocketReadLimit(t *testing.T) {
+	is := is.New(t)
+	defer func() { is.True(recover() != nil) }()
+	conn := newWebSocketConn(nil, nil, false)
+	conn.SetReadLimit(0)
+}
@@ -22,8 +22,29 @@ func (r *DistributedLock) Lock(ctx context.Context, key string, dur time.Duratio
 	}
 
 	if count != 0 {
-		return errors.Newf("cannot aquire distributed lock for key('%s')", key)
+		return errors.Wrap(ErrLocked, "cannot aquire distributed lock for key('%s')", key)
 	}
 
 	return r.Set(ctx, key, 1, dur).Err()
 }
+
+// Locker adapts r to Locker, locks expire after ttl so a crashed holder cannot keep its key locked forever.
+func (r *DistributedLock) Locker(ttl time.Duration) Locker {
+	return &expiringLock{DistributedLock: r, ttl: ttl}
+}
+
+type expiringLock struct {
+	*DistributedLock
+	ttl time.Duration
+}
+
+func (e *expiringLock) Lock(ctx context.Context, key string) error {
+	acquired, err := e.SetNX(ctx, key, 1, e.ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return errors.Wrap(ErrLocked, "cannot aquire distributed lock for key('%s')", key)
+	}
+	return nil
+}
@@ -2,10 +2,13 @@ package lock
 
 import (
 	"context"
+	stderrors "errors"
 )
 
+// ErrLocked is wrapped by errors of Lock when key is already held, other errors mean the lock backend failed.
+var ErrLocked = stderrors.New("lock is already held")
+
 type Locker interface {
 	Lock(ctx context.Context, key string) error
 	Unlock(ctx context.Context, key string) error
 }
-
@@ -18,11 +18,10 @@ func NewInMemoryLock() *InMemoryLock {
 }
 
 func (i *InMemoryLock) Lock(ctx context.Context, key string) error {
-	if _, ok := i.data.Load(key); ok {
-		return errors.Newf("cannot aquire lock for key('%s')", key)
+	if _, loaded := i.data.LoadOrStore(key, struct{}{}); loaded {
+		return errors.Wrap(ErrLocked, "cannot aquire lock for key('%s')", key)
 	}
 
-	i.data.Store(key, struct{}{})
 	return nil
 }
 
@@ -101,9 +101,9 @@ func Init(c Config) {
 	}
 
 	logger := slog.New(
-		slogmulti.Fanout(
+		NewContextHandler(slogmulti.Fanout(
 			handlers...,
-		),
+		)),
 	)
 
 	slog.SetDefault(logger)